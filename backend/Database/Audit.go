@@ -0,0 +1,119 @@
+package Database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// ดู AuditLogs ล่าสุด กรองด้วย ?actorid= ?entity= ?entityid= ?action= ?method= ?from= ?to= (YYYY-MM-DD) และ ?limit=
+// role อื่นนอกจาก Super Admin เห็นเฉพาะรายการที่ทำโดยพนักงานในสาขาตัวเอง
+func LookAuditLogs(db *gorm.DB, c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be between 1 and 1000",
+		})
+	}
+
+	query := scopeBranch(c, db.Model(&Models.AuditLogs{}), "branch_id")
+	for param, column := range map[string]string{
+		"actorid":  "actor_id",
+		"entity":   "entity",
+		"entityid": "entity_id",
+		"action":   "action",
+		"method":   "method",
+	} {
+		if value := c.Query(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if from := c.Query("from"); from != "" {
+		start, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "from must be in YYYY-MM-DD format",
+			})
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if to := c.Query("to"); to != "" {
+		end, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "to must be in YYYY-MM-DD format",
+			})
+		}
+		query = query.Where("created_at < ?", end.AddDate(0, 0, 1))
+	}
+
+	var logs []Models.AuditLogs
+	if err := query.Order("sequence DESC").Limit(limit).Find(&logs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find audit logs: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": logs})
+}
+
+// ตรวจสอบ hash chain ของ AuditLogs ทั้งหมดตั้งแต่แถวแรก
+// รายงานแถวแรกที่ลำดับขาด hash ของแถวก่อนหน้าไม่ตรง หรือข้อมูลถูกแก้ไข
+func VerifyAuditLogs(db *gorm.DB, c *fiber.Ctx) error {
+	const batchSize = 1000
+
+	var checked int64
+	var prevHash string
+	var lastSequence int64
+	for {
+		var batch []Models.AuditLogs
+		if err := db.Where("sequence > ?", lastSequence).Order("sequence").Limit(batchSize).Find(&batch).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to read audit logs: " + err.Error(),
+			})
+		}
+		for _, entry := range batch {
+			reason := ""
+			switch {
+			case entry.Sequence != lastSequence+1:
+				reason = "sequence gap"
+			case entry.PrevHash != prevHash:
+				reason = "previous hash mismatch"
+			case Middleware.AuditHash(entry) != entry.Hash:
+				reason = "hash mismatch"
+			}
+			if reason != "" {
+				return c.JSON(fiber.Map{
+					"valid":    false,
+					"checked":  checked,
+					"brokenat": entry.Sequence,
+					"reason":   reason,
+				})
+			}
+			checked++
+			prevHash = entry.Hash
+			lastSequence = entry.Sequence
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	return c.JSON(fiber.Map{
+		"valid":    true,
+		"checked":  checked,
+		"lasthash": prevHash,
+	})
+}
+
+// Route สำหรับ AuditLogs
+func AuditRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/audit", func(c *fiber.Ctx) error {
+		return LookAuditLogs(db, c)
+	})
+	app.Get("/audit/verify", func(c *fiber.Ctx) error {
+		return VerifyAuditLogs(db, c)
+	})
+}
@@ -1,10 +1,14 @@
 package Database
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/posproject/Models"
 	"gorm.io/gorm"
 )
@@ -33,10 +37,61 @@ func AddBranches(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	// กำหนดรหัสสาขา (ใช้เป็น prefix ของเลขใบเสร็จ) ถ้าไม่ได้ส่งมาจะสร้างให้อัตโนมัติ
+	code, err := normalizeBranchCode(req.BranchCode)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	generateCode := code == ""
+
+	if req.TaxID != "" && !validThaiTaxID(req.TaxID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid tax ID",
+		})
+	}
+
 	// ใช้ Transaction เพื่อให้แน่ใจว่าทั้ง Branch และ Inventory ถูกสร้างครบ
-	err := db.Transaction(func(tx *gorm.DB) error {
+	// รหัสที่สร้างอัตโนมัติอาจชนกับสาขาที่สร้างพร้อมกัน ให้ลองรหัสถัดไปใหม่
+	for attempt := 0; ; attempt++ {
+		if generateCode {
+			if code, err = nextBranchCode(db); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to generate branch code: " + err.Error(),
+				})
+			}
+		}
+		req.BranchCode = code
+		err = createBranch(db, &req)
+		if !isUniqueViolation(err, "idx_branches_branch_code") {
+			break
+		}
+		if !generateCode || attempt >= 4 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "BranchCode " + code + " already exists",
+			})
+		}
+	}
+
+	// ตรวจสอบว่า Transaction สำเร็จหรือไม่
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create branch and inventory: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"NewBranch": req,
+		"Message":   "Branch and Inventory created successfully",
+	})
+}
+
+// บันทึก Branch พร้อมสร้าง Inventory ของทุก Product ใน Transaction เดียวกัน
+func createBranch(db *gorm.DB, req *Models.Branches) error {
+	return db.Transaction(func(tx *gorm.DB) error {
 		// 1️⃣ บันทึก Branch ลงฐานข้อมูล
-		if err := tx.Create(&req).Error; err != nil {
+		if err := tx.Create(req).Error; err != nil {
 			return err
 		}
 
@@ -67,18 +122,40 @@ func AddBranches(db *gorm.DB, c *fiber.Ctx) error {
 
 		return nil // Transaction สำเร็จ
 	})
+}
 
-	// ตรวจสอบว่า Transaction สำเร็จหรือไม่
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create branch and inventory: " + err.Error(),
-		})
+// ทำรหัสสาขาให้อยู่ในรูปแบบเดียวกัน (ตัวพิมพ์ใหญ่ ไม่เกิน 10 ตัวอักษร)
+// ความไม่ซ้ำตรวจด้วย unique index idx_branches_branch_code ตอนบันทึก
+func normalizeBranchCode(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) > 10 {
+		return "", fmt.Errorf("BranchCode must be at most 10 characters")
 	}
+	return code, nil
+}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"NewBranch": req,
-		"Message":   "Branch and Inventory created successfully",
-	})
+// หารหัสสาขาถัดไปในรูปแบบ BRxx ที่ยังไม่มีสาขาใดใช้
+func nextBranchCode(db *gorm.DB) (string, error) {
+	var count int64
+	if err := db.Model(&Models.Branches{}).Count(&count).Error; err != nil {
+		return "", err
+	}
+	for n := count + 1; ; n++ {
+		candidate := fmt.Sprintf("BR%02d", n)
+		var existing int64
+		if err := db.Model(&Models.Branches{}).Where("branch_code = ?", candidate).Count(&existing).Error; err != nil {
+			return "", err
+		}
+		if existing == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+// ตรวจว่า error มาจากการบันทึกค่าซ้ำใน unique index ที่กำหนดหรือไม่
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
 }
 
 // ดู Branch ทั้งหมด
@@ -132,8 +209,30 @@ func UpdateBranch(db *gorm.DB, c *fiber.Ctx) error {
 	branch.BName = req.BName
 	branch.Location = req.Location
 	branch.GoogleLocation = req.GoogleLocation
+	if req.TaxID != "" {
+		if !validThaiTaxID(req.TaxID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid tax ID",
+			})
+		}
+		branch.TaxID = req.TaxID
+	}
+	if req.BranchCode != "" {
+		code, err := normalizeBranchCode(req.BranchCode)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		branch.BranchCode = code
+	}
 
 	if err := db.Save(&branch).Error; err != nil {
+		if isUniqueViolation(err, "idx_branches_branch_code") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "BranchCode " + branch.BranchCode + " already exists",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update branch: " + err.Error(),
 		})
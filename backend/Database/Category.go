@@ -26,6 +26,19 @@ func AddCategory(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	// ตรวจสอบการตั้งค่าภาษี ถ้าไม่ระบุจะใช้ VAT 7% แบบราคารวม VAT
+	if req.TaxMode == "" {
+		req.TaxMode = "inclusive"
+	}
+	if err := validateTaxSettings(req.TaxMode, &req.TaxRate); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if req.TaxRate == 0 && req.TaxMode != "exempt" {
+		req.TaxRate = defaultVatRate
+	}
+
 	// สร้าง CategoryCode จาก 4 ตัวแรกของชื่อหมวดหมู่
 	req.CategoryCode = generateCategoryCode(req.CategoryName)
 
@@ -76,6 +89,52 @@ func LookCategories(db *gorm.DB, c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"Data": categories})
 }
 
+// UpdateCategory แก้ไขชื่อและการตั้งค่าภาษีของ Category (CategoryCode คงเดิม)
+func UpdateCategory(db *gorm.DB, c *fiber.Ctx) error {
+	categoryID := c.Params("categoryid")
+
+	var category Models.Category
+	if err := db.Where("category_id = ?", categoryID).First(&category).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Category not found",
+		})
+	}
+
+	var req struct {
+		CategoryName string   `json:"categoryname"`
+		TaxMode      string   `json:"taxmode"`
+		TaxRate      *float64 `json:"taxrate"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if err := validateTaxSettings(req.TaxMode, req.TaxRate); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// อัปเดตเฉพาะข้อมูลที่มีการส่งมา
+	if req.CategoryName != "" {
+		category.CategoryName = req.CategoryName
+	}
+	if req.TaxMode != "" {
+		category.TaxMode = req.TaxMode
+	}
+	if req.TaxRate != nil {
+		category.TaxRate = *req.TaxRate
+	}
+
+	if err := db.Save(&category).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update category: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+}
+
 // DeleteCategory ลบ Category โดยใช้ categoryid
 func DeleteCategory(db *gorm.DB, c *fiber.Ctx) error {
 	categoryID := c.Params("categoryid") // รับ categoryid จากพารามิเตอร์ใน URL
@@ -108,6 +167,9 @@ func CategoryRoutes(app *fiber.App, db *gorm.DB) {
 	app.Post("/categories", func(c *fiber.Ctx) error {
 		return AddCategory(db, c)
 	})
+	app.Put("/categories/:categoryid", func(c *fiber.Ctx) error {
+		return UpdateCategory(db, c)
+	})
 	app.Delete("/categories/:categoryid", func(c *fiber.Ctx) error {
 		return DeleteCategory(db, c)
 	})
@@ -0,0 +1,336 @@
+package Database
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	bahtPerPoint = 25.0 // ยอดซื้อทุก 25 บาทได้ 1 แต้ม (ก่อนคูณตามระดับสมาชิก)
+	pointValue   = 0.25 // มูลค่า 1 แต้มเมื่อนำมาชำระเงิน (บาท)
+)
+
+// ตัวคูณแต้มตามระดับสมาชิก
+var tierEarnMultiplier = map[string]float64{
+	"Standard": 1,
+	"Silver":   1.25,
+	"Gold":     1.5,
+	"Platinum": 2,
+}
+
+// ทำเบอร์โทรให้อยู่ในรูปแบบเดียวกัน (ตัดช่องว่างและขีด)
+func normalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(phone))
+}
+
+// คำนวณแต้มที่ได้รับจากยอดซื้อตามระดับสมาชิก
+func pointsForAmount(amount float64, tier string) int {
+	multiplier, ok := tierEarnMultiplier[tier]
+	if !ok {
+		multiplier = 1
+	}
+	if amount <= 0 {
+		return 0
+	}
+	return int(math.Floor(amount / bahtPerPoint * multiplier))
+}
+
+// จำนวนแต้มที่ต้องใช้เพื่อชำระเงินตามยอดที่กำหนด
+func pointsForRedemption(amount float64) int {
+	return int(math.Ceil(roundMoney(amount)/pointValue - 1e-9))
+}
+
+// บันทึกการเปลี่ยนแปลงแต้มลง PointsLedger และอัปเดตยอดคงเหลือของลูกค้า
+// customer ต้องถูก lock ไว้แล้วภายใน Transaction เดียวกัน
+func postPoints(tx *gorm.DB, customer *Models.Customers, points int, entryType string, saleID *string, refundID *string) error {
+	if points == 0 {
+		return nil
+	}
+	if customer.PointsBalance+points < 0 {
+		return fmt.Errorf("customer has %d points, cannot deduct %d", customer.PointsBalance, -points)
+	}
+	customer.PointsBalance += points
+
+	entry := Models.PointsLedger{
+		EntryID:      uuid.New().String(),
+		CustomerID:   customer.CustomerID,
+		SaleID:       saleID,
+		RefundID:     refundID,
+		Type:         entryType,
+		Points:       points,
+		BalanceAfter: customer.PointsBalance,
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Models.Customers{}).Where("customer_id = ?", customer.CustomerID).Update("points_balance", customer.PointsBalance).Error
+}
+
+// ดึงข้อมูลลูกค้าพร้อม lock แถวไว้สำหรับการตัด/เพิ่มแต้ม
+func lockCustomer(tx *gorm.DB, customerID string) (Models.Customers, error) {
+	var customer Models.Customers
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("customer_id = ?", customerID).First(&customer).Error
+	return customer, err
+}
+
+// เพิ่มลูกค้า
+func AddCustomer(db *gorm.DB, c *fiber.Ctx) error {
+	var req Models.Customers
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	req.Phone = normalizePhone(req.Phone)
+	if req.Phone == "" || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Phone and name are required",
+		})
+	}
+	if req.Tier == "" {
+		req.Tier = "Standard"
+	}
+	if _, ok := tierEarnMultiplier[req.Tier]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid tier: " + req.Tier,
+		})
+	}
+
+	var existing int64
+	db.Model(&Models.Customers{}).Where("phone = ?", req.Phone).Count(&existing)
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Customer with this phone already exists",
+		})
+	}
+
+	req.CustomerID = uuid.New().String()
+	req.PointsBalance = 0
+	req.CreatedAt = time.Now()
+
+	if err := db.Create(&req).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create customer: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req})
+}
+
+// ดู Customers ทั้งหมด
+func LookCustomers(db *gorm.DB, c *fiber.Ctx) error {
+	var customers []Models.Customers
+	if err := db.Find(&customers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find customers: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": customers})
+}
+
+// หา Customer ตาม ID
+func FindCustomer(db *gorm.DB, c *fiber.Ctx) error {
+	var customer Models.Customers
+	if err := db.Where("customer_id = ?", c.Params("id")).First(&customer).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+	return c.JSON(fiber.Map{"Data": customer})
+}
+
+// หา Customer ตามเบอร์โทร
+func FindCustomerByPhone(db *gorm.DB, c *fiber.Ctx) error {
+	var customer Models.Customers
+	if err := db.Where("phone = ?", normalizePhone(c.Params("phone"))).First(&customer).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+	return c.JSON(fiber.Map{"Data": customer})
+}
+
+// อัปเดต Customer (แต้มคงเหลือแก้ไขผ่าน endpoint นี้ไม่ได้)
+func UpdateCustomer(db *gorm.DB, c *fiber.Ctx) error {
+	var customer Models.Customers
+	if err := db.Where("customer_id = ?", c.Params("id")).First(&customer).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	var req Models.Customers
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	// อัปเดตเฉพาะข้อมูลที่มีการส่งมาใน request
+	if phone := normalizePhone(req.Phone); phone != "" && phone != customer.Phone {
+		var existing int64
+		db.Model(&Models.Customers{}).Where("phone = ?", phone).Count(&existing)
+		if existing > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Customer with this phone already exists",
+			})
+		}
+		customer.Phone = phone
+	}
+	if req.Name != "" {
+		customer.Name = req.Name
+	}
+	if req.Email != "" {
+		customer.Email = req.Email
+	}
+	if req.Tier != "" {
+		if _, ok := tierEarnMultiplier[req.Tier]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid tier: " + req.Tier,
+			})
+		}
+		customer.Tier = req.Tier
+	}
+
+	if err := db.Model(&customer).Select("phone", "name", "email", "tier").Updates(&customer).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update customer: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+}
+
+// ดูประวัติแต้มของลูกค้า
+func LookCustomerPoints(db *gorm.DB, c *fiber.Ctx) error {
+	var customer Models.Customers
+	if err := db.Where("customer_id = ?", c.Params("id")).First(&customer).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	var entries []Models.PointsLedger
+	if err := db.Where("customer_id = ?", customer.CustomerID).Order("created_at DESC").Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find points history: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"Balance": customer.PointsBalance,
+		"Data":    entries,
+	})
+}
+
+// Route สำหรับ Customers
+func CustomerRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/customers", func(c *fiber.Ctx) error {
+		return LookCustomers(db, c)
+	})
+	app.Get("/customers/phone/:phone", func(c *fiber.Ctx) error {
+		return FindCustomerByPhone(db, c)
+	})
+	app.Get("/customers/:id", func(c *fiber.Ctx) error {
+		return FindCustomer(db, c)
+	})
+	app.Get("/customers/:id/points", func(c *fiber.Ctx) error {
+		return LookCustomerPoints(db, c)
+	})
+	app.Post("/customers", func(c *fiber.Ctx) error {
+		return AddCustomer(db, c)
+	})
+	app.Put("/customers/:id", func(c *fiber.Ctx) error {
+		return UpdateCustomer(db, c)
+	})
+}
+
+// แปลงยอดชำระด้วยแต้มของแต่ละรายการเป็นจำนวนแต้ม ตัดแต้มของลูกค้า และคืนยอดแต้มทั้งหมดที่ใช้
+func redeemPointsTenders(tx *gorm.DB, customer *Models.Customers, saleID string, payments []Models.Payments) (float64, error) {
+	var redeemed float64
+	for i := range payments {
+		if payments[i].Method != "points" {
+			continue
+		}
+		points := pointsForRedemption(payments[i].Amount)
+		if points > customer.PointsBalance {
+			return 0, fmt.Errorf("customer has %d points, %d required", customer.PointsBalance, points)
+		}
+		if err := postPoints(tx, customer, -points, "redeem", &saleID, nil); err != nil {
+			return 0, err
+		}
+		payments[i].Reference = fmt.Sprintf("%d points", points)
+		redeemed += payments[i].Amount
+	}
+	return roundMoney(redeemed), nil
+}
+
+// คืนแต้มที่ใช้ชำระตามยอดที่คืนเป็นแต้ม แล้วหักแต้มที่ได้รับจากการขายตามสัดส่วนยอดที่คืน
+// refundedTotal คือยอดคืนสะสมของการขายนี้รวมรายการปัจจุบัน
+// คืนจำนวนแต้มที่ต้องหักแต่ลูกค้าใช้ไปแล้ว (shortfall) ไว้บันทึกกับการคืนเงิน
+func reverseSalePoints(tx *gorm.DB, sale Models.Sales, refundID string, refundedTotal float64, fullyRefunded bool, points refundPoints) (int, error) {
+	if sale.CustomerID == nil {
+		return 0, nil
+	}
+	customer, err := lockCustomer(tx, *sale.CustomerID)
+	if err != nil {
+		return 0, err
+	}
+
+	var history []Models.PointsLedger
+	if err := tx.Where("sale_id = ?", sale.SaleID).Find(&history).Error; err != nil {
+		return 0, err
+	}
+	var reversed, redeemed, restored int
+	for _, entry := range history {
+		switch {
+		case entry.Type == "reverse" && entry.Points < 0:
+			reversed += -entry.Points
+		case entry.Type == "reverse" && entry.Points > 0:
+			restored += entry.Points
+		case entry.Type == "redeem":
+			redeemed += -entry.Points
+		}
+	}
+
+	// คืนแต้มที่ใช้ชำระตามสัดส่วนของยอดที่คืนเป็นแต้ม (คืนครบทั้งบิลได้แต้มที่เหลือทั้งหมด)
+	restore := redeemed
+	if !fullyRefunded && points.Paid > 0 {
+		restore = int(math.Round(float64(redeemed) * points.Refunded / points.Paid))
+		if restore > redeemed {
+			restore = redeemed
+		}
+	}
+	if restore > restored {
+		if err := postPoints(tx, &customer, restore-restored, "reverse", &sale.SaleID, &refundID); err != nil {
+			return 0, err
+		}
+	}
+
+	// หักแต้มที่ได้รับตามสัดส่วน ถ้าลูกค้าใช้แต้มไปแล้วหักได้เท่าที่มีและบันทึกส่วนที่ขาดไว้
+	target := sale.PointsEarned
+	if !fullyRefunded && sale.TotalAmount > 0 {
+		target = int(math.Round(float64(sale.PointsEarned) * refundedTotal / sale.TotalAmount))
+		if target > sale.PointsEarned {
+			target = sale.PointsEarned
+		}
+	}
+	shortfall := 0
+	if deduct := target - reversed; deduct > 0 {
+		if deduct > customer.PointsBalance {
+			shortfall = deduct - customer.PointsBalance
+			deduct = customer.PointsBalance
+		}
+		if err := postPoints(tx, &customer, -deduct, "reverse", &sale.SaleID, &refundID); err != nil {
+			return 0, err
+		}
+	}
+	return shortfall, nil
+}
@@ -0,0 +1,318 @@
+package Database
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"github.com/posproject/Security"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PIN ต้องเป็นตัวเลข 4-6 หลัก
+var pinPattern = regexp.MustCompile(`^[0-9]{4,6}$`)
+
+// header ที่เครื่อง POS ใช้ส่ง device token ตอน login ด้วย PIN
+const deviceTokenHeader = "X-Device-Token"
+
+// ลงทะเบียนเครื่อง POS ให้สาขา และคืน secret ที่ใช้ยืนยันตัวเครื่อง (แสดงครั้งเดียว)
+func AddDevice(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		Name     string `json:"name"`
+		BranchID string `json:"branchid"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Device name is required",
+		})
+	}
+	branchID, ok := writeBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	if branchID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "branchid is required",
+		})
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate device secret",
+		})
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	device := Models.PosDevices{
+		DeviceID:   uuid.New().String(),
+		Name:       strings.TrimSpace(req.Name),
+		BranchID:   branchID,
+		SecretHash: hashRefreshToken(secret),
+		Status:     "active",
+		CreatedAt:  time.Now(),
+	}
+	if err := db.Create(&device).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create device: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"New":    device,
+		"secret": secret,
+	})
+}
+
+// ดูเครื่อง POS ทั้งหมดของสาขา
+func LookDevices(db *gorm.DB, c *fiber.Ctx) error {
+	var devices []Models.PosDevices
+	if err := scopeBranch(c, db, "branch_id").Order("created_at").Find(&devices).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find devices: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": devices})
+}
+
+// ยกเลิกการใช้งานเครื่อง POS token ที่ออกจากเครื่องนี้จะใช้ไม่ได้ทันที
+func DisableDevice(db *gorm.DB, c *fiber.Ctx) error {
+	var device Models.PosDevices
+	if err := db.Where("device_id = ?", c.Params("id")).First(&device).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Device not found",
+		})
+	}
+	if !canAccessBranch(c, device.BranchID) {
+		return branchForbidden(c)
+	}
+	if err := db.Model(&device).Update("status", "disabled").Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disable device: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Deleted": "Succeed"})
+}
+
+// ตั้ง PIN ของพนักงาน
+// พนักงานตั้ง PIN ของตัวเองได้โดยยืนยันรหัสผ่าน ส่วนการตั้งให้คนอื่นต้องมีสิทธิ์ employees:write
+func SetEmployeePin(db *gorm.DB, c *fiber.Ctx) error {
+	var employee Models.Employees
+	if err := db.Where("employee_id = ?", c.Params("id")).First(&employee).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Employee not found",
+		})
+	}
+
+	var req struct {
+		Pin      string `json:"pin"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	user := Middleware.CurrentUser(c)
+	if user.EmployeeID == employee.EmployeeID {
+		if bcrypt.CompareHashAndPassword([]byte(employee.Password), []byte(req.Password)) != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid password",
+			})
+		}
+	} else {
+		if !Middleware.HasPermission(user.Role, Middleware.PermEmployeesWrite) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":      "Missing permission: " + string(Middleware.PermEmployeesWrite),
+				"permission": Middleware.PermEmployeesWrite,
+			})
+		}
+		if !canAccessBranch(c, branchValue(employee.BranchID)) {
+			return branchForbidden(c)
+		}
+		if !canManageEmployee(c, employee.Role, "") {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have permission to update a Super Admin.",
+			})
+		}
+	}
+
+	if !pinPattern.MatchString(req.Pin) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "PIN must be 4-6 digits",
+		})
+	}
+	hashedPin, err := bcrypt.GenerateFromPassword([]byte(req.Pin), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error hashing PIN: " + err.Error(),
+		})
+	}
+	if err := db.Model(&employee).Update("pin_hash", string(hashedPin)).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update PIN: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+}
+
+// DeviceAuthHandler ให้เครื่อง POS ยืนยันตัวด้วย deviceid + secret และรับ device token
+func DeviceAuthHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			DeviceID string `json:"deviceid"`
+			Secret   string `json:"secret"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.DeviceID == "" || body.Secret == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "deviceid and secret are required",
+			})
+		}
+
+		var device Models.PosDevices
+		if err := db.Where("device_id = ? AND status = ?", body.DeviceID, "active").First(&device).Error; err != nil ||
+			subtle.ConstantTimeCompare([]byte(device.SecretHash), []byte(hashRefreshToken(body.Secret))) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid device credentials",
+			})
+		}
+
+		token, err := signDeviceToken(device)
+		if err != nil {
+			log.Println("Error signing device token: ", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not generate token",
+			})
+		}
+		now := time.Now()
+		db.Model(&device).Update("last_seen_at", now)
+
+		return c.JSON(fiber.Map{
+			"devicetoken": token,
+			"branchid":    device.BranchID,
+			"expiresin":   int(deviceTokenTTL.Seconds()),
+		})
+	}
+}
+
+// PinLoginHandler login ด้วย PIN ที่เครื่อง POS ที่ลงทะเบียนแล้ว (ส่ง device token ใน header X-Device-Token)
+// พนักงานต้องอยู่สาขาเดียวกับเครื่อง และ token ที่ได้ผูกกับเครื่องและสาขานั้น
+// การใส่ PIN ผิดนับแยกจาก LoginHandler ด้วย guard ของ PIN
+func PinLoginHandler(db *gorm.DB, guard *Security.Guard) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		deviceID, ok := parseDeviceToken(c.Get(deviceTokenHeader))
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired device token",
+			})
+		}
+		var device Models.PosDevices
+		if err := db.Where("device_id = ? AND status = ?", deviceID, "active").First(&device).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Device is not active",
+			})
+		}
+
+		var body struct {
+			EmployeeID string `json:"employeeid"`
+			Pin        string `json:"pin"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.EmployeeID == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "employeeid and pin are required",
+			})
+		}
+
+		audit := func(email string, employeeID *string, result string) {
+			saveLoginAudit(db, c, Models.LoginAudits{
+				Email:      email,
+				EmployeeID: employeeID,
+				Method:     "pin",
+				DeviceID:   &device.DeviceID,
+				Result:     result,
+			})
+		}
+
+		decision, err := guard.Check(body.EmployeeID, c.IP())
+		if err != nil {
+			log.Println("Error checking PIN attempts: ", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not verify login attempts",
+			})
+		}
+		if !decision.Allowed {
+			result := "throttled"
+			if decision.Locked {
+				result = "locked"
+			}
+			audit("", nil, result)
+			return tooManyAttempts(c, decision)
+		}
+
+		invalidPin := func(email string, employeeID *string) error {
+			if _, err := guard.Failure(body.EmployeeID, c.IP()); err != nil {
+				log.Println("Error recording failed PIN login: ", err)
+			}
+			audit(email, employeeID, "invalid_credentials")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid credentials",
+			})
+		}
+
+		// พนักงานต้องอยู่สาขาเดียวกับเครื่องและตั้ง PIN ไว้แล้ว
+		var employee Models.Employees
+		if err := db.Where("employee_id = ? AND branch_id = ?", body.EmployeeID, device.BranchID).First(&employee).Error; err != nil {
+			return invalidPin("", nil)
+		}
+		if employee.PinHash == "" || bcrypt.CompareHashAndPassword([]byte(employee.PinHash), []byte(body.Pin)) != nil {
+			return invalidPin(employee.Email, &employee.EmployeeID)
+		}
+
+		token, err := signTerminalAccessToken(employee, device)
+		if err != nil {
+			log.Println("Error signing terminal token: ", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not generate token",
+			})
+		}
+		if err := guard.Success(body.EmployeeID); err != nil {
+			log.Println("Error resetting PIN attempts: ", err)
+		}
+		audit(employee.Email, &employee.EmployeeID, "success")
+
+		return c.JSON(fiber.Map{
+			"token":     token,
+			"expiresin": int(terminalTokenTTL.Seconds()),
+		})
+	}
+}
+
+// Route สำหรับเครื่อง POS และ PIN ของพนักงาน
+func DeviceRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/devices", func(c *fiber.Ctx) error {
+		return LookDevices(db, c)
+	})
+	app.Post("/devices", func(c *fiber.Ctx) error {
+		return AddDevice(db, c)
+	})
+	app.Delete("/devices/:id", func(c *fiber.Ctx) error {
+		return DisableDevice(db, c)
+	})
+	app.Put("/employees/:id/pin", func(c *fiber.Ctx) error {
+		return SetEmployeePin(db, c)
+	})
+}
@@ -10,6 +10,15 @@ import (
 	"gorm.io/gorm"
 )
 
+// ตรวจสอบว่าผู้ใช้ปัจจุบันจัดการพนักงานที่มี role นี้ได้หรือไม่
+// เฉพาะ Super Admin เท่านั้นที่แก้ไข/ลบ Super Admin หรือตั้ง role เป็น Super Admin ได้
+func canManageEmployee(c *fiber.Ctx, currentRole string, newRole string) bool {
+	if claimString(c, "role") == "Super Admin" {
+		return true
+	}
+	return currentRole != "Super Admin" && newRole != "Super Admin"
+}
+
 // เพิ่ม Employee
 func AddEmployees(db *gorm.DB, c *fiber.Ctx) error {
 	var req Models.Employees
@@ -21,10 +30,8 @@ func AddEmployees(db *gorm.DB, c *fiber.Ctx) error {
 
 	// ตรวจสอบว่า Role เป็น Super Admin หรือไม่
 	if req.Role == "Super Admin" {
-		// ตรวจสอบว่า user ที่ทำการเพิ่มสามารถเพิ่ม Super Admin ได้
-		// คุณอาจจะเพิ่มเงื่อนไขว่าเฉพาะ Super Admin สามารถเพิ่ม Super Admin ได้
-		userRole := "Super Admin" // ตัวอย่างนี้สามารถแทนที่ด้วยการตรวจสอบ Role ของผู้ใช้ใน session หรือ token
-		if userRole != "Super Admin" {
+		// เฉพาะ Super Admin เท่านั้นที่เพิ่ม Super Admin ได้
+		if claimString(c, "role") != "Super Admin" {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "Only Super Admin can add Super Admin.",
 			})
@@ -32,6 +39,16 @@ func AddEmployees(db *gorm.DB, c *fiber.Ctx) error {
 
 		// ตั้งค่า BranchID เป็น NULL หรือค่า default สำหรับ Super Admin
 		req.BranchID = nil // หรือ "" ถ้าใช้ string
+	} else {
+		// พนักงานใหม่อยู่สาขาเดียวกับผู้เพิ่ม (Super Admin เลือกสาขาได้)
+		branchID, ok := writeBranch(c, branchValue(req.BranchID))
+		if !ok {
+			return branchForbidden(c)
+		}
+		req.BranchID = nil
+		if branchID != "" {
+			req.BranchID = &branchID
+		}
 	}
 
 	// แฮชรหัสผ่าน
@@ -57,7 +74,7 @@ func AddEmployees(db *gorm.DB, c *fiber.Ctx) error {
 // ดู Employees ทั้งหมด
 func LookEmployees(db *gorm.DB, c *fiber.Ctx) error {
 	var employees []Models.Employees
-	if err := db.Find(&employees).Error; err != nil {
+	if err := scopeBranch(c, db, "branch_id").Find(&employees).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to find employees: " + err.Error(),
 		})
@@ -74,6 +91,9 @@ func FindEmployee(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Employee not found",
 		})
 	}
+	if !canAccessBranch(c, branchValue(employee.BranchID)) {
+		return branchForbidden(c)
+	}
 	return c.JSON(fiber.Map{"Data": employee})
 }
 
@@ -86,13 +106,8 @@ func UpdateEmployee(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Employee not found",
 		})
 	}
-
-	// ตรวจสอบสิทธิ์การอัปเดต
-	userRole := "Super Admin" // ตัวอย่างนี้สามารถแทนที่ด้วยการตรวจสอบ Role ของผู้ใช้ใน session หรือ token
-	if employee.Role == "Super Admin" && userRole != "Super Admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "You do not have permission to update a Super Admin.",
-		})
+	if !canAccessBranch(c, branchValue(employee.BranchID)) {
+		return branchForbidden(c)
 	}
 
 	var req Models.Employees
@@ -102,11 +117,25 @@ func UpdateEmployee(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	// ตรวจสอบสิทธิ์การอัปเดต
+	if req.BranchID != nil && !canAccessBranch(c, *req.BranchID) {
+		return branchForbidden(c)
+	}
+	if !canManageEmployee(c, employee.Role, req.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You do not have permission to update a Super Admin.",
+		})
+	}
+
+	previous := employee
 	employee.Email = req.Email
 	employee.Name = req.Name
 	employee.Role = req.Role
 	employee.BranchID = req.BranchID
 
+	// เปลี่ยน role, สาขา หรือรหัสผ่าน ต้องยกเลิก token เดิมของพนักงาน
+	revokeTokens := employee.Role != previous.Role || branchValue(employee.BranchID) != branchValue(previous.BranchID) || req.Password != ""
+
 	// แฮชรหัสผ่านใหม่ถ้ามีการเปลี่ยนแปลง
 	if req.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -118,11 +147,18 @@ func UpdateEmployee(db *gorm.DB, c *fiber.Ctx) error {
 		employee.Password = string(hashedPassword)
 	}
 
-	if err := db.Save(&employee).Error; err != nil {
+	if err := db.Model(&employee).Select("email", "name", "role", "branch_id", "password").Updates(&employee).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update employee: " + err.Error(),
 		})
 	}
+	if revokeTokens {
+		if err := invalidateEmployeeTokens(db, employee.EmployeeID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to revoke employee tokens: " + err.Error(),
+			})
+		}
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
 }
 
@@ -135,11 +171,26 @@ func DeleteEmployee(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Employee not found",
 		})
 	}
+	if !canAccessBranch(c, branchValue(employee.BranchID)) {
+		return branchForbidden(c)
+	}
+	if !canManageEmployee(c, employee.Role, "") {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You do not have permission to delete a Super Admin.",
+		})
+	}
 	if err := db.Delete(&employee).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete employee: " + err.Error(),
 		})
 	}
+
+	// ยกเลิก refresh token ที่ยังเหลืออยู่ (access token ใช้ไม่ได้ทันทีเพราะไม่พบพนักงาน)
+	if err := invalidateEmployeeTokens(db, employee.EmployeeID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke employee tokens: " + err.Error(),
+		})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Deleted": "Succeed"})
 }
 
@@ -151,6 +202,9 @@ func PatchEmployee(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Employee not found",
 		})
 	}
+	if !canAccessBranch(c, branchValue(employee.BranchID)) {
+		return branchForbidden(c)
+	}
 
 	var req Models.Employees
 	if err := c.BodyParser(&req); err != nil {
@@ -159,7 +213,17 @@ func PatchEmployee(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	if req.BranchID != nil && !canAccessBranch(c, *req.BranchID) {
+		return branchForbidden(c)
+	}
+	if !canManageEmployee(c, employee.Role, req.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You do not have permission to update a Super Admin.",
+		})
+	}
+
 	// อัปเดตเฉพาะข้อมูลที่มีการส่งมาใน request
+	previous := employee
 	if req.Email != "" {
 		employee.Email = req.Email
 	}
@@ -173,6 +237,9 @@ func PatchEmployee(db *gorm.DB, c *fiber.Ctx) error {
 		employee.BranchID = req.BranchID
 	}
 
+	// เปลี่ยน role, สาขา หรือรหัสผ่าน ต้องยกเลิก token เดิมของพนักงาน
+	revokeTokens := employee.Role != previous.Role || branchValue(employee.BranchID) != branchValue(previous.BranchID) || req.Password != ""
+
 	// แฮชรหัสผ่านใหม่ถ้ามีการเปลี่ยนแปลง
 	if req.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -184,11 +251,18 @@ func PatchEmployee(db *gorm.DB, c *fiber.Ctx) error {
 		employee.Password = string(hashedPassword)
 	}
 
-	if err := db.Save(&employee).Error; err != nil {
+	if err := db.Model(&employee).Select("email", "name", "role", "branch_id", "password").Updates(&employee).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update employee: " + err.Error(),
 		})
 	}
+	if revokeTokens {
+		if err := invalidateEmployeeTokens(db, employee.EmployeeID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to revoke employee tokens: " + err.Error(),
+			})
+		}
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
 }
 
@@ -0,0 +1,187 @@
+package Database
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Migrations"
+	"github.com/posproject/Models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// การทดสอบที่ต้องใช้ Postgres อ่าน DSN จาก TEST_DATABASE_URL เช่น
+// TEST_DATABASE_URL="host=localhost user=pos password=pos dbname=pos_test sslmode=disable" go test ./Database
+// ถ้าไม่ได้ตั้งค่าจะข้ามการทดสอบเหล่านี้ ข้อมูลทดสอบใช้รหัสสุ่มจึงรันซ้ำบนฐานข้อมูลเดิมได้
+
+const testJWTSecret = "posproject-test-secret"
+
+var (
+	testDBOnce sync.Once
+	testDBConn *gorm.DB
+	testDBErr  error
+)
+
+// เชื่อมต่อฐานข้อมูลทดสอบและ migrate ครั้งเดียวต่อการรัน
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	testDBOnce.Do(func() {
+		testDBConn, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr == nil {
+			testDBErr = Migrations.Migrate(testDBConn)
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("test database: %v", testDBErr)
+	}
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	return testDBConn
+}
+
+// รหัสสุ่มสั้น ๆ ไม่ให้ข้อมูลทดสอบชนกับข้อมูลที่มีอยู่
+func testCode() string {
+	return strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:6])
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
+
+func createTestBranch(t *testing.T, db *gorm.DB) Models.Branches {
+	t.Helper()
+	code := testCode()
+	branch := Models.Branches{
+		BName:          "Test " + code,
+		Location:       "Test",
+		GoogleLocation: "0, 0",
+		BranchCode:     "T" + code,
+	}
+	mustCreate(t, db, &branch)
+	return branch
+}
+
+func createTestEmployee(t *testing.T, db *gorm.DB, role string, branchID *string) Models.Employees {
+	t.Helper()
+	code := testCode()
+	employee := Models.Employees{
+		Email:    strings.ToLower("t" + code + "@test.io"),
+		Password: "-",
+		Name:     role + " " + code,
+		Role:     role,
+		BranchID: branchID,
+	}
+	mustCreate(t, db, &employee)
+	return employee
+}
+
+// access token ของพนักงาน (ผ่าน tokenActive เพราะ token version ตรงกับในฐานข้อมูล)
+func testToken(t *testing.T, employee Models.Employees) string {
+	t.Helper()
+	token, err := signClaims(accessClaims(employee, employee.BranchID, time.Minute))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func openTestShift(t *testing.T, db *gorm.DB, employee Models.Employees) Models.Shifts {
+	t.Helper()
+	shift := Models.Shifts{
+		ShiftID:    uuid.New().String(),
+		BranchID:   branchValue(employee.BranchID),
+		EmployeeID: employee.EmployeeID,
+		Status:     "open",
+		OpenedAt:   time.Now(),
+	}
+	mustCreate(t, db, &shift)
+	return shift
+}
+
+func createTestProduct(t *testing.T, db *gorm.DB, price float64) Models.Product {
+	t.Helper()
+	code := testCode()
+	category := Models.Category{
+		CategoryID:   uuid.New().String(),
+		CategoryName: "Test " + code,
+		CategoryCode: code[:4],
+		TaxMode:      "inclusive",
+		TaxRate:      7,
+	}
+	mustCreate(t, db, &category)
+	product := Models.Product{
+		ProductID:   uuid.New().String(),
+		ProductCode: "TEST-" + code,
+		ProductName: "Test " + code,
+		Description: "Test product",
+		Price:       price,
+		CategoryID:  category.CategoryID,
+	}
+	mustCreate(t, db, &product)
+	return product
+}
+
+// สร้าง Inventory พร้อมยอดยกมาใน StockMovements ให้ ledger ตรงกับจำนวน
+func createTestInventory(t *testing.T, db *gorm.DB, branchID string, productID string, quantity int) Models.Inventory {
+	t.Helper()
+	inventory, err := incrementInventory(db, branchID, productID, quantity, stockRef{
+		Type:          "opening_balance",
+		ReferenceType: "inventory",
+		Note:          "Test fixture",
+	})
+	if err != nil {
+		t.Fatalf("create inventory: %v", err)
+	}
+	return inventory
+}
+
+// ส่ง request ผ่าน Fiber app คืน status และ body
+func doRequest(app *fiber.App, method string, path string, token string, body interface{}) (int, string, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, "", err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), err
+}
+
+// ผลรวมของ StockMovements ของ Inventory
+func ledgerTotal(t *testing.T, db *gorm.DB, inventoryID string) int {
+	t.Helper()
+	var total struct{ Quantity int }
+	if err := db.Model(&Models.StockMovements{}).Select("COALESCE(SUM(quantity), 0) AS quantity").
+		Where("inventory_id = ?", inventoryID).Scan(&total).Error; err != nil {
+		t.Fatalf("ledger total: %v", err)
+	}
+	return total.Quantity
+}
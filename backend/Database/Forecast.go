@@ -0,0 +1,146 @@
+package Database
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Forecast"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// InventoryForecast ผลพยากรณ์ของ Inventory หนึ่งรายการ
+type InventoryForecast struct {
+	InventoryID string `json:"inventoryid"`
+	BranchID    string `json:"branchid"`
+	ProductID   string `json:"productid"`
+	Quantity    int    `json:"quantity"`
+	Incoming    int    `json:"incoming"`
+	Forecast.Result
+}
+
+// อ่านจำนวนวันจาก environment variable ถ้าไม่ได้ตั้งหรือไม่ถูกต้องใช้ค่า fallback
+func envDays(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		log.Printf("Invalid %s %q, using %d", name, value, fallback)
+		return fallback
+	}
+	return days
+}
+
+// การตั้งค่าการพยากรณ์ lead time และรอบการสั่งตั้งได้ด้วย FORECAST_LEAD_TIME_DAYS และ FORECAST_REVIEW_DAYS
+func forecastOptions() Forecast.Options {
+	opts := Forecast.DefaultOptions
+	opts.LeadTimeDays = envDays("FORECAST_LEAD_TIME_DAYS", opts.LeadTimeDays)
+	opts.ReviewDays = envDays("FORECAST_REVIEW_DAYS", opts.ReviewDays)
+	return opts
+}
+
+// ยอดขายรายวันของสินค้าในสาขา ตั้งแต่ from ถึงก่อน to (ไม่นับการขายที่ void)
+func loadDemandHistory(db *gorm.DB, branchID string, from time.Time, to time.Time) (map[string][]Forecast.DailyDemand, error) {
+	var rows []struct {
+		ProductID string
+		Day       time.Time
+		Quantity  float64
+	}
+	err := db.Table(`"SaleItems" AS si`).
+		Select("si.product_id, DATE(s.created_at) AS day, SUM(si.quantity) AS quantity").
+		Joins(`JOIN "Sales" AS s ON s.sale_id = si.sale_id`).
+		Where("s.branch_id = ? AND s.status <> ?", branchID, "voided").
+		Where("s.created_at >= ? AND s.created_at < ?", from, to).
+		Group("si.product_id, DATE(s.created_at)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	history := make(map[string][]Forecast.DailyDemand)
+	for _, row := range rows {
+		history[row.ProductID] = append(history[row.ProductID], Forecast.DailyDemand{Date: row.Day, Quantity: row.Quantity})
+	}
+	return history, nil
+}
+
+// พยากรณ์ Inventory ที่ส่งมา (ต้องเป็นของสาขาเดียวกัน) ณ เวลา asOf
+func forecastInventories(db *gorm.DB, branchID string, inventories []Models.Inventory, asOf time.Time, opts Forecast.Options) ([]InventoryForecast, error) {
+	forecasts := []InventoryForecast{}
+	if len(inventories) == 0 {
+		return forecasts, nil
+	}
+	today := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, asOf.Location())
+	history, err := loadDemandHistory(db, branchID, today.AddDate(0, 0, -opts.HistoryDays()), today)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err := incomingStock(db, branchID)
+	if err != nil {
+		return nil, err
+	}
+	for _, inventory := range inventories {
+		forecasts = append(forecasts, InventoryForecast{
+			InventoryID: inventory.InventoryID,
+			BranchID:    inventory.BranchID,
+			ProductID:   inventory.ProductID,
+			Quantity:    inventory.Quantity,
+			Incoming:    incoming[inventory.ProductID],
+			Result:      Forecast.Evaluate(history[inventory.ProductID], inventory.Quantity, incoming[inventory.ProductID], asOf, opts),
+		})
+	}
+	return forecasts, nil
+}
+
+// ดูยอดขายเฉลี่ย จำนวนวันที่ stock พอขาย วันที่คาดว่าจะหมด และจำนวนที่ควรสั่งของ Inventory
+// กรองด้วย ?productid= และกำหนดวันที่คำนวณด้วย ?asof= (YYYY-MM-DD) ได้
+func LookInventoryForecast(db *gorm.DB, c *fiber.Ctx) error {
+	asOf := time.Now()
+	if value := c.Query("asof"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "asof must be in YYYY-MM-DD format",
+			})
+		}
+		asOf = parsed
+	}
+
+	var branches []Models.Branches
+	if err := scopeBranch(c, db.Select("branch_id"), "branch_id").Find(&branches).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find branches: " + err.Error(),
+		})
+	}
+
+	opts := forecastOptions()
+	forecasts := []InventoryForecast{}
+	for _, branch := range branches {
+		query := db.Where("branch_id = ?", branch.BranchID)
+		if productID := c.Query("productid"); productID != "" {
+			query = query.Where("product_id = ?", productID)
+		}
+		var inventories []Models.Inventory
+		if err := query.Find(&inventories).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to find inventory: " + err.Error(),
+			})
+		}
+		branchForecasts, err := forecastInventories(db, branch.BranchID, inventories, asOf, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to forecast inventory: " + err.Error(),
+			})
+		}
+		forecasts = append(forecasts, branchForecasts...)
+	}
+	return c.JSON(fiber.Map{
+		"Data":    forecasts,
+		"AsOf":    asOf.Format("2006-01-02"),
+		"Options": opts,
+	})
+}
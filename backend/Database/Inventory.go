@@ -1,14 +1,92 @@
 package Database
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
 	"github.com/posproject/Models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrInventoryNotFound = errors.New("inventory not found")
+	ErrInsufficientStock = errors.New("not enough stock")
+)
+
+// ลดจำนวนสินค้าใน Inventory ของสาขาแบบ atomic และบันทึก StockMovements
+// lock แถวด้วย SELECT ... FOR UPDATE และใช้ UPDATE แบบมีเงื่อนไข quantity >= ? ซ้ำอีกชั้น
+// ทำให้การขาย/โอนสินค้าพร้อมกันไม่สามารถทำให้ stock ติดลบได้
+func decrementInventory(tx *gorm.DB, branchID string, productID string, quantity int, ref stockRef) (Models.Inventory, error) {
+	var inventory Models.Inventory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("branch_id = ? AND product_id = ?", branchID, productID).
+		First(&inventory).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return inventory, ErrInventoryNotFound
+		}
+		return inventory, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&Models.Inventory{}).
+		Where("inventory_id = ? AND quantity >= ?", inventory.InventoryID, quantity).
+		Updates(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity - ?", quantity),
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return inventory, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return inventory, ErrInsufficientStock
+	}
+
+	inventory.Quantity -= quantity
+	inventory.UpdatedAt = now
+	return inventory, recordStockMovement(tx, inventory, -quantity, ref)
+}
+
+// เพิ่มจำนวนสินค้าใน Inventory ของสาขาแบบ atomic และบันทึก StockMovements ถ้ายังไม่มีแถวของสินค้านี้จะสร้างใหม่
+// สร้างแถวด้วย INSERT ... ON CONFLICT DO NOTHING แล้วจึง lock แถว ทำให้การรับสินค้าพร้อมกันไม่สร้างแถวซ้ำ
+func incrementInventory(tx *gorm.DB, branchID string, productID string, quantity int, ref stockRef) (Models.Inventory, error) {
+	now := time.Now()
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "branch_id"}, {Name: "product_id"}},
+		DoNothing: true,
+	}).Create(&Models.Inventory{
+		InventoryID: uuid.New().String(),
+		BranchID:    branchID,
+		ProductID:   productID,
+		UpdatedAt:   now,
+	}).Error; err != nil {
+		return Models.Inventory{}, err
+	}
+
+	var inventory Models.Inventory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("branch_id = ? AND product_id = ?", branchID, productID).
+		First(&inventory).Error; err != nil {
+		return inventory, err
+	}
+
+	if err := tx.Model(&Models.Inventory{}).
+		Where("inventory_id = ?", inventory.InventoryID).
+		Updates(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity + ?", quantity),
+			"updated_at": now,
+		}).Error; err != nil {
+		return inventory, err
+	}
+
+	inventory.Quantity += quantity
+	inventory.UpdatedAt = now
+	return inventory, recordStockMovement(tx, inventory, quantity, ref)
+}
+
 // เพิ่ม Inventory
 func AddInventory(db *gorm.DB, c *fiber.Ctx) error {
 	var req Models.Inventory
@@ -18,21 +96,81 @@ func AddInventory(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	branchID, ok := writeBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	req.BranchID = branchID
+	if msg := validateStockLevels(req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if req.Quantity < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must not be negative",
+		})
+	}
+	var product Models.Product
+	if err := db.Where("product_id = ?", req.ProductID).First(&product).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	}
+	var existing int64
+	if err := db.Model(&Models.Inventory{}).Where("branch_id = ? AND product_id = ?", req.BranchID, req.ProductID).Count(&existing).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check inventory: " + err.Error(),
+		})
+	}
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Inventory for this product already exists in the branch",
+		})
+	}
+
+	// สร้างแถวด้วยจำนวน 0 ยอดเริ่มต้นต้องผ่านการปรับ stock (found_stock) ซึ่งรออนุมัติเมื่อมูลค่าเกินเกณฑ์
+	opening := req.Quantity
 	req.InventoryID = uuid.New().String()
+	req.Quantity = 0
 	req.UpdatedAt = time.Now()
 
-	if err := db.Create(&req).Error; err != nil {
+	var adjustment *Models.StockAdjustments
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		if opening == 0 {
+			return nil
+		}
+		pending := newStockAdjustment(req, product, opening, "found_stock", "Opening stock", Middleware.CurrentUser(c).EmployeeID)
+		if err := submitStockAdjustment(tx, &pending); err != nil {
+			return err
+		}
+		adjustment = &pending
+		if pending.Status == "applied" {
+			req.Quantity = opening
+		}
+		return nil
+	})
+	if err != nil {
+		if isUniqueViolation(err, "idx_inventory_branch_product") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Inventory for this product already exists in the branch",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create inventory: " + err.Error(),
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req, "Adjustment": adjustment})
 }
 
 // ดู Inventory ทั้งหมด
 func LookInventory(db *gorm.DB, c *fiber.Ctx) error {
 	var inventory []Models.Inventory
-	if err := db.Find(&inventory).Error; err != nil {
+	if err := scopeBranch(c, db, "branch_id").Find(&inventory).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to find inventory: " + err.Error(),
 		})
@@ -49,6 +187,9 @@ func FindInventory(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Inventory not found",
 		})
 	}
+	if !canAccessBranch(c, inventory.BranchID) {
+		return branchForbidden(c)
+	}
 	return c.JSON(fiber.Map{"Data": inventory})
 }
 
@@ -61,6 +202,9 @@ func UpdateInventory(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Inventory not found",
 		})
 	}
+	if !canAccessBranch(c, inventory.BranchID) {
+		return branchForbidden(c)
+	}
 
 	var req Models.Inventory
 	if err := c.BodyParser(&req); err != nil {
@@ -69,12 +213,24 @@ func UpdateInventory(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
-	inventory.ProductID = req.ProductID
-	inventory.BranchID = req.BranchID
-	inventory.Quantity = req.Quantity
+	// สินค้าและสาขาของ Inventory เปลี่ยนไม่ได้ เพราะ StockMovements อ้างอิงแถวนี้อยู่
+	if (req.ProductID != "" && req.ProductID != inventory.ProductID) || (req.BranchID != "" && req.BranchID != inventory.BranchID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Product and branch of an inventory row cannot be changed",
+		})
+	}
+
+	// จำนวนสินค้าเปลี่ยนได้เฉพาะผ่านการปรับ stock ที่มีเหตุผล (POST /inventory/adjustments)
+	if req.Quantity != inventory.Quantity {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":    "Quantity cannot be changed directly, use POST /inventory/adjustments",
+			"quantity": inventory.Quantity,
+		})
+	}
+
 	inventory.UpdatedAt = time.Now()
 
-	if err := db.Save(&inventory).Error; err != nil {
+	if err := db.Model(&inventory).Select("updated_at").Updates(&inventory).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update inventory: " + err.Error(),
 		})
@@ -82,20 +238,51 @@ func UpdateInventory(db *gorm.DB, c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
 }
 
-// ลบ Inventory
+// ลบ Inventory ได้เฉพาะแถวที่จำนวนเป็น 0 และไม่มี StockMovements
+// (รายงาน drift เริ่มจาก Inventory ถ้าลบแถวที่มีประวัติ movement จะหลุดจากการตรวจ)
 func DeleteInventory(db *gorm.DB, c *fiber.Ctx) error {
 	id := c.Params("id")
-	var inventory Models.Inventory
-	if err := db.Where("inventory_id = ?", id).First(&inventory).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Inventory not found",
-		})
-	}
-	if err := db.Delete(&inventory).Error; err != nil {
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var inventory Models.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("inventory_id = ?", id).First(&inventory).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Inventory not found")
+			return nil
+		}
+		if !canAccessBranch(c, inventory.BranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if inventory.Quantity != 0 {
+			failure = fiber.NewError(fiber.StatusConflict, "Inventory still has stock; adjust it to zero before deleting")
+			return nil
+		}
+		var movements int64
+		if err := tx.Model(&Models.StockMovements{}).Where("inventory_id = ?", inventory.InventoryID).Count(&movements).Error; err != nil {
+			return err
+		}
+		if movements > 0 {
+			failure = fiber.NewError(fiber.StatusConflict, "Inventory has stock movements and cannot be deleted")
+			return nil
+		}
+		var pending int64
+		if err := tx.Model(&Models.StockAdjustments{}).Where("inventory_id = ? AND status = 'pending'", inventory.InventoryID).Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			failure = fiber.NewError(fiber.StatusConflict, "Inventory has pending stock adjustments and cannot be deleted")
+			return nil
+		}
+		return tx.Delete(&inventory).Error
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete inventory: " + err.Error(),
 		})
 	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Deleted": "Succeed"})
 }
 
@@ -104,15 +291,27 @@ func InventoryRoutes(app *fiber.App, db *gorm.DB) {
 	app.Get("/inventory", func(c *fiber.Ctx) error {
 		return LookInventory(db, c)
 	})
+	app.Get("/inventory/forecast", func(c *fiber.Ctx) error {
+		return LookInventoryForecast(db, c)
+	})
+	app.Get("/inventory/reconcile", func(c *fiber.Ctx) error {
+		return ReconcileInventory(db, c)
+	})
 	app.Get("/inventory/:id", func(c *fiber.Ctx) error {
 		return FindInventory(db, c)
 	})
+	app.Get("/inventory/:id/movements", func(c *fiber.Ctx) error {
+		return LookStockMovements(db, c)
+	})
 	app.Post("/inventory", func(c *fiber.Ctx) error {
 		return AddInventory(db, c)
 	})
 	app.Put("/inventory/:id", func(c *fiber.Ctx) error {
 		return UpdateInventory(db, c)
 	})
+	app.Put("/inventory/:id/levels", func(c *fiber.Ctx) error {
+		return UpdateStockLevels(db, c)
+	})
 	app.Delete("/inventory/:id", func(c *fiber.Ctx) error {
 		return DeleteInventory(db, c)
 	})
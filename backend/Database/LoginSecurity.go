@@ -0,0 +1,110 @@
+package Database
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Models"
+	"github.com/posproject/Security"
+	"gorm.io/gorm"
+)
+
+// ดูสถานะการล็อกของพนักงาน
+func LookEmployeeLockout(db *gorm.DB, guard *Security.Guard, c *fiber.Ctx) error {
+	id := c.Params("id")
+	var employee Models.Employees
+	if err := db.Where("employee_id = ?", id).First(&employee).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Employee not found",
+		})
+	}
+	if !canAccessBranch(c, branchValue(employee.BranchID)) {
+		return branchForbidden(c)
+	}
+
+	state, err := guard.Status(employee.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find login attempts: " + err.Error(),
+		})
+	}
+	data := fiber.Map{
+		"failures": state.Failures,
+		"locked":   !state.LockedUntil.IsZero() && guard.Now().Before(state.LockedUntil),
+	}
+	if !state.LockedUntil.IsZero() {
+		data["lockeduntil"] = state.LockedUntil
+	}
+	return c.JSON(fiber.Map{"Data": data})
+}
+
+// ปลดล็อกบัญชีพนักงานที่ถูกล็อกจากการ login ผิดหลายครั้ง (ทั้งรหัสผ่านและ PIN)
+func UnlockEmployee(db *gorm.DB, guard *Security.Guard, pinGuard *Security.Guard, c *fiber.Ctx) error {
+	id := c.Params("id")
+	var employee Models.Employees
+	if err := db.Where("employee_id = ?", id).First(&employee).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Employee not found",
+		})
+	}
+	if !canAccessBranch(c, branchValue(employee.BranchID)) {
+		return branchForbidden(c)
+	}
+	if !canManageEmployee(c, employee.Role, "") {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You do not have permission to unlock a Super Admin.",
+		})
+	}
+
+	err := guard.Unlock(employee.Email)
+	if err == nil {
+		err = pinGuard.Unlock(employee.EmployeeID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlock employee: " + err.Error(),
+		})
+	}
+	recordLoginAudit(db, c, employee.Email, &employee.EmployeeID, "unlocked")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+}
+
+// ดูประวัติการ login กรองด้วย ?email= ?result= และ ?limit= (ค่าเริ่มต้น 100 รายการล่าสุด)
+// role อื่นนอกจาก Super Admin เห็นเฉพาะประวัติของพนักงานในสาขาตัวเอง
+func LookLoginAudits(db *gorm.DB, c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be between 1 and 1000",
+		})
+	}
+
+	query := scopeBranchVia(c, db, db.Model(&Models.LoginAudits{}), "employee_id", &Models.Employees{}, "employee_id")
+	if email := c.Query("email"); email != "" {
+		query = query.Where("LOWER(email) = LOWER(?)", email)
+	}
+	if result := c.Query("result"); result != "" {
+		query = query.Where("result = ?", result)
+	}
+
+	var audits []Models.LoginAudits
+	if err := query.Order("created_at DESC").Limit(limit).Find(&audits).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find login audits: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": audits})
+}
+
+// Route สำหรับการล็อกบัญชีและประวัติการ login
+func LoginSecurityRoutes(app *fiber.App, db *gorm.DB, guard *Security.Guard, pinGuard *Security.Guard) {
+	app.Get("/employees/:id/lockout", func(c *fiber.Ctx) error {
+		return LookEmployeeLockout(db, guard, c)
+	})
+	app.Post("/employees/:id/unlock", func(c *fiber.Ctx) error {
+		return UnlockEmployee(db, guard, pinGuard, c)
+	})
+	app.Get("/loginaudits", func(c *fiber.Ctx) error {
+		return LookLoginAudits(db, c)
+	})
+}
@@ -0,0 +1,134 @@
+package Database
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// ช่องทางการชำระเงินที่รองรับ
+var paymentMethods = map[string]bool{
+	"cash":      true,
+	"card":      true,
+	"promptpay": true,
+	"voucher":   true,
+	"points":    true, // แลกแต้มสะสมของลูกค้า ต้องระบุลูกค้าในการขาย
+}
+
+// TenderRequest การชำระเงินหนึ่งช่องทางที่ส่งมากับ POST /sales
+type TenderRequest struct {
+	Method    string  `json:"method"`
+	Amount    float64 `json:"amount"` // ยอดที่ลูกค้าจ่ายด้วยช่องทางนี้ (เงินสดอาจมากกว่ายอดที่ต้องชำระ)
+	Reference string  `json:"reference"`
+}
+
+// แบ่งยอดที่ต้องชำระไปยังแต่ละช่องทางและคำนวณเงินทอน
+// ช่องทางที่ไม่ใช่เงินสดจะถูกตัดก่อนและห้ามเกินยอดคงเหลือ (ทอนเงินไม่ได้)
+// ส่วนที่เหลือชำระด้วยเงินสด และเงินทอนจะบันทึกไว้ที่รายการเงินสดรายการสุดท้าย
+func allocateTenders(total float64, tenders []TenderRequest) ([]Models.Payments, float64, error) {
+	if len(tenders) == 0 {
+		return nil, 0, fmt.Errorf("at least one payment is required")
+	}
+
+	payments := make([]Models.Payments, len(tenders))
+	remaining := roundMoney(total)
+	var cashTendered float64
+	lastCash := -1
+
+	for i, tender := range tenders {
+		if !paymentMethods[tender.Method] {
+			return nil, 0, fmt.Errorf("unsupported payment method: %s", tender.Method)
+		}
+		amount := roundMoney(tender.Amount)
+		if amount <= 0 {
+			return nil, 0, fmt.Errorf("payment %d amount must be greater than zero", i)
+		}
+		payments[i] = Models.Payments{
+			Method:    tender.Method,
+			Tendered:  amount,
+			Reference: tender.Reference,
+		}
+		if tender.Method == "cash" {
+			cashTendered += amount
+			lastCash = i
+			continue
+		}
+		if amount > remaining+0.005 {
+			return nil, 0, fmt.Errorf("%s payment of %.2f exceeds amount due %.2f", tender.Method, amount, remaining)
+		}
+		payments[i].Amount = amount
+		remaining = roundMoney(remaining - amount)
+	}
+
+	if cashTendered+0.005 < remaining {
+		return nil, 0, fmt.Errorf("payments of %.2f do not cover total %.2f", roundMoney(total-remaining+cashTendered), total)
+	}
+
+	// กระจายยอดที่เหลือไปยังรายการเงินสดตามลำดับ
+	for i := range payments {
+		if payments[i].Method != "cash" {
+			continue
+		}
+		applied := payments[i].Tendered
+		if applied > remaining {
+			applied = remaining
+		}
+		payments[i].Amount = applied
+		remaining = roundMoney(remaining - applied)
+	}
+
+	change := roundMoney(cashTendered - sumCashApplied(payments))
+	if lastCash >= 0 {
+		payments[lastCash].Change = change
+	}
+	return payments, change, nil
+}
+
+func sumCashApplied(payments []Models.Payments) float64 {
+	var sum float64
+	for _, p := range payments {
+		if p.Method == "cash" {
+			sum += p.Amount
+		}
+	}
+	return roundMoney(sum)
+}
+
+// ดึงรายการชำระเงินของการขายมาใส่ในใบเสร็จ
+func attachPayments(db *gorm.DB, receipt *Models.Receipts) error {
+	var payments []Models.Payments
+	if err := db.Where("sale_id = ?", receipt.SaleID).Order("created_at").Find(&payments).Error; err != nil {
+		return err
+	}
+	receipt.Payments = payments
+	receipt.ChangeDue = 0
+	for _, p := range payments {
+		receipt.ChangeDue += p.Change
+	}
+	receipt.ChangeDue = roundMoney(receipt.ChangeDue)
+	return nil
+}
+
+// ดูการชำระเงินของการขาย
+func LookSalePayments(db *gorm.DB, c *fiber.Ctx) error {
+	if !canAccessBranch(c, saleBranch(db, c.Params("id"))) {
+		return branchForbidden(c)
+	}
+
+	var payments []Models.Payments
+	if err := db.Where("sale_id = ?", c.Params("id")).Order("created_at").Find(&payments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find payments: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": payments})
+}
+
+// Route สำหรับ Payments
+func PaymentRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/sales/:id/payments", func(c *fiber.Ctx) error {
+		return LookSalePayments(db, c)
+	})
+}
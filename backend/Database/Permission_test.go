@@ -0,0 +1,169 @@
+package Database
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Security"
+)
+
+// Fiber app ที่ลงทะเบียน route เหมือน main.go หลัง IsAuthenticated
+func testApp(t *testing.T) *fiber.App {
+	t.Helper()
+	db := testDB(t)
+	app := fiber.New()
+	app.Use(Middleware.IsAuthenticated(db))
+	BranchRoutes(app, db)
+	EmployeesRoutes(app, db)
+	LoginSecurityRoutes(app, db, Security.NewGuard(Security.NewMemoryStore(), Security.DefaultPolicy), Security.NewGuard(Security.NewMemoryStore(), Security.PinPolicy))
+	DeviceRoutes(app, db)
+	ProductRoutes(app, db)
+	StockAdjustmentRoutes(app, db)
+	InventoryRoutes(app, db)
+	StocktakeRoutes(app, db)
+	SaleRoutes(app, db)
+	ShiftRoutes(app, db)
+	RefundRoutes(app, db)
+	PaymentRoutes(app, db)
+	SaleItemRoutes(app, db)
+	ReceiptRoutes(app, db)
+	ReceiptItemRoutes(app, db)
+	TaxInvoiceRoutes(app, db)
+	ReceiptPrintRoutes(app, db)
+	RequestRoutes(app, db)
+	ShipmentRoutes(app, db)
+	ReplenishmentRoutes(app, db)
+	CategoryRoutes(app, db)
+	PromotionRoutes(app, db)
+	ReportRoutes(app, db)
+	AuditRoutes(app, db)
+	CustomerRoutes(app, db)
+	return app
+}
+
+// ตารางสิทธิ์ (role, method, path) -> status ที่คาดหวัง ผ่าน IsAuthenticated และ handler จริง
+// permission ระบุเมื่อ 403 ต้องมาจากตารางสิทธิ์ของ route (ไม่ใช่การตรวจใน handler)
+func TestRoutePermissions(t *testing.T) {
+	app := testApp(t)
+	db := testDB(t)
+
+	branch := createTestBranch(t, db)
+	otherBranch := createTestBranch(t, db)
+	superAdmin := createTestEmployee(t, db, "Super Admin", nil)
+	manager := createTestEmployee(t, db, "Manager", &branch.BranchID)
+	cashier := createTestEmployee(t, db, "Cashier", &branch.BranchID)
+	auditor := createTestEmployee(t, db, "Audit", &branch.BranchID)
+	otherCashier := createTestEmployee(t, db, "Cashier", &otherBranch.BranchID)
+	targetAdmin := createTestEmployee(t, db, "Super Admin", nil)
+	removableAdmin := createTestEmployee(t, db, "Super Admin", nil)
+
+	tokens := map[string]string{
+		"Super Admin": testToken(t, superAdmin),
+		"Manager":     testToken(t, manager),
+		"Cashier":     testToken(t, cashier),
+		"Audit":       testToken(t, auditor),
+	}
+
+	// token ที่ token version ไม่ตรงกับพนักงาน (เช่นหลังเปลี่ยนรหัสผ่าน)
+	staleClaims := accessClaims(manager, manager.BranchID, time.Minute)
+	staleClaims["tv"] = manager.TokenVersion + 1
+	staleToken, err := signClaims(staleClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missingSale := uuid.New().String()
+	newAdmin := fiber.Map{"email": strings.ToLower("t" + testCode() + "@test.io"), "password": "secret", "name": "New Admin", "role": "Super Admin"}
+
+	cases := []struct {
+		name       string
+		role       string // ว่าง = ใช้ token
+		token      string
+		method     string
+		path       string
+		body       interface{}
+		want       int
+		permission Middleware.Permission
+	}{
+		// Authentication
+		{name: "no token", method: http.MethodGet, path: "/branches", want: fiber.StatusUnauthorized},
+		{name: "invalid token", token: "not-a-jwt", method: http.MethodGet, path: "/branches", want: fiber.StatusUnauthorized},
+		{name: "stale token version", token: staleToken, method: http.MethodGet, path: "/branches", want: fiber.StatusUnauthorized},
+
+		// Branches: Manager อ่านได้แต่จัดการสาขาไม่ได้
+		{role: "Manager", method: http.MethodGet, path: "/branches", want: fiber.StatusOK},
+		{role: "Manager", method: http.MethodGet, path: "/branches/" + branch.BranchID, want: fiber.StatusOK},
+		{role: "Manager", method: http.MethodPost, path: "/branches", body: fiber.Map{"bname": "X", "location": "X", "google_location": "0, 0"}, want: fiber.StatusForbidden, permission: Middleware.PermBranchesWrite},
+		{role: "Manager", method: http.MethodPut, path: "/branches/" + branch.BranchID, body: fiber.Map{"bname": "X"}, want: fiber.StatusForbidden, permission: Middleware.PermBranchesWrite},
+		{role: "Manager", method: http.MethodDelete, path: "/branches/" + otherBranch.BranchID, want: fiber.StatusForbidden, permission: Middleware.PermBranchesWrite},
+		{role: "Manager", method: http.MethodPut, path: "/branches/" + branch.BranchID + "/receipttemplate", body: fiber.Map{"paperwidth": 99}, want: fiber.StatusBadRequest},
+		{role: "Cashier", method: http.MethodDelete, path: "/branches/" + otherBranch.BranchID, want: fiber.StatusForbidden, permission: Middleware.PermBranchesWrite},
+		{role: "Audit", method: http.MethodPost, path: "/branches", body: fiber.Map{}, want: fiber.StatusForbidden, permission: Middleware.PermBranchesWrite},
+		{role: "Super Admin", method: http.MethodPost, path: "/branches", body: fiber.Map{"bname": "X", "location": "X"}, want: fiber.StatusBadRequest},
+		{role: "Super Admin", method: http.MethodDelete, path: "/branches/" + uuid.New().String(), want: fiber.StatusNotFound},
+
+		// Employees: Manager จัดการพนักงานในสาขาได้ แต่แตะ Super Admin ไม่ได้
+		{role: "Manager", method: http.MethodGet, path: "/employees", want: fiber.StatusOK},
+		{role: "Cashier", method: http.MethodGet, path: "/employees", want: fiber.StatusForbidden, permission: Middleware.PermEmployeesRead},
+		{role: "Cashier", method: http.MethodPost, path: "/employees", body: fiber.Map{"role": "Cashier"}, want: fiber.StatusForbidden, permission: Middleware.PermEmployeesWrite},
+		{role: "Audit", method: http.MethodDelete, path: "/employees/" + cashier.EmployeeID, want: fiber.StatusForbidden, permission: Middleware.PermEmployeesWrite},
+		{role: "Manager", method: http.MethodPost, path: "/employees", body: newAdmin, want: fiber.StatusForbidden},
+		{role: "Manager", method: http.MethodPut, path: "/employees/" + targetAdmin.EmployeeID, body: fiber.Map{"name": "X", "role": "Super Admin"}, want: fiber.StatusForbidden},
+		{role: "Manager", method: http.MethodPatch, path: "/employees/" + targetAdmin.EmployeeID, body: fiber.Map{"name": "X"}, want: fiber.StatusForbidden},
+		{role: "Manager", method: http.MethodDelete, path: "/employees/" + targetAdmin.EmployeeID, want: fiber.StatusForbidden},
+		{role: "Manager", method: http.MethodPatch, path: "/employees/" + cashier.EmployeeID, body: fiber.Map{"role": "Super Admin"}, want: fiber.StatusForbidden},
+		{role: "Manager", method: http.MethodPatch, path: "/employees/" + otherCashier.EmployeeID, body: fiber.Map{"name": "X"}, want: fiber.StatusForbidden},
+		{role: "Manager", method: http.MethodPatch, path: "/employees/" + cashier.EmployeeID, body: fiber.Map{"name": "Renamed Cashier"}, want: fiber.StatusOK},
+		{role: "Super Admin", method: http.MethodPatch, path: "/employees/" + targetAdmin.EmployeeID, body: fiber.Map{"name": "Renamed Admin"}, want: fiber.StatusOK},
+		{role: "Super Admin", method: http.MethodDelete, path: "/employees/" + removableAdmin.EmployeeID, want: fiber.StatusOK},
+
+		// Catalog และ Inventory
+		{role: "Cashier", method: http.MethodGet, path: "/products", want: fiber.StatusOK},
+		{role: "Cashier", method: http.MethodPost, path: "/products", body: fiber.Map{}, want: fiber.StatusForbidden, permission: Middleware.PermCatalogWrite},
+		{role: "Audit", method: http.MethodDelete, path: "/products/" + uuid.New().String(), want: fiber.StatusForbidden, permission: Middleware.PermCatalogWrite},
+		{role: "Cashier", method: http.MethodPost, path: "/inventory/adjustments/" + uuid.New().String() + "/approve", want: fiber.StatusForbidden, permission: Middleware.PermInventoryApprove},
+
+		// Sales: ลบการขายได้เฉพาะ Super Admin, คืนเงินต้องมี sales:refund
+		{role: "Audit", method: http.MethodGet, path: "/sales", want: fiber.StatusOK},
+		{role: "Audit", method: http.MethodPost, path: "/sales", body: fiber.Map{}, want: fiber.StatusForbidden, permission: Middleware.PermSalesCreate},
+		{role: "Cashier", method: http.MethodPost, path: "/sales/" + missingSale + "/refunds", body: fiber.Map{}, want: fiber.StatusForbidden, permission: Middleware.PermSalesRefund},
+		{role: "Cashier", method: http.MethodDelete, path: "/sales/" + missingSale, want: fiber.StatusForbidden, permission: Middleware.PermSalesDelete},
+		{role: "Manager", method: http.MethodDelete, path: "/sales/" + missingSale, want: fiber.StatusForbidden, permission: Middleware.PermSalesDelete},
+		{role: "Super Admin", method: http.MethodDelete, path: "/sales/" + missingSale, want: fiber.StatusNotFound},
+		{role: "Cashier", method: http.MethodPut, path: "/saleitems/" + uuid.New().String(), body: fiber.Map{}, want: fiber.StatusForbidden, permission: Middleware.PermAll},
+
+		// Reports และ Audit
+		{role: "Cashier", method: http.MethodGet, path: "/reports/vat?month=2026-10", want: fiber.StatusForbidden, permission: Middleware.PermReportsRead},
+		{role: "Manager", method: http.MethodGet, path: "/reports/vat?month=2026-10", want: fiber.StatusOK},
+		{role: "Manager", method: http.MethodGet, path: "/audit?limit=1", want: fiber.StatusForbidden, permission: Middleware.PermAuditRead},
+		{role: "Audit", method: http.MethodGet, path: "/audit?limit=1", want: fiber.StatusOK},
+	}
+
+	for _, tc := range cases {
+		name := tc.name
+		if name == "" {
+			name = tc.role + " " + tc.method + " " + tc.path
+		}
+		t.Run(name, func(t *testing.T) {
+			token := tc.token
+			if tc.role != "" {
+				token = tokens[tc.role]
+			}
+			status, body, err := doRequest(app, tc.method, tc.path, token, tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tc.want {
+				t.Fatalf("status = %d, want %d: %s", status, tc.want, body)
+			}
+			if tc.permission != "" && !strings.Contains(body, "Missing permission: "+string(tc.permission)) {
+				t.Fatalf("response does not name missing permission %q: %s", tc.permission, body)
+			}
+		})
+	}
+}
@@ -20,6 +20,13 @@ func AddProduct(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	// ตรวจสอบการตั้งค่าภาษี (ว่าง = ใช้ค่าของ Category)
+	if err := validateTaxSettings(req.TaxMode, req.TaxRate); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// 🔍 ตรวจสอบ CategoryID และดึง categorycode จากฐานข้อมูล
 	var category Models.Category
 	if err := db.Where("category_id = ?", req.CategoryID).First(&category).Error; err != nil {
@@ -124,6 +131,12 @@ func UpdateProduct(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateTaxSettings(req.TaxMode, req.TaxRate); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// ✅ ตรวจสอบ CategoryID ใหม่ และดึง categorycode
 	var category Models.Category
 	if err := db.Where("category_id = ?", req.CategoryID).First(&category).Error; err != nil {
@@ -144,6 +157,8 @@ func UpdateProduct(db *gorm.DB, c *fiber.Ctx) error {
 	product.UnitsPerBox = req.UnitsPerBox
 	product.ImageURL = req.ImageURL
 	product.CategoryID = req.CategoryID
+	product.TaxMode = req.TaxMode
+	product.TaxRate = req.TaxRate
 
 	if err := db.Save(&product).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -0,0 +1,282 @@
+package Database
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// เพดานส่วนลดที่พนักงานให้เองได้ (% ของยอดก่อนลด) แยกตาม role
+var manualDiscountLimits = map[string]float64{
+	"Cashier":     5,
+	"Manager":     30,
+	"Super Admin": 100,
+}
+
+// ตรวจสอบข้อมูลโปรโมชันก่อนบันทึก
+func validatePromotion(p Models.Promotions) error {
+	if p.Name == "" {
+		return fmt.Errorf("promotion name is required")
+	}
+	switch p.Type {
+	case "percent":
+		if p.Value <= 0 || p.Value > 100 {
+			return fmt.Errorf("percent promotion value must be between 0 and 100")
+		}
+	case "amount":
+		if p.Value <= 0 {
+			return fmt.Errorf("amount promotion value must be greater than zero")
+		}
+	case "buy_x_get_y":
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return fmt.Errorf("buy_x_get_y promotion requires buyquantity and getquantity")
+		}
+	case "bundle":
+		if p.BuyQuantity < 2 || p.Value <= 0 {
+			return fmt.Errorf("bundle promotion requires buyquantity of at least 2 and a bundle price")
+		}
+	default:
+		return fmt.Errorf("invalid promotion type: %s", p.Type)
+	}
+	if p.Status != "" && p.Status != "active" && p.Status != "inactive" {
+		return fmt.Errorf("invalid promotion status: %s", p.Status)
+	}
+	if p.StartAt != nil && p.EndAt != nil && !p.EndAt.After(*p.StartAt) {
+		return fmt.Errorf("endat must be after startat")
+	}
+	return nil
+}
+
+// โหลดโปรโมชันที่ใช้ได้กับสาขาและเวลาที่ขาย เรียงตาม priority
+func loadActivePromotions(tx *gorm.DB, branchID string, at time.Time) ([]Models.Promotions, error) {
+	var promotions []Models.Promotions
+	err := tx.Where("status = ?", "active").
+		Where("branch_id IS NULL OR branch_id = ?", branchID).
+		Where("start_at IS NULL OR start_at <= ?", at).
+		Where("end_at IS NULL OR end_at > ?", at).
+		Order("priority DESC, created_at").
+		Find(&promotions).Error
+	return promotions, err
+}
+
+// โปรโมชันใช้กับสินค้านี้ได้หรือไม่ (ตามสินค้า/หมวดหมู่ที่กำหนด)
+func promotionApplies(p Models.Promotions, product Models.Product) bool {
+	if p.ProductID != nil && *p.ProductID != product.ProductID {
+		return false
+	}
+	if p.CategoryID != nil && *p.CategoryID != product.CategoryID {
+		return false
+	}
+	return true
+}
+
+// คำนวณส่วนลดของโปรโมชันจากจำนวนรวมของสินค้าในบิล (ไม่เกินยอดรวมของสินค้านั้น)
+func promotionDiscount(p Models.Promotions, unitPrice float64, quantity int) float64 {
+	amount := roundMoney(unitPrice * float64(quantity))
+	var discount float64
+	switch p.Type {
+	case "percent":
+		discount = amount * p.Value / 100
+	case "amount":
+		discount = p.Value * float64(quantity)
+	case "buy_x_get_y":
+		// ซื้อ X แถม Y: ทุก X+Y ชิ้น ได้ฟรี Y ชิ้น
+		free := quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+		discount = float64(free) * unitPrice
+	case "bundle":
+		// ราคาชุด: ทุก BuyQuantity ชิ้นจ่ายเพียง Value บาท
+		sets := quantity / p.BuyQuantity
+		discount = float64(sets) * (float64(p.BuyQuantity)*unitPrice - p.Value)
+	}
+	return roundMoney(math.Max(0, math.Min(discount, amount)))
+}
+
+// เลือกโปรโมชันที่ดีที่สุดของสินค้าในบิล (ไม่ซ้อนโปรโมชัน)
+// ใช้โปรโมชันที่ priority สูงสุดก่อน ถ้า priority เท่ากันเลือกโปรที่ลดได้มากที่สุด
+func bestPromotion(promotions []Models.Promotions, product Models.Product, quantity int) (*Models.Promotions, float64) {
+	var best *Models.Promotions
+	var bestDiscount float64
+	for i := range promotions {
+		p := &promotions[i]
+		if best != nil && p.Priority < best.Priority {
+			break
+		}
+		if !promotionApplies(*p, product) {
+			continue
+		}
+		if discount := promotionDiscount(*p, product.Price, quantity); discount > bestDiscount {
+			best, bestDiscount = p, discount
+		}
+	}
+	return best, bestDiscount
+}
+
+// สาขาของ Promotion ตาม token (Promotion ที่ไม่ระบุสาขาใช้ได้ทุกสาขา สร้างได้เฉพาะ Super Admin)
+func promotionBranch(c *fiber.Ctx, requested *string) (*string, bool) {
+	branchID, ok := writeBranch(c, branchValue(requested))
+	if !ok {
+		return nil, false
+	}
+	if branchID == "" {
+		return nil, Middleware.CurrentUser(c).AllBranches()
+	}
+	return &branchID, true
+}
+
+// สิทธิ์แก้ไข Promotion ที่มีอยู่ (Promotion ของทุกสาขาแก้ได้เฉพาะ Super Admin)
+func canManagePromotion(c *fiber.Ctx, promotion Models.Promotions) bool {
+	return canAccessBranch(c, branchValue(promotion.BranchID))
+}
+
+// เพิ่ม Promotion
+func AddPromotion(db *gorm.DB, c *fiber.Ctx) error {
+	var req Models.Promotions
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if err := validatePromotion(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	branchID, ok := promotionBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	req.BranchID = branchID
+
+	req.PromotionID = uuid.New().String()
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	req.CreatedAt = time.Now()
+
+	if err := db.Create(&req).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create promotion: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req})
+}
+
+// ดู Promotions ทั้งหมด (?active=true เฉพาะที่ใช้ได้ตอนนี้, ?branchid= กรองตามสาขา)
+func LookPromotions(db *gorm.DB, c *fiber.Ctx) error {
+	var promotions []Models.Promotions
+	var err error
+	if c.Query("active") == "true" {
+		promotions, err = loadActivePromotions(db, c.Query("branchid"), time.Now())
+	} else {
+		query := db.Order("priority DESC, created_at")
+		if branchID := c.Query("branchid"); branchID != "" {
+			query = query.Where("branch_id IS NULL OR branch_id = ?", branchID)
+		}
+		err = query.Find(&promotions).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find promotions: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": promotions})
+}
+
+// หา Promotion ตาม ID
+func FindPromotion(db *gorm.DB, c *fiber.Ctx) error {
+	var promotion Models.Promotions
+	if err := db.Where("promotion_id = ?", c.Params("id")).First(&promotion).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Promotion not found",
+		})
+	}
+	return c.JSON(fiber.Map{"Data": promotion})
+}
+
+// อัปเดต Promotion
+func UpdatePromotion(db *gorm.DB, c *fiber.Ctx) error {
+	var promotion Models.Promotions
+	if err := db.Where("promotion_id = ?", c.Params("id")).First(&promotion).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Promotion not found",
+		})
+	}
+	if !canManagePromotion(c, promotion) {
+		return branchForbidden(c)
+	}
+
+	var req Models.Promotions
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	branchID, ok := promotionBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	req.BranchID = branchID
+
+	req.PromotionID = promotion.PromotionID
+	req.CreatedAt = promotion.CreatedAt
+	if req.Status == "" {
+		req.Status = promotion.Status
+	}
+	if err := validatePromotion(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := db.Save(&req).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update promotion: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+}
+
+// ปิดใช้งาน Promotion (ไม่ลบจริงเพื่อให้ SaleItems ที่อ้างอิงยังดูรายงานได้)
+func DeletePromotion(db *gorm.DB, c *fiber.Ctx) error {
+	var promotion Models.Promotions
+	if err := db.Where("promotion_id = ?", c.Params("id")).First(&promotion).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Promotion not found",
+		})
+	}
+	if !canManagePromotion(c, promotion) {
+		return branchForbidden(c)
+	}
+	if err := db.Model(&promotion).Update("status", "inactive").Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete promotion: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Deleted": "Succeed"})
+}
+
+// Route สำหรับ Promotions
+func PromotionRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/promotions", func(c *fiber.Ctx) error {
+		return LookPromotions(db, c)
+	})
+	app.Get("/promotions/:id", func(c *fiber.Ctx) error {
+		return FindPromotion(db, c)
+	})
+	app.Post("/promotions", func(c *fiber.Ctx) error {
+		return AddPromotion(db, c)
+	})
+	app.Put("/promotions/:id", func(c *fiber.Ctx) error {
+		return UpdatePromotion(db, c)
+	})
+	app.Delete("/promotions/:id", func(c *fiber.Ctx) error {
+		return DeletePromotion(db, c)
+	})
+}
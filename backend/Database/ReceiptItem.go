@@ -2,34 +2,14 @@ package Database
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"github.com/posproject/Models"
 	"gorm.io/gorm"
 )
 
-// เพิ่ม ReceiptItem
-func AddReceiptItem(db *gorm.DB, c *fiber.Ctx) error {
-	var req Models.ReceiptItems
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid JSON format: " + err.Error(),
-		})
-	}
-
-	req.ReceiptItemID = uuid.New().String()
-
-	if err := db.Create(&req).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create receipt item: " + err.Error(),
-		})
-	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req})
-}
-
 // ดู ReceiptItems ทั้งหมด
 func LookReceiptItems(db *gorm.DB, c *fiber.Ctx) error {
 	var receiptItems []Models.ReceiptItems
-	if err := db.Find(&receiptItems).Error; err != nil {
+	if err := scopeBranchVia(c, db, db, "receipt_id", &Models.Receipts{}, "receipt_id").Find(&receiptItems).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to find receipt items: " + err.Error(),
 		})
@@ -46,58 +26,13 @@ func FindReceiptItem(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Receipt item not found",
 		})
 	}
-	return c.JSON(fiber.Map{"Data": receiptItem})
-}
-
-// อัปเดต ReceiptItem
-func UpdateReceiptItem(db *gorm.DB, c *fiber.Ctx) error {
-	id := c.Params("id")
-	var receiptItem Models.ReceiptItems
-	if err := db.Where("receipt_item_id = ?", id).First(&receiptItem).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Receipt item not found",
-		})
-	}
-
-	var req Models.ReceiptItems
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid JSON format: " + err.Error(),
-		})
-	}
-
-	receiptItem.ReceiptID = req.ReceiptID
-	receiptItem.ProductID = req.ProductID
-	receiptItem.Quantity = req.Quantity
-	receiptItem.UnitPrice = req.UnitPrice
-	receiptItem.TotalPrice = req.TotalPrice
-
-	if err := db.Save(&receiptItem).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update receipt item: " + err.Error(),
-		})
-	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
-}
-
-// ลบ ReceiptItem
-func DeleteReceiptItem(db *gorm.DB, c *fiber.Ctx) error {
-	id := c.Params("id")
-	var receiptItem Models.ReceiptItems
-	if err := db.Where("receipt_item_id = ?", id).First(&receiptItem).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Receipt item not found",
-		})
-	}
-	if err := db.Delete(&receiptItem).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete receipt item: " + err.Error(),
-		})
+	if !canAccessBranch(c, receiptBranch(db, receiptItem.ReceiptID)) {
+		return branchForbidden(c)
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Deleted": "Succeed"})
+	return c.JSON(fiber.Map{"Data": receiptItem})
 }
 
-// Route สำหรับ ReceiptItems
+// Route สำหรับ ReceiptItems (อ่านอย่างเดียว รายการใบเสร็จสร้างพร้อมการขายหรือใบลดหนี้เท่านั้น)
 func ReceiptItemRoutes(app *fiber.App, db *gorm.DB) {
 	app.Get("/receiptitems", func(c *fiber.Ctx) error {
 		return LookReceiptItems(db, c)
@@ -105,13 +40,4 @@ func ReceiptItemRoutes(app *fiber.App, db *gorm.DB) {
 	app.Get("/receiptitems/:id", func(c *fiber.Ctx) error {
 		return FindReceiptItem(db, c)
 	})
-	app.Post("/receiptitems", func(c *fiber.Ctx) error {
-		return AddReceiptItem(db, c)
-	})
-	app.Put("/receiptitems/:id", func(c *fiber.Ctx) error {
-		return UpdateReceiptItem(db, c)
-	})
-	app.Delete("/receiptitems/:id", func(c *fiber.Ctx) error {
-		return DeleteReceiptItem(db, c)
-	})
 }
@@ -0,0 +1,252 @@
+package Database
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Models"
+	"github.com/posproject/Printing"
+	"gorm.io/gorm"
+)
+
+// ดึงรูปแบบใบเสร็จของสาขา ถ้ายังไม่ได้ตั้งค่าจะใช้ค่าเริ่มต้น
+func findReceiptTemplate(db *gorm.DB, branchID string) Models.ReceiptTemplates {
+	template := Models.ReceiptTemplates{
+		BranchID:   branchID,
+		PaperWidth: 80,
+		CodeType:   "qr",
+	}
+	db.Where("branch_id = ?", branchID).First(&template)
+	return template
+}
+
+// รวมข้อมูลจาก Receipts, ReceiptItems, Product, Payments และ Branches เป็นเอกสารสำหรับพิมพ์
+func buildPrintableReceipt(db *gorm.DB, receiptID string) (Printing.Receipt, Models.ReceiptTemplates, error) {
+	var doc Printing.Receipt
+
+	var receipt Models.Receipts
+	if err := db.Where("receipt_id = ?", receiptID).First(&receipt).Error; err != nil {
+		return doc, Models.ReceiptTemplates{}, err
+	}
+
+	var branch Models.Branches
+	db.Where("branch_id = ?", receipt.BranchID).First(&branch)
+	template := findReceiptTemplate(db, receipt.BranchID)
+
+	var items []Models.ReceiptItems
+	if err := db.Where("receipt_id = ?", receipt.ReceiptID).Find(&items).Error; err != nil {
+		return doc, template, err
+	}
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var products []Models.Product
+	if len(productIDs) > 0 {
+		db.Where("product_id IN ?", productIDs).Find(&products)
+	}
+	productNames := make(map[string]string, len(products))
+	for _, p := range products {
+		productNames[p.ProductID] = p.ProductName
+	}
+
+	// ชื่อโปรโมชันที่ใช้ในแต่ละรายการ
+	promotionIDs := []string{}
+	for _, item := range items {
+		if item.PromotionID != nil {
+			promotionIDs = append(promotionIDs, *item.PromotionID)
+		}
+	}
+	promotionNames := make(map[string]string)
+	if len(promotionIDs) > 0 {
+		var promotions []Models.Promotions
+		db.Where("promotion_id IN ?", promotionIDs).Find(&promotions)
+		for _, p := range promotions {
+			promotionNames[p.PromotionID] = p.Name
+		}
+	}
+
+	doc = Printing.Receipt{
+		BranchName:     branch.BName,
+		BranchAddress:  branch.Location,
+		TaxID:          branch.TaxID,
+		HeaderText:     template.HeaderText,
+		FooterText:     template.FooterText,
+		Title:          "RECEIPT / ABB TAX INVOICE",
+		Number:         receipt.ReceiptNumber,
+		Date:           receipt.ReceiptDate,
+		NetAmount:      receipt.NetAmount,
+		VatAmount:      receipt.VatAmount,
+		TotalAmount:    receipt.TotalAmount,
+		DiscountAmount: receipt.DiscountAmount,
+		CodeType:       template.CodeType,
+	}
+	for _, item := range items {
+		line := Printing.ReceiptLine{
+			Name:      productNames[item.ProductID],
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Total:     item.TotalPrice,
+			Discount:  item.DiscountAmount,
+		}
+		if item.PromotionID != nil {
+			line.DiscountLabel = promotionNames[*item.PromotionID]
+		}
+		doc.Lines = append(doc.Lines, line)
+	}
+
+	if receipt.ReceiptType == "credit_note" {
+		doc.Title = "CREDIT NOTE"
+		if receipt.OriginalReceiptID != nil {
+			var original Models.Receipts
+			if err := db.Where("receipt_id = ?", *receipt.OriginalReceiptID).First(&original).Error; err == nil {
+				doc.Reference = original.ReceiptNumber
+			}
+		}
+	} else {
+		if err := attachPayments(db, &receipt); err != nil {
+			return doc, template, err
+		}
+		for _, p := range receipt.Payments {
+			doc.Payments = append(doc.Payments, Printing.ReceiptPayment{
+				Method:   p.Method,
+				Amount:   p.Amount,
+				Tendered: p.Tendered,
+				Change:   p.Change,
+			})
+		}
+		doc.ChangeDue = receipt.ChangeDue
+	}
+
+	return doc, template, nil
+}
+
+// ความกว้างกระดาษจาก query ?width= ถ้าไม่ระบุใช้ค่าจากรูปแบบใบเสร็จของสาขา
+func paperWidth(c *fiber.Ctx, template Models.ReceiptTemplates) (int, bool) {
+	width := template.PaperWidth
+	if w := c.Query("width"); w != "" {
+		width, _ = strconv.Atoi(w)
+	}
+	return width, width == 58 || width == 80
+}
+
+// พิมพ์ใบเสร็จเป็น ESC/POS สำหรับเครื่องพิมพ์ความร้อน
+func PrintReceiptEscPos(db *gorm.DB, c *fiber.Ctx) error {
+	doc, template, err := buildPrintableReceipt(db, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Receipt not found",
+		})
+	}
+	if !canAccessBranch(c, receiptBranch(db, c.Params("id"))) {
+		return branchForbidden(c)
+	}
+	width, ok := paperWidth(c, template)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Paper width must be 58 or 80",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+doc.Number+`.bin"`)
+	return c.Send(Printing.EscPos(doc, width, template.CodePage))
+}
+
+// พิมพ์ใบเสร็จเป็น PDF สำหรับส่งอีเมลหรือดาวน์โหลด
+func PrintReceiptPDF(db *gorm.DB, c *fiber.Ctx) error {
+	doc, template, err := buildPrintableReceipt(db, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Receipt not found",
+		})
+	}
+	if !canAccessBranch(c, receiptBranch(db, c.Params("id"))) {
+		return branchForbidden(c)
+	}
+	width, ok := paperWidth(c, template)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Paper width must be 58 or 80",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="`+doc.Number+`.pdf"`)
+	return c.Send(Printing.PDF(doc, width))
+}
+
+// ดูรูปแบบใบเสร็จของสาขา
+func FindReceiptTemplate(db *gorm.DB, c *fiber.Ctx) error {
+	if !canAccessBranch(c, c.Params("id")) {
+		return branchForbidden(c)
+	}
+	return c.JSON(fiber.Map{"Data": findReceiptTemplate(db, c.Params("id"))})
+}
+
+// บันทึกรูปแบบใบเสร็จของสาขา
+func UpdateReceiptTemplate(db *gorm.DB, c *fiber.Ctx) error {
+	id := c.Params("id")
+	var branch Models.Branches
+	if err := db.Where("branch_id = ?", id).First(&branch).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Branch not found",
+		})
+	}
+	if !canAccessBranch(c, branch.BranchID) {
+		return branchForbidden(c)
+	}
+
+	var req Models.ReceiptTemplates
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if req.PaperWidth == 0 {
+		req.PaperWidth = 80
+	}
+	if req.PaperWidth != 58 && req.PaperWidth != 80 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Paper width must be 58 or 80",
+		})
+	}
+	switch req.CodeType {
+	case "":
+		req.CodeType = "qr"
+	case "qr", "barcode", "none":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Code type must be qr, barcode or none",
+		})
+	}
+	if req.CodePage < 0 || req.CodePage > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Code page must be between 0 and 255",
+		})
+	}
+
+	req.BranchID = branch.BranchID
+	if err := db.Save(&req).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save receipt template: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": req})
+}
+
+// Route สำหรับพิมพ์ใบเสร็จและรูปแบบใบเสร็จ
+func ReceiptPrintRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/receipts/:id/escpos", func(c *fiber.Ctx) error {
+		return PrintReceiptEscPos(db, c)
+	})
+	app.Get("/receipts/:id/pdf", func(c *fiber.Ctx) error {
+		return PrintReceiptPDF(db, c)
+	})
+	app.Get("/branches/:id/receipttemplate", func(c *fiber.Ctx) error {
+		return FindReceiptTemplate(db, c)
+	})
+	app.Put("/branches/:id/receipttemplate", func(c *fiber.Ctx) error {
+		return UpdateReceiptTemplate(db, c)
+	})
+}
@@ -0,0 +1,436 @@
+package Database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// เหตุผลที่อนุญาตให้ใช้ในการคืนเงิน/ยกเลิกการขาย
+var refundReasonCodes = map[string]bool{
+	"customer_return": true, // ลูกค้าคืนสินค้า
+	"defective":       true, // สินค้าชำรุด
+	"wrong_item":      true, // ขายผิดรายการ
+	"pricing_error":   true, // ราคาผิด
+	"cashier_error":   true, // พนักงานทำรายการผิด
+	"other":           true,
+}
+
+// RefundLineRequest รายการที่ต้องการคืน (ถ้าไม่ส่ง items มาจะคืนทั้งหมดที่เหลือ)
+type RefundLineRequest struct {
+	SaleItemID string `json:"saleitemid"`
+	Quantity   int    `json:"quantity"`
+}
+
+type RefundRequest struct {
+	ReasonCode string              `json:"reasoncode"`
+	Note       string              `json:"note"`
+	Method     string              `json:"method"` // ช่องทางที่คืนเงิน (ค่าเริ่มต้น cash)
+	Items      []RefundLineRequest `json:"items"`
+}
+
+// refundError ข้อผิดพลาดที่ต้องตอบกลับ client ด้วย status code ที่กำหนด
+type refundError struct {
+	status  int
+	message string
+}
+
+func (e *refundError) Error() string {
+	return e.message
+}
+
+// รวมรายการคืนที่อ้างถึง SaleItems เดียวกันเป็นรายการเดียว (คงลำดับของรายการแรก)
+func mergeRefundLines(lines []RefundLineRequest) []RefundLineRequest {
+	merged := make([]RefundLineRequest, 0, len(lines))
+	index := make(map[string]int, len(lines))
+	for _, line := range lines {
+		if i, ok := index[line.SaleItemID]; ok {
+			merged[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.SaleItemID] = len(merged)
+		merged = append(merged, line)
+	}
+	return merged
+}
+
+// คืนสินค้าตามรายการ SaleItems, ออกใบลดหนี้, คืน stock เข้า Inventory และอัปเดตสถานะการขาย
+// การขายต้นฉบับ (Sales/SaleItems/ใบเสร็จเดิม) จะไม่ถูกแก้ไขนอกจาก status
+func processRefund(tx *gorm.DB, saleID string, req RefundRequest, employeeID string, void bool) (Models.Refunds, Models.Receipts, error) {
+	var refund Models.Refunds
+	var creditNote Models.Receipts
+
+	if !refundReasonCodes[req.ReasonCode] {
+		return refund, creditNote, &refundError{fiber.StatusBadRequest, "Invalid reason code: " + req.ReasonCode}
+	}
+	if req.Method == "" {
+		req.Method = "cash"
+	}
+	if !paymentMethods[req.Method] || req.Method == "points" {
+		return refund, creditNote, &refundError{fiber.StatusBadRequest, "Invalid refund method: " + req.Method}
+	}
+
+	// lock การขายไว้เพื่อป้องกันการคืนซ้อนกัน
+	var sale Models.Sales
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sale_id = ?", saleID).First(&sale).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return refund, creditNote, &refundError{fiber.StatusNotFound, "Sale not found"}
+		}
+		return refund, creditNote, err
+	}
+	if sale.Status == "refunded" || sale.Status == "voided" {
+		return refund, creditNote, &refundError{fiber.StatusConflict, "Sale is already " + sale.Status}
+	}
+
+	var saleItems []Models.SaleItems
+	if err := tx.Where("sale_id = ?", saleID).Find(&saleItems).Error; err != nil {
+		return refund, creditNote, err
+	}
+
+	// จำนวน ยอดเงิน และ VAT ที่คืนไปแล้วของแต่ละ SaleItems
+	var refunded []struct {
+		SaleItemID string
+		Quantity   int
+		TotalPrice float64
+		VatAmount  float64
+	}
+	if err := tx.Model(&Models.RefundItems{}).
+		Select("sale_item_id, SUM(quantity) AS quantity, SUM(total_price) AS total_price, SUM(vat_amount) AS vat_amount").
+		Where("refund_id IN (?)", tx.Model(&Models.Refunds{}).Select("refund_id").Where("sale_id = ?", saleID)).
+		Group("sale_item_id").
+		Scan(&refunded).Error; err != nil {
+		return refund, creditNote, err
+	}
+	refundedQty := make(map[string]int)
+	refundedAmount := make(map[string]float64)
+	refundedVat := make(map[string]float64)
+	for _, r := range refunded {
+		refundedQty[r.SaleItemID] = r.Quantity
+		refundedAmount[r.SaleItemID] = r.TotalPrice
+		refundedVat[r.SaleItemID] = r.VatAmount
+	}
+
+	saleItemByID := make(map[string]Models.SaleItems, len(saleItems))
+	for _, item := range saleItems {
+		saleItemByID[item.SaleItemID] = item
+	}
+
+	// ถ้าไม่ระบุรายการ หรือเป็นการ void ให้คืนทุกรายการที่ยังเหลือ
+	lines := mergeRefundLines(req.Items)
+	if void || len(lines) == 0 {
+		lines = nil
+		for _, item := range saleItems {
+			if remaining := item.Quantity - refundedQty[item.SaleItemID]; remaining > 0 {
+				lines = append(lines, RefundLineRequest{SaleItemID: item.SaleItemID, Quantity: remaining})
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return refund, creditNote, &refundError{fiber.StatusConflict, "Nothing left to refund on this sale"}
+	}
+
+	// ใบเสร็จต้นฉบับของการขาย
+	var original Models.Receipts
+	if err := tx.Where("sale_id = ? AND receipt_type = ?", saleID, "sale").First(&original).Error; err != nil {
+		return refund, creditNote, &refundError{fiber.StatusConflict, "Original receipt not found for sale"}
+	}
+
+	// คืนเงินสดต้องจ่ายจากลิ้นชักของกะที่เปิดอยู่ ช่องทางอื่นผูกกับกะถ้ามี
+	var shiftID *string
+	shift, err := lockOpenShift(tx, employeeID, sale.BranchID, "SHARE")
+	switch {
+	case err == nil:
+		shiftID = &shift.ShiftID
+	case !errors.Is(err, ErrNoOpenShift):
+		return refund, creditNote, err
+	case req.Method == "cash":
+		return refund, creditNote, &refundError{fiber.StatusConflict, "Cash refund requires an open shift"}
+	}
+
+	now := time.Now()
+	refund = Models.Refunds{
+		RefundID:   uuid.New().String(),
+		SaleID:     sale.SaleID,
+		BranchID:   sale.BranchID,
+		EmployeeID: employeeID,
+		ReasonCode: req.ReasonCode,
+		Note:       req.Note,
+		Method:     req.Method,
+		ShiftID:    shiftID,
+		CreatedAt:  now,
+	}
+
+	for _, line := range lines {
+		item, ok := saleItemByID[line.SaleItemID]
+		if !ok {
+			return refund, creditNote, &refundError{fiber.StatusBadRequest, "Sale item does not belong to sale: " + line.SaleItemID}
+		}
+		remaining := item.Quantity - refundedQty[item.SaleItemID]
+		if line.Quantity <= 0 || line.Quantity > remaining {
+			return refund, creditNote, &refundError{fiber.StatusBadRequest, fmt.Sprintf("Invalid refund quantity %d for sale item %s (remaining %d)", line.Quantity, item.SaleItemID, remaining)}
+		}
+
+		// คิดยอดและ VAT ตามสัดส่วนของรายการขายเดิม
+		// คืนครบจำนวนที่เหลือให้ใช้ยอดคงเหลือจริงเพื่อไม่ให้เศษสตางค์คลาดเคลื่อน
+		ratio := float64(line.Quantity) / float64(item.Quantity)
+		lineTotal := roundMoney(item.TotalPrice * ratio)
+		lineVat := roundMoney(item.VatAmount * ratio)
+		if line.Quantity == remaining {
+			lineTotal = roundMoney(item.TotalPrice - refundedAmount[item.SaleItemID])
+			lineVat = roundMoney(item.VatAmount - refundedVat[item.SaleItemID])
+		}
+		refundedQty[item.SaleItemID] += line.Quantity
+		refundedAmount[item.SaleItemID] += lineTotal
+		refundedVat[item.SaleItemID] += lineVat
+
+		refund.Items = append(refund.Items, Models.RefundItems{
+			RefundItemID: uuid.New().String(),
+			RefundID:     refund.RefundID,
+			SaleItemID:   item.SaleItemID,
+			ProductID:    item.ProductID,
+			Quantity:     line.Quantity,
+			UnitPrice:    item.Price,
+			TotalPrice:   lineTotal,
+			NetAmount:    roundMoney(lineTotal - lineVat),
+			VatAmount:    lineVat,
+		})
+		refund.TotalAmount += lineTotal
+		refund.VatAmount += lineVat
+
+		// คืน stock เข้า Inventory ของสาขาที่ขาย
+		if _, err := incrementInventory(tx, sale.BranchID, item.ProductID, line.Quantity, stockRef{
+			Type:          "refund",
+			ReferenceType: "refund",
+			ReferenceID:   refund.RefundID,
+			EmployeeID:    employeeID,
+		}); err != nil {
+			return refund, creditNote, err
+		}
+	}
+	refund.TotalAmount = roundMoney(refund.TotalAmount)
+	refund.VatAmount = roundMoney(refund.VatAmount)
+	refund.NetAmount = roundMoney(refund.TotalAmount - refund.VatAmount)
+
+	// สถานะใหม่ของการขาย
+	status := "refunded"
+	for _, item := range saleItems {
+		if refundedQty[item.SaleItemID] < item.Quantity {
+			status = "partially_refunded"
+			break
+		}
+	}
+	if void {
+		status = "voided"
+	}
+
+	// ส่วนที่ลูกค้าชำระด้วยแต้มคืนเป็นแต้ม ไม่จ่ายคืนเป็นเงินผ่าน method
+	pointsAmount, points, err := allocateRefundPoints(tx, sale, refund.TotalAmount, status != "partially_refunded")
+	if err != nil {
+		return refund, creditNote, err
+	}
+	refund.PointsAmount = pointsAmount
+
+	// ออกใบลดหนี้ที่มีเลขลำดับของตัวเอง
+	creditNoteNumber, err := nextBranchDocumentNumber(tx, "creditnote", "CN-", sale.BranchID, now)
+	if err != nil {
+		return refund, creditNote, err
+	}
+	creditNote = Models.Receipts{
+		ReceiptID:         uuid.New().String(),
+		SaleID:            sale.SaleID,
+		BranchID:          sale.BranchID,
+		ReceiptNumber:     creditNoteNumber,
+		TotalAmount:       refund.TotalAmount,
+		NetAmount:         refund.NetAmount,
+		VatAmount:         refund.VatAmount,
+		ReceiptDate:       now,
+		ReceiptType:       "credit_note",
+		OriginalReceiptID: &original.ReceiptID,
+	}
+	if err := tx.Create(&creditNote).Error; err != nil {
+		return refund, creditNote, err
+	}
+	for _, item := range refund.Items {
+		receiptItem := Models.ReceiptItems{
+			ReceiptID:  creditNote.ReceiptID,
+			ProductID:  item.ProductID,
+			Quantity:   item.Quantity,
+			UnitPrice:  item.UnitPrice,
+			TotalPrice: item.TotalPrice,
+			VatRate:    saleItemByID[item.SaleItemID].VatRate,
+			NetAmount:  item.NetAmount,
+			VatAmount:  item.VatAmount,
+		}
+		if err := tx.Create(&receiptItem).Error; err != nil {
+			return refund, creditNote, err
+		}
+	}
+
+	refund.ReceiptID = creditNote.ReceiptID
+
+	// หักแต้มสะสมของลูกค้าตามยอดที่คืน (refundedAmount รวมรายการปัจจุบันแล้ว) และคืนแต้มที่ใช้ชำระ
+	var refundedTotal float64
+	for _, amount := range refundedAmount {
+		refundedTotal += amount
+	}
+	shortfall, err := reverseSalePoints(tx, sale, refund.RefundID, roundMoney(refundedTotal), status != "partially_refunded", points)
+	if err != nil {
+		return refund, creditNote, err
+	}
+	refund.PointsShortfall = shortfall
+
+	if err := tx.Create(&refund).Error; err != nil {
+		return refund, creditNote, err
+	}
+	if err := tx.Model(&Models.Sales{}).Where("sale_id = ?", sale.SaleID).Update("status", status).Error; err != nil {
+		return refund, creditNote, err
+	}
+
+	return refund, creditNote, nil
+}
+
+// refundPoints ยอดที่ลูกค้าชำระด้วยแต้มของการขาย และส่วนที่คืนเป็นแต้มแล้ว (บาท)
+type refundPoints struct {
+	Paid     float64 // ยอดที่ชำระด้วยแต้ม
+	Refunded float64 // ยอดที่คืนเป็นแต้มแล้วรวมการคืนครั้งนี้
+}
+
+// คำนวณส่วนของยอดคืนที่ต้องคืนเป็นแต้มแทนเงิน
+// คืนเงินก่อนจนครบยอดที่ลูกค้าจ่ายเป็นเงิน ส่วนที่เกินคืนเป็นแต้ม และคืนครบทั้งบิลได้แต้มที่เหลือทั้งหมด
+func allocateRefundPoints(tx *gorm.DB, sale Models.Sales, amount float64, final bool) (float64, refundPoints, error) {
+	var points refundPoints
+	var paid struct{ Amount float64 }
+	if err := tx.Model(&Models.Payments{}).Select("COALESCE(SUM(amount), 0) AS amount").
+		Where("sale_id = ? AND method = ?", sale.SaleID, "points").Scan(&paid).Error; err != nil {
+		return 0, points, err
+	}
+	points.Paid = roundMoney(paid.Amount)
+	if points.Paid <= 0 {
+		return 0, points, nil
+	}
+
+	var previous struct {
+		Total  float64
+		Points float64
+	}
+	if err := tx.Model(&Models.Refunds{}).Select("COALESCE(SUM(total_amount), 0) AS total, COALESCE(SUM(points_amount), 0) AS points").
+		Where("sale_id = ?", sale.SaleID).Scan(&previous).Error; err != nil {
+		return 0, points, err
+	}
+	pointsLeft := roundMoney(points.Paid - previous.Points)
+
+	portion := pointsLeft
+	if !final {
+		moneyLeft := roundMoney(sale.TotalAmount - points.Paid - (previous.Total - previous.Points))
+		if moneyLeft < 0 {
+			moneyLeft = 0
+		}
+		portion = roundMoney(amount - moneyLeft)
+		if portion > pointsLeft {
+			portion = pointsLeft
+		}
+	}
+	if portion > amount {
+		portion = amount
+	}
+	if portion < 0 {
+		portion = 0
+	}
+	points.Refunded = roundMoney(previous.Points + portion)
+	return portion, points, nil
+}
+
+// คืนเงินบางส่วนหรือทั้งหมดของการขาย
+func RefundSale(db *gorm.DB, c *fiber.Ctx) error {
+	return handleRefund(db, c, false)
+}
+
+// ยกเลิกการขายทั้งบิล (คืนทุกรายการที่เหลือและตั้งสถานะเป็น voided)
+func VoidSale(db *gorm.DB, c *fiber.Ctx) error {
+	return handleRefund(db, c, true)
+}
+
+func handleRefund(db *gorm.DB, c *fiber.Ctx, void bool) error {
+	var req RefundRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	if branchID := saleBranch(db, c.Params("id")); branchID != "" && !canAccessBranch(c, branchID) {
+		return branchForbidden(c)
+	}
+
+	var refund Models.Refunds
+	var creditNote Models.Receipts
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, creditNote, err = processRefund(tx, c.Params("id"), req, claimString(c, "employeeid"), void)
+		return err
+	})
+	if err != nil {
+		var rerr *refundError
+		if errors.As(err, &rerr) {
+			return c.Status(rerr.status).JSON(fiber.Map{"error": rerr.message})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refund sale: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Refund created successfully",
+		"refund":     refund,
+		"creditnote": creditNote,
+	})
+}
+
+// ดูรายการคืนเงินของการขาย
+func LookSaleRefunds(db *gorm.DB, c *fiber.Ctx) error {
+	if !canAccessBranch(c, saleBranch(db, c.Params("id"))) {
+		return branchForbidden(c)
+	}
+
+	var refunds []Models.Refunds
+	if err := db.Preload("Items").Where("sale_id = ?", c.Params("id")).Order("created_at").Find(&refunds).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find refunds: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": refunds})
+}
+
+// ดูรายการคืนเงินทั้งหมด
+func LookRefunds(db *gorm.DB, c *fiber.Ctx) error {
+	var refunds []Models.Refunds
+	query := scopeBranch(c, db.Preload("Items"), "branch_id")
+	if err := query.Find(&refunds).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find refunds: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": refunds})
+}
+
+// Route สำหรับ Refunds
+func RefundRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/refunds", func(c *fiber.Ctx) error {
+		return LookRefunds(db, c)
+	})
+	app.Get("/sales/:id/refunds", func(c *fiber.Ctx) error {
+		return LookSaleRefunds(db, c)
+	})
+	app.Post("/sales/:id/refunds", func(c *fiber.Ctx) error {
+		return RefundSale(db, c)
+	})
+	app.Post("/sales/:id/void", func(c *fiber.Ctx) error {
+		return VoidSale(db, c)
+	})
+}
@@ -0,0 +1,552 @@
+package Database
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ตรวจสอบ min/reorder point/max ของ Inventory คืนข้อความ error (ว่าง = ถูกต้อง)
+func validateStockLevels(inventory Models.Inventory) string {
+	switch {
+	case inventory.MinQuantity < 0 || inventory.ReorderPoint < 0 || inventory.MaxQuantity < 0:
+		return "Stock levels cannot be negative"
+	case inventory.ReorderPoint > 0 && inventory.MaxQuantity == 0:
+		return "MaxQuantity is required when ReorderPoint is set"
+	case inventory.MaxQuantity > 0 && inventory.ReorderPoint >= inventory.MaxQuantity:
+		return "ReorderPoint must be lower than MaxQuantity"
+	case inventory.MaxQuantity > 0 && inventory.MinQuantity > inventory.MaxQuantity:
+		return "MinQuantity cannot exceed MaxQuantity"
+	}
+	return ""
+}
+
+// ตั้งค่า min/reorder point/max ของ Inventory
+func UpdateStockLevels(db *gorm.DB, c *fiber.Ctx) error {
+	var inventory Models.Inventory
+	if err := db.Where("inventory_id = ?", c.Params("id")).First(&inventory).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inventory not found",
+		})
+	}
+	if !canAccessBranch(c, inventory.BranchID) {
+		return branchForbidden(c)
+	}
+
+	var req struct {
+		MinQuantity  int `json:"minquantity"`
+		ReorderPoint int `json:"reorderpoint"`
+		MaxQuantity  int `json:"maxquantity"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	inventory.MinQuantity = req.MinQuantity
+	inventory.ReorderPoint = req.ReorderPoint
+	inventory.MaxQuantity = req.MaxQuantity
+	if msg := validateStockLevels(inventory); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := db.Model(&inventory).Select("min_quantity", "reorder_point", "max_quantity").Updates(&inventory).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update stock levels: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+}
+
+// จำนวนสินค้าที่กำลังจะเข้าสาขาจาก Requests และ Shipments ที่ยังไม่เสร็จ แยกตามสินค้า
+func incomingStock(db *gorm.DB, branchID string) (map[string]int, error) {
+	var rows []struct {
+		ProductID string
+		Quantity  int
+	}
+	err := db.Raw(`SELECT product_id, SUM(quantity) AS quantity FROM (
+			SELECT i.product_id, CASE WHEN r.status = 'in_transit' THEN i.shipped_quantity ELSE i.quantity END AS quantity
+			FROM "RequestItems" i
+			JOIN "Requests" r ON r.request_id = i.request_id
+			WHERE r.to_branch_id = ? AND r.status IN ?
+			UNION ALL
+			SELECT i.product_id, i.quantity FROM "ShipmentItems" i
+			JOIN "Shipments" s ON s.shipment_id = i.shipment_id
+			WHERE s.branch_id = ? AND s.status = 'pending'
+		) incoming GROUP BY product_id`, branchID, requestOpenStatuses, branchID).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	incoming := make(map[string]int, len(rows))
+	for _, row := range rows {
+		incoming[row.ProductID] = row.Quantity
+	}
+	return incoming, nil
+}
+
+// หาสาขาที่โอนสินค้าให้ได้ตามจำนวน โดยไม่ทำให้สาขานั้นต่ำกว่า min หรือ reorder point ของตัวเอง
+// เลือกสาขาที่มีส่วนเกินมากที่สุด ถ้าไม่มีสาขาใดพอคืนค่าว่าง
+func findTransferSource(db *gorm.DB, branchID string, productID string, quantity int) (string, error) {
+	var sources []Models.Inventory
+	err := db.Select("branch_id").
+		Where("product_id = ? AND branch_id <> ?", productID, branchID).
+		Where("quantity - GREATEST(min_quantity, reorder_point) >= ?", quantity).
+		Order("quantity - GREATEST(min_quantity, reorder_point) DESC").
+		Limit(1).
+		Find(&sources).Error
+	if err != nil || len(sources) == 0 {
+		return "", err
+	}
+	return sources[0].BranchID, nil
+}
+
+// ตรวจ Inventory ของสาขาที่ต่ำกว่าหรือเท่ากับ reorder point (นับรวมสินค้าที่กำลังเข้ามา)
+// หรือที่พยากรณ์ว่าจะขายหมดก่อนสินค้าล็อตใหม่เข้า (lead time) แล้วสร้างรายการเติมสินค้า
+// จำนวนที่เสนอคือค่าที่มากกว่าระหว่างการเติมให้ถึง max และจำนวนที่ควรสั่งจากการพยากรณ์
+// ถ้ามีสาขาอื่นโอนให้ได้จะเป็น transfer ไม่เช่นนั้นเป็น purchase สินค้าที่มีรายการรออนุมัติอยู่แล้วจะไม่สร้างซ้ำ
+func generateReplenishment(db *gorm.DB, branchID string) ([]Models.ReplenishmentSuggestions, error) {
+	var inventories []Models.Inventory
+	if err := db.Where("branch_id = ? AND reorder_point > 0 AND max_quantity > 0", branchID).
+		Where(`product_id NOT IN (SELECT product_id FROM "ReplenishmentSuggestions" WHERE branch_id = ? AND status = 'pending')`, branchID).
+		Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+	if len(inventories) == 0 {
+		return nil, nil
+	}
+	opts := forecastOptions()
+	forecasts, err := forecastInventories(db, branchID, inventories, time.Now(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []Models.ReplenishmentSuggestions
+	for i, inventory := range inventories {
+		forecast := forecasts[i]
+		position := inventory.Quantity + forecast.Incoming
+		runsOut := forecast.DaysOfCover != nil && *forecast.DaysOfCover <= float64(opts.LeadTimeDays)
+		if position > inventory.ReorderPoint && !runsOut {
+			continue
+		}
+		quantity := inventory.MaxQuantity - position
+		if forecast.ReorderQuantity > quantity {
+			quantity = forecast.ReorderQuantity
+		}
+		if quantity <= 0 {
+			continue
+		}
+		suggestion := Models.ReplenishmentSuggestions{
+			SuggestionID: uuid.New().String(),
+			BranchID:     branchID,
+			ProductID:    inventory.ProductID,
+			InventoryID:  inventory.InventoryID,
+			OnHand:       inventory.Quantity,
+			Incoming:     forecast.Incoming,
+			ReorderPoint: inventory.ReorderPoint,
+			MaxQuantity:  inventory.MaxQuantity,
+			AverageDaily: math.Round(forecast.AverageDaily*100) / 100,
+			DaysOfCover:  forecast.DaysOfCover,
+			Quantity:     quantity,
+			Source:       "purchase",
+			Status:       "pending",
+			CreatedAt:    time.Now(),
+		}
+		fromBranchID, err := findTransferSource(db, branchID, inventory.ProductID, suggestion.Quantity)
+		if err != nil {
+			return created, err
+		}
+		if fromBranchID != "" {
+			suggestion.Source = "transfer"
+			suggestion.FromBranchID = &fromBranchID
+		}
+
+		// unique index ของรายการที่รออนุมัติกันการสร้างซ้ำเมื่อสแกนพร้อมกัน
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&suggestion)
+		if result.Error != nil {
+			return created, result.Error
+		}
+		if result.RowsAffected > 0 {
+			created = append(created, suggestion)
+		}
+	}
+	return created, nil
+}
+
+// StartReplenishmentScan ตรวจหาสินค้าที่ต้องเติมของทุกสาขาเป็นระยะ
+func StartReplenishmentScan(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			var branches []Models.Branches
+			if err := db.Select("branch_id").Find(&branches).Error; err != nil {
+				log.Println("Replenishment scan failed: ", err)
+				continue
+			}
+			for _, branch := range branches {
+				created, err := generateReplenishment(db, branch.BranchID)
+				if err != nil {
+					log.Printf("Replenishment scan failed for branch %s: %v", branch.BranchID, err)
+					continue
+				}
+				if len(created) > 0 {
+					log.Printf("replenishment: branch=%s suggestions=%d", branch.BranchID, len(created))
+				}
+			}
+		}
+	}()
+}
+
+// สแกนหาสินค้าที่ต้องเติมทันที (Super Admin ใช้ ?branchid= หรือสแกนทุกสาขา)
+func ScanReplenishment(db *gorm.DB, c *fiber.Ctx) error {
+	var branches []Models.Branches
+	if err := scopeBranch(c, db.Select("branch_id"), "branch_id").Find(&branches).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find branches: " + err.Error(),
+		})
+	}
+
+	created := []Models.ReplenishmentSuggestions{}
+	for _, branch := range branches {
+		suggestions, err := generateReplenishment(db, branch.BranchID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to scan replenishment: " + err.Error(),
+			})
+		}
+		created = append(created, suggestions...)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": created})
+}
+
+// ดูรายการเติมสินค้า กรองด้วย ?status= ?source=
+func LookReplenishments(db *gorm.DB, c *fiber.Ctx) error {
+	query := scopeBranch(c, db, "branch_id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	var suggestions []Models.ReplenishmentSuggestions
+	if err := query.Order("created_at DESC").Find(&suggestions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find replenishment suggestions: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": suggestions})
+}
+
+// แก้ไขจำนวนหรือแหล่งที่มาของรายการที่รออนุมัติ
+func UpdateReplenishment(db *gorm.DB, c *fiber.Ctx) error {
+	var suggestion Models.ReplenishmentSuggestions
+	if err := db.Where("suggestion_id = ?", c.Params("id")).First(&suggestion).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Replenishment suggestion not found",
+		})
+	}
+	if !canAccessBranch(c, suggestion.BranchID) {
+		return branchForbidden(c)
+	}
+	if suggestion.Status != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Replenishment suggestion is already " + suggestion.Status,
+		})
+	}
+
+	var req struct {
+		Quantity     int    `json:"quantity"`
+		Source       string `json:"source"`
+		FromBranchID string `json:"frombranchid"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if req.Quantity != 0 {
+		if req.Quantity < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Quantity must be greater than zero",
+			})
+		}
+		suggestion.Quantity = req.Quantity
+	}
+	switch req.Source {
+	case "":
+	case "purchase":
+		suggestion.Source = "purchase"
+		suggestion.FromBranchID = nil
+	case "transfer":
+		if req.FromBranchID == "" || req.FromBranchID == suggestion.BranchID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "FromBranchID must be another branch for a transfer",
+			})
+		}
+		var branches int64
+		if _, err := uuid.Parse(req.FromBranchID); err == nil {
+			if err := db.Model(&Models.Branches{}).Where("branch_id = ?", req.FromBranchID).Count(&branches).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to find branch: " + err.Error(),
+				})
+			}
+		}
+		if branches == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "FromBranchID is not a known branch",
+			})
+		}
+		suggestion.Source = "transfer"
+		suggestion.FromBranchID = &req.FromBranchID
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Source must be transfer or purchase",
+		})
+	}
+
+	if err := db.Model(&suggestion).Select("quantity", "source", "from_branch_id").Updates(&suggestion).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update replenishment suggestion: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": suggestion})
+}
+
+// รายการที่ข้ามไปในการอนุมัติ/ปฏิเสธแบบกลุ่ม
+type skippedSuggestion struct {
+	SuggestionID string `json:"suggestionid"`
+	Reason       string `json:"reason"`
+}
+
+// lock รายการเติมสินค้าที่เลือกและแยกรายการที่อนุมัติ/ปฏิเสธไม่ได้ออก
+func lockPendingSuggestions(tx *gorm.DB, c *fiber.Ctx, ids []string) ([]Models.ReplenishmentSuggestions, []skippedSuggestion, error) {
+	var found []Models.ReplenishmentSuggestions
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("suggestion_id IN ?", ids).Order("created_at").Find(&found).Error; err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[string]Models.ReplenishmentSuggestions, len(found))
+	for _, suggestion := range found {
+		byID[suggestion.SuggestionID] = suggestion
+	}
+	var pending []Models.ReplenishmentSuggestions
+	skipped := []skippedSuggestion{}
+	for _, id := range ids {
+		suggestion, ok := byID[id]
+		switch {
+		case !ok:
+			skipped = append(skipped, skippedSuggestion{id, "not found"})
+		case !canAccessBranch(c, suggestion.BranchID):
+			skipped = append(skipped, skippedSuggestion{id, "no access to branch"})
+		case suggestion.Status != "pending":
+			skipped = append(skipped, skippedSuggestion{id, "already " + suggestion.Status})
+		default:
+			pending = append(pending, suggestion)
+			delete(byID, id) // id ซ้ำใน request นับครั้งเดียว
+		}
+	}
+	return pending, skipped, nil
+}
+
+// อ่าน suggestionids จาก body
+func parseSuggestionIDs(c *fiber.Ctx) ([]string, error) {
+	var req struct {
+		SuggestionIDs []string `json:"suggestionids"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return nil, err
+	}
+	if len(req.SuggestionIDs) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "suggestionids is required")
+	}
+	return req.SuggestionIDs, nil
+}
+
+// อนุมัติรายการเติมสินค้าแบบกลุ่ม
+// transfer รวมเป็น Requests หนึ่งเอกสารต่อคู่สาขา ส่วน purchase รวมเป็น Shipments หนึ่งรายการต่อสาขา
+func ApproveReplenishments(db *gorm.DB, c *fiber.Ctx) error {
+	ids, err := parseSuggestionIDs(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request: " + err.Error(),
+		})
+	}
+
+	user := Middleware.CurrentUser(c)
+	var approved []Models.ReplenishmentSuggestions
+	var skipped []skippedSuggestion
+	var requests []Models.Requests
+	var shipments []Models.Shipments
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var pending []Models.ReplenishmentSuggestions
+		var err error
+		pending, skipped, err = lockPendingSuggestions(tx, c, ids)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		purchases := make(map[string]*Models.Shipments)
+		var branchOrder []string
+		transfers := make(map[[2]string]*Models.Requests)
+		var transferOrder [][2]string
+		for i := range pending {
+			suggestion := &pending[i]
+			if suggestion.Source == "transfer" {
+				route := [2]string{*suggestion.FromBranchID, suggestion.BranchID}
+				request, ok := transfers[route]
+				if !ok {
+					request = &Models.Requests{
+						RequestID:    uuid.New().String(),
+						FromBranchID: route[0],
+						ToBranchID:   route[1],
+						Status:       "pending",
+						Note:         "replenishment",
+						CreatedAt:    now,
+						UpdatedAt:    now,
+					}
+					transfers[route] = request
+					transferOrder = append(transferOrder, route)
+				}
+				request.Items = append(request.Items, Models.RequestItems{
+					RequestItemID: uuid.New().String(),
+					RequestID:     request.RequestID,
+					ProductID:     suggestion.ProductID,
+					Quantity:      suggestion.Quantity,
+				})
+				suggestion.RequestID = &request.RequestID
+			} else {
+				shipment, ok := purchases[suggestion.BranchID]
+				if !ok {
+					number, err := generateShipmentNumber(tx, suggestion.BranchID, now)
+					if err != nil {
+						return err
+					}
+					shipment = &Models.Shipments{
+						ShipmentID:     uuid.New().String(),
+						ShipmentNumber: number,
+						BranchID:       suggestion.BranchID,
+						Status:         "pending",
+						CreatedAt:      now,
+					}
+					purchases[suggestion.BranchID] = shipment
+					branchOrder = append(branchOrder, suggestion.BranchID)
+				}
+				shipment.Items = append(shipment.Items, Models.ShipmentItems{
+					ShipmentItemID: uuid.New().String(),
+					ShipmentID:     shipment.ShipmentID,
+					ProductID:      suggestion.ProductID,
+					Quantity:       suggestion.Quantity,
+				})
+				suggestion.ShipmentID = &shipment.ShipmentID
+			}
+
+			suggestion.Status = "approved"
+			suggestion.ReviewedBy = &user.EmployeeID
+			suggestion.ReviewedAt = &now
+		}
+
+		for _, route := range transferOrder {
+			request := transfers[route]
+			if err := tx.Create(request).Error; err != nil {
+				return err
+			}
+			if err := logRequestTransition(tx, request.RequestID, "", request.Status, user.EmployeeID, "replenishment"); err != nil {
+				return err
+			}
+			requests = append(requests, *request)
+		}
+		for _, branchID := range branchOrder {
+			if err := tx.Create(purchases[branchID]).Error; err != nil {
+				return err
+			}
+			shipments = append(shipments, *purchases[branchID])
+		}
+		for _, suggestion := range pending {
+			if err := tx.Model(&suggestion).Select("status", "request_id", "shipment_id", "reviewed_by", "reviewed_at").Updates(&suggestion).Error; err != nil {
+				return err
+			}
+		}
+		approved = pending
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to approve replenishment suggestions: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"Data":      approved,
+		"Skipped":   skipped,
+		"Requests":  requests,
+		"Shipments": shipments,
+	})
+}
+
+// ปฏิเสธรายการเติมสินค้าแบบกลุ่ม
+func RejectReplenishments(db *gorm.DB, c *fiber.Ctx) error {
+	ids, err := parseSuggestionIDs(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request: " + err.Error(),
+		})
+	}
+
+	user := Middleware.CurrentUser(c)
+	var rejected []Models.ReplenishmentSuggestions
+	var skipped []skippedSuggestion
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rejected, skipped, err = lockPendingSuggestions(tx, c, ids)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for i := range rejected {
+			rejected[i].Status = "rejected"
+			rejected[i].ReviewedBy = &user.EmployeeID
+			rejected[i].ReviewedAt = &now
+			if err := tx.Model(&rejected[i]).Select("status", "reviewed_by", "reviewed_at").Updates(&rejected[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reject replenishment suggestions: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"Data":    rejected,
+		"Skipped": skipped,
+	})
+}
+
+// Route สำหรับการเติมสินค้า
+func ReplenishmentRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/replenishments", func(c *fiber.Ctx) error {
+		return LookReplenishments(db, c)
+	})
+	app.Post("/replenishments/scan", func(c *fiber.Ctx) error {
+		return ScanReplenishment(db, c)
+	})
+	app.Post("/replenishments/approve", func(c *fiber.Ctx) error {
+		return ApproveReplenishments(db, c)
+	})
+	app.Post("/replenishments/reject", func(c *fiber.Ctx) error {
+		return RejectReplenishments(db, c)
+	})
+	app.Put("/replenishments/:id", func(c *fiber.Ctx) error {
+		return UpdateReplenishment(db, c)
+	})
+}
@@ -0,0 +1,200 @@
+package Database
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// VatSummary สรุปภาษีขายของสาขาในหนึ่งเดือน
+type VatSummary struct {
+	BranchID     string  `json:"branchid"`
+	BName        string  `json:"bname"`
+	Month        string  `json:"month"`
+	ReceiptCount int64   `json:"receiptcount"`
+	SalesNet     float64 `json:"salesnet"`
+	SalesVat     float64 `json:"salesvat"`
+	SalesTotal   float64 `json:"salestotal"`
+	ExemptSales  float64 `json:"exemptsales"` // ยอดขายสินค้าที่ได้รับยกเว้น VAT
+	CreditNet    float64 `json:"creditnet"`   // ยอดลดหนี้ (คืนสินค้า) ก่อน VAT
+	CreditVat    float64 `json:"creditvat"`
+	CreditTotal  float64 `json:"credittotal"`
+	NetVat       float64 `json:"netvat"` // ภาษีขายสุทธิ = VAT จากการขาย - VAT จากใบลดหนี้
+}
+
+// แปลง query ?month=YYYY-MM เป็นช่วงเวลาเริ่มต้น/สิ้นสุดของเดือน (ค่าเริ่มต้นคือเดือนปัจจุบัน)
+func parseMonth(month string) (time.Time, time.Time, error) {
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	}
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// รายงานภาษีขายแยกตามสาขาและเดือน
+func VatReport(db *gorm.DB, c *fiber.Ctx) error {
+	start, end, err := parseMonth(c.Query("month"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid month, expected YYYY-MM",
+		})
+	}
+
+	var totals []struct {
+		BranchID    string
+		ReceiptType string
+		Count       int64
+		NetAmount   float64
+		VatAmount   float64
+		TotalAmount float64
+	}
+	query := db.Model(&Models.Receipts{}).
+		Select("branch_id, receipt_type, COUNT(*) AS count, SUM(net_amount) AS net_amount, SUM(vat_amount) AS vat_amount, SUM(total_amount) AS total_amount").
+		Where("receipt_date >= ? AND receipt_date < ?", start, end)
+	query = scopeBranch(c, query, "branch_id")
+	if err := query.Group("branch_id, receipt_type").Scan(&totals).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build VAT report: " + err.Error(),
+		})
+	}
+
+	var exempt []struct {
+		BranchID  string
+		NetAmount float64
+	}
+	exemptQuery := db.Table(`"ReceiptItems" AS ri`).
+		Select("r.branch_id, SUM(ri.net_amount) AS net_amount").
+		Joins(`JOIN "Receipts" AS r ON r.receipt_id = ri.receipt_id`).
+		Where("r.receipt_type = ? AND ri.vat_rate = 0 AND r.receipt_date >= ? AND r.receipt_date < ?", "sale", start, end)
+	exemptQuery = scopeBranch(c, exemptQuery, "r.branch_id")
+	if err := exemptQuery.Group("r.branch_id").Scan(&exempt).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build VAT report: " + err.Error(),
+		})
+	}
+
+	var branches []Models.Branches
+	if err := db.Find(&branches).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find branches: " + err.Error(),
+		})
+	}
+	branchNames := make(map[string]string, len(branches))
+	for _, b := range branches {
+		branchNames[b.BranchID] = b.BName
+	}
+
+	summaries := make(map[string]*VatSummary)
+	order := []string{}
+	summaryFor := func(branchID string) *VatSummary {
+		if s, ok := summaries[branchID]; ok {
+			return s
+		}
+		s := &VatSummary{BranchID: branchID, BName: branchNames[branchID], Month: start.Format("2006-01")}
+		summaries[branchID] = s
+		order = append(order, branchID)
+		return s
+	}
+	for _, t := range totals {
+		s := summaryFor(t.BranchID)
+		if t.ReceiptType == "credit_note" {
+			s.CreditNet += t.NetAmount
+			s.CreditVat += t.VatAmount
+			s.CreditTotal += t.TotalAmount
+			continue
+		}
+		s.ReceiptCount += t.Count
+		s.SalesNet += t.NetAmount
+		s.SalesVat += t.VatAmount
+		s.SalesTotal += t.TotalAmount
+	}
+	for _, e := range exempt {
+		summaryFor(e.BranchID).ExemptSales += e.NetAmount
+	}
+
+	result := make([]VatSummary, 0, len(order))
+	for _, branchID := range order {
+		s := summaries[branchID]
+		s.NetVat = roundMoney(s.SalesVat - s.CreditVat)
+		result = append(result, *s)
+	}
+	return c.JSON(fiber.Map{"Data": result})
+}
+
+// DiscountSummary ต้นทุนส่วนลดของโปรโมชันหนึ่งรายการ (PromotionID ว่าง = ส่วนลดที่พนักงานให้เอง)
+type DiscountSummary struct {
+	PromotionID    string  `json:"promotionid"`
+	Name           string  `json:"name"`
+	Lines          int64   `json:"lines"`
+	Quantity       int64   `json:"quantity"`
+	SalesAmount    float64 `json:"salesamount"`    // ยอดขายหลังหักส่วนลดของรายการที่ได้ส่วนลด
+	DiscountAmount float64 `json:"discountamount"` // ส่วนลดรวม
+}
+
+// รายงานส่วนลดแยกตามโปรโมชันในหนึ่งเดือน (ไม่รวมการขายที่ถูก void)
+func DiscountReport(db *gorm.DB, c *fiber.Ctx) error {
+	start, end, err := parseMonth(c.Query("month"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid month, expected YYYY-MM",
+		})
+	}
+
+	base := func() *gorm.DB {
+		query := db.Table(`"SaleItems" AS si`).
+			Joins(`JOIN "Sales" AS s ON s.sale_id = si.sale_id`).
+			Where("s.status <> ? AND s.created_at >= ? AND s.created_at < ?", "voided", start, end)
+		return scopeBranch(c, query, "s.branch_id")
+	}
+
+	var promotionRows []DiscountSummary
+	if err := base().
+		Select("si.promotion_id, p.name, COUNT(*) AS lines, SUM(si.quantity) AS quantity, SUM(si.total_price) AS sales_amount, SUM(si.promotion_discount) AS discount_amount").
+		Joins(`LEFT JOIN "Promotions" AS p ON p.promotion_id = si.promotion_id`).
+		Where("si.promotion_id IS NOT NULL").
+		Group("si.promotion_id, p.name").
+		Order("discount_amount DESC").
+		Scan(&promotionRows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build discount report: " + err.Error(),
+		})
+	}
+
+	var manual DiscountSummary
+	if err := base().
+		Select("COUNT(*) AS lines, COALESCE(SUM(si.quantity), 0) AS quantity, COALESCE(SUM(si.total_price), 0) AS sales_amount, COALESCE(SUM(si.manual_discount), 0) AS discount_amount").
+		Where("si.manual_discount > 0").
+		Scan(&manual).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build discount report: " + err.Error(),
+		})
+	}
+	manual.Name = "Manual discount"
+
+	var total float64
+	for _, row := range promotionRows {
+		total += row.DiscountAmount
+	}
+	total += manual.DiscountAmount
+
+	return c.JSON(fiber.Map{
+		"Data":  append(promotionRows, manual),
+		"Month": start.Format("2006-01"),
+		"Total": roundMoney(total),
+	})
+}
+
+// Route สำหรับ Reports
+func ReportRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/reports/vat", func(c *fiber.Ctx) error {
+		return VatReport(db, c)
+	})
+	app.Get("/reports/discounts", func(c *fiber.Ctx) error {
+		return DiscountReport(db, c)
+	})
+}
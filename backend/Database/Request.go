@@ -1,111 +1,241 @@
 package Database
 
 import (
+	"sort"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
 	"github.com/posproject/Models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// สร้างคำขอ (Request) อัตโนมัติ
+// requestLineInput สินค้าหนึ่งรายการที่ขอโอน
+type requestLineInput struct {
+	ProductID string `json:"productid"`
+	Quantity  int    `json:"quantity"`
+}
+
+// requestInput body ของการสร้าง/แก้ไขคำขอโอนสินค้า
+// ส่งรายการสินค้าใน items หรือส่ง productid/quantity สินค้าเดียวแบบเดิมก็ได้
+type requestInput struct {
+	FromBranchID string             `json:"frombranchid"`
+	ToBranchID   string             `json:"tobranchid"`
+	ProductID    string             `json:"productid"`
+	Quantity     int                `json:"quantity"`
+	Items        []requestLineInput `json:"items"`
+	Note         string             `json:"note"`
+	Status       string             `json:"status"`
+}
+
+func (r requestInput) lines() []requestLineInput {
+	if len(r.Items) == 0 && r.ProductID != "" {
+		return []requestLineInput{{ProductID: r.ProductID, Quantity: r.Quantity}}
+	}
+	return r.Items
+}
+
+// สร้าง RequestItems จากรายการที่ส่งมา (รวมสินค้าซ้ำเข้าด้วยกัน) คืนข้อความ error ถ้าไม่ถูกต้อง
+func buildRequestItems(db *gorm.DB, requestID string, lines []requestLineInput) ([]Models.RequestItems, string) {
+	if len(lines) == 0 {
+		return nil, "At least one item is required"
+	}
+	var items []Models.RequestItems
+	index := make(map[string]int)
+	for _, line := range lines {
+		if line.ProductID == "" {
+			return nil, "ProductID is required for every item"
+		}
+		if line.Quantity <= 0 {
+			return nil, "Quantity must be greater than zero"
+		}
+		if i, ok := index[line.ProductID]; ok {
+			items[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.ProductID] = len(items)
+		items = append(items, Models.RequestItems{
+			RequestItemID: uuid.New().String(),
+			RequestID:     requestID,
+			ProductID:     line.ProductID,
+			Quantity:      line.Quantity,
+		})
+	}
+
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var found int64
+	if err := db.Model(&Models.Product{}).Where("product_id IN ?", productIDs).Count(&found).Error; err != nil || int(found) != len(items) {
+		return nil, "Some products were not found"
+	}
+	return items, ""
+}
+
+// สร้างคำขอ (Request) อัตโนมัติจากรายการสินค้า
+// เลือกสาขาที่ส่งสินค้าได้ครบตามจำนวนมากรายการที่สุด (เท่ากันเลือกสาขาที่มีสินค้ารวมมากกว่า)
+// รายการที่สาขานั้นมีไม่พอจะไม่ถูกใส่ในคำขอและแจ้งกลับใน Skipped
 func AutoCreateRequest(db *gorm.DB, c *fiber.Ctx) error {
-	var req Models.Requests
+	var req requestInput
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid JSON format: " + err.Error(),
 		})
 	}
 
-	// ตรวจสอบว่ามีสินค้าที่ต้องการในสาขาของตัวเอง (tobranchid) หรือไม่
-	var productInventory Models.Inventory
-	if err := db.Where("branch_id = ? AND product_id = ?", req.ToBranchID, req.ProductID).First(&productInventory).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Product not found in your branch",
-		})
+	// สาขาที่ขอรับสินค้าคือสาขาของผู้ใช้ใน token
+	toBranchID, ok := writeBranch(c, req.ToBranchID)
+	if !ok {
+		return branchForbidden(c)
 	}
 
-	// ตรวจสอบว่า FromBranchID และ ToBranchID ไม่ใช่สาขาเดียวกัน
-	if req.FromBranchID == req.ToBranchID {
+	requestID := uuid.New().String()
+	items, msg := buildRequestItems(db, requestID, req.lines())
+	if msg != "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "FromBranchID and ToBranchID cannot be the same",
+			"error": msg,
 		})
 	}
 
-	// หาสาขาที่มีสินค้ามากที่สุด
-	var fromBranch Models.Inventory
-	if err := db.Where("product_id = ?", req.ProductID).Order("quantity desc").First(&fromBranch).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Product not found in any branch",
+	// stock ของสินค้าที่ขอในสาขาอื่น
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var inventories []Models.Inventory
+	if err := db.Where("product_id IN ? AND branch_id <> ?", productIDs, toBranchID).Find(&inventories).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find inventory: " + err.Error(),
 		})
 	}
+	stock := make(map[string]map[string]int)
+	for _, inventory := range inventories {
+		if stock[inventory.BranchID] == nil {
+			stock[inventory.BranchID] = make(map[string]int)
+		}
+		stock[inventory.BranchID][inventory.ProductID] = inventory.Quantity
+	}
 
-	// สร้างคำขอ
-	req.RequestID = uuid.New().String()
-	req.CreatedAt = time.Now()
-	req.FromBranchID = fromBranch.BranchID // ตั้งค่า fromBranchID เป็นสาขาที่มีสินค้าเยอะที่สุด
-	req.Status = "pending"                 // ตั้งค่าเริ่มต้นเป็น pending
-
-	// ตรวจสอบสินค้าจากสาขาที่ส่งสินค้า (fromBranchID) ว่ามีสินค้าพอหรือไม่
-	var inventoryFrom Models.Inventory
-	if err := db.Where("branch_id = ? AND product_id = ?", req.FromBranchID, req.ProductID).First(&inventoryFrom).Error; err != nil {
+	// หาสาขาที่ส่งได้ครบมากรายการที่สุด
+	branchIDs := make([]string, 0, len(stock))
+	for branchID := range stock {
+		branchIDs = append(branchIDs, branchID)
+	}
+	sort.Strings(branchIDs)
+	var fromBranchID string
+	bestCovered, bestTotal := 0, 0
+	for _, branchID := range branchIDs {
+		covered, total := 0, 0
+		for _, item := range items {
+			quantity := stock[branchID][item.ProductID]
+			total += quantity
+			if quantity >= item.Quantity {
+				covered++
+			}
+		}
+		if covered > bestCovered || (covered == bestCovered && covered > 0 && total > bestTotal) {
+			fromBranchID, bestCovered, bestTotal = branchID, covered, total
+		}
+	}
+	if fromBranchID == "" {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Inventory of sending branch not found",
+			"error": "No branch has enough stock for these products",
 		})
-	} else {
-		// ถ้าสินค้าจากสาขาที่ส่งมีไม่พอ
-		if inventoryFrom.Quantity < req.Quantity {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Not enough stock in sending branch",
-			})
+	}
+
+	var included []Models.RequestItems
+	skipped := []requestLineInput{}
+	for _, item := range items {
+		if stock[fromBranchID][item.ProductID] >= item.Quantity {
+			included = append(included, item)
+		} else {
+			skipped = append(skipped, requestLineInput{ProductID: item.ProductID, Quantity: item.Quantity})
 		}
 	}
 
+	// สร้างคำขอ
+	request := Models.Requests{
+		RequestID:    requestID,
+		FromBranchID: fromBranchID, // สาขาที่ส่งสินค้าได้ครบมากรายการที่สุด
+		ToBranchID:   toBranchID,
+		Status:       "pending", // ตั้งค่าเริ่มต้นเป็น pending
+		Note:         req.Note,
+		CreatedAt:    time.Now(),
+		Items:        included,
+	}
+	request.UpdatedAt = request.CreatedAt
+
 	// บันทึกคำขอในฐานข้อมูล
-	if err := db.Create(&req).Error; err != nil {
+	if err := createRequest(db, c, &request); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create request: " + err.Error(),
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"New":     request,
+		"Skipped": skipped,
+	})
 }
 
 // เพิ่ม Request
 func AddRequest(db *gorm.DB, c *fiber.Ctx) error {
-	var req Models.Requests
+	var req requestInput
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid JSON format: " + err.Error(),
 		})
 	}
 
+	// สาขาที่ขอรับสินค้าคือสาขาของผู้ใช้ใน token
+	toBranchID, ok := writeBranch(c, req.ToBranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+
 	// ตรวจสอบว่า FromBranchID และ ToBranchID ไม่ใช่สาขาเดียวกัน
-	if req.FromBranchID == req.ToBranchID {
+	if req.FromBranchID == "" || req.FromBranchID == toBranchID {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "FromBranchID and ToBranchID cannot be the same",
 		})
 	}
 
-	// สร้าง Request ID ใหม่
-	req.RequestID = uuid.New().String()
-	req.CreatedAt = time.Now()
+	// สร้าง Request ID ใหม่ คำขอใหม่เริ่มที่ pending เสมอ
+	request := Models.Requests{
+		RequestID:    uuid.New().String(),
+		FromBranchID: req.FromBranchID,
+		ToBranchID:   toBranchID,
+		Status:       "pending",
+		Note:         req.Note,
+		CreatedAt:    time.Now(),
+	}
+	request.UpdatedAt = request.CreatedAt
+
+	items, msg := buildRequestItems(db, request.RequestID, req.lines())
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	request.Items = items
 
 	// เพิ่ม Request ลงในฐานข้อมูล
-	if err := db.Create(&req).Error; err != nil {
+	if err := createRequest(db, c, &request); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create request: " + err.Error(),
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": req})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": request})
 }
 
 // ดู Requests ทั้งหมด
 func LookRequests(db *gorm.DB, c *fiber.Ctx) error {
 	var requests []Models.Requests
-	if err := db.Find(&requests).Error; err != nil {
+	if err := scopeBranch(c, db.Preload("Items"), "from_branch_id", "to_branch_id").Find(&requests).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to find requests: " + err.Error(),
 		})
@@ -117,15 +247,20 @@ func LookRequests(db *gorm.DB, c *fiber.Ctx) error {
 func FindRequest(db *gorm.DB, c *fiber.Ctx) error {
 	id := c.Params("id")
 	var request Models.Requests
-	if err := db.Where("request_id = ?", id).First(&request).Error; err != nil {
+	if err := db.Preload("Items").Where("request_id = ?", id).First(&request).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Request not found",
 		})
 	}
+	if !canAccessBranch(c, request.FromBranchID, request.ToBranchID) {
+		return branchForbidden(c)
+	}
 	return c.JSON(fiber.Map{"Data": request})
 }
 
 // อัปเดต Request
+// แก้ไขสาขาที่ส่ง หมายเหตุ หรือรายการสินค้า (แทนที่ทั้งหมด) ได้เฉพาะตอน pending
+// ถ้าส่ง status มาจะเปลี่ยนสถานะตาม state machine
 func UpdateRequest(db *gorm.DB, c *fiber.Ctx) error {
 	id := c.Params("id")
 	var request Models.Requests
@@ -134,80 +269,95 @@ func UpdateRequest(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Request not found",
 		})
 	}
+	if !canAccessBranch(c, request.FromBranchID, request.ToBranchID) {
+		return branchForbidden(c)
+	}
 
-	// รับข้อมูลใหม่จาก body ของคำขอ (แค่ status)
-	var req Models.Requests
+	var req requestInput
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid JSON format: " + err.Error(),
 		})
 	}
 
-	// อัปเดตแค่ status
-	request.Status = req.Status
-
-	// ถ้าสถานะเป็น "complete", เพิ่มสินค้าใน Inventory และลดสินค้าในสาขาที่ส่ง
-	if request.Status == "complete" {
-		// ค้นหา Inventory ของสาขาที่ได้รับสินค้า (ToBranchID)
-		var inventoryTo Models.Inventory
-		if err := db.Where("branch_id = ? AND product_id = ?", request.ToBranchID, request.ProductID).First(&inventoryTo).Error; err != nil {
-			// ถ้าไม่พบสินค้าใน Inventory ของสาขาที่รับ, สร้างใหม่
-			inventoryTo = Models.Inventory{
-				InventoryID: uuid.New().String(),
-				BranchID:    request.ToBranchID,
-				ProductID:   request.ProductID,
-				Quantity:    request.Quantity,
-				UpdatedAt:   time.Now(),
-			}
-			if err := db.Create(&inventoryTo).Error; err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to update inventory of receiving branch: " + err.Error(),
-				})
-			}
-		} else {
-			// ถ้ามีสินค้าก่อนหน้าในสาขาที่รับ, เพิ่มจำนวนสินค้า
-			inventoryTo.Quantity += request.Quantity
-			inventoryTo.UpdatedAt = time.Now()
-			if err := db.Save(&inventoryTo).Error; err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to update inventory of receiving branch: " + err.Error(),
-				})
-			}
+	if req.Status != "" && req.Status != request.Status {
+		_, failure, err := transitionRequest(db, c, request.RequestID, req.Status, req.Note, nil)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update request: " + err.Error(),
+			})
 		}
+		if failure != nil {
+			return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+	}
 
-		// ค้นหา Inventory ของสาขาที่ส่งสินค้า (FromBranchID) และลดจำนวนสินค้า
-		var inventoryFrom Models.Inventory
-		if err := db.Where("branch_id = ? AND product_id = ?", request.FromBranchID, request.ProductID).First(&inventoryFrom).Error; err != nil {
-			// หากไม่พบ inventory จาก FromBranchID ก็ไม่จำเป็นต้องส่ง error
-			// เพราะต้องการให้ update เป็น "complete" โดยไม่คำนึงถึง inventory ของ FromBranchID
-			// สามารถดำเนินการต่อได้เลย
-		} else {
-			// ลดจำนวนสินค้าในสาขาที่ส่ง
-			if inventoryFrom.Quantity < request.Quantity {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error": "Not enough stock in sending branch",
-				})
-			}
-			inventoryFrom.Quantity -= request.Quantity
-			inventoryFrom.UpdatedAt = time.Now()
-			if err := db.Save(&inventoryFrom).Error; err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to update inventory of sending branch: " + err.Error(),
-				})
-			}
+	if req.FromBranchID != "" {
+		if req.FromBranchID == request.ToBranchID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "FromBranchID and ToBranchID cannot be the same",
+			})
 		}
+		request.FromBranchID = req.FromBranchID
+	}
+	if req.Note != "" {
+		request.Note = req.Note
 	}
+	var items []Models.RequestItems
+	if lines := req.lines(); len(lines) > 0 {
+		var msg string
+		if items, msg = buildRequestItems(db, request.RequestID, lines); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+	}
+	request.UpdatedAt = time.Now()
 
-	// อัปเดตสถานะของ request
-	if err := db.Save(&request).Error; err != nil {
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// แก้ไขได้เฉพาะคำขอที่ยัง pending (lock กันการอนุมัติพร้อมกัน)
+		var current Models.Requests
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("request_id = ?", request.RequestID).First(&current).Error; err != nil {
+			return err
+		}
+		if current.Status != "pending" {
+			failure = fiber.NewError(fiber.StatusConflict, "Request can only be edited while pending")
+			return nil
+		}
+		if err := tx.Model(&request).Select("from_branch_id", "note", "updated_at").Updates(&request).Error; err != nil {
+			return err
+		}
+		if items == nil {
+			return nil
+		}
+		if err := tx.Where("request_id = ?", request.RequestID).Delete(&Models.RequestItems{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update request: " + err.Error(),
 		})
 	}
-
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
 }
 
+// บันทึก Request ใหม่พร้อมรายการสินค้าและประวัติสถานะเริ่มต้น
+func createRequest(db *gorm.DB, c *fiber.Ctx, request *Models.Requests) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(request).Error; err != nil {
+			return err
+		}
+		return logRequestTransition(tx, request.RequestID, "", request.Status, Middleware.CurrentUser(c).EmployeeID, "")
+	})
+}
+
 // ลบ Request
 func DeleteRequest(db *gorm.DB, c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -217,6 +367,15 @@ func DeleteRequest(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Request not found",
 		})
 	}
+	if !canAccessBranch(c, request.FromBranchID, request.ToBranchID) {
+		return branchForbidden(c)
+	}
+	// คำขอที่เริ่มจัด/ส่งสินค้าแล้วต้องเก็บไว้เป็นหลักฐาน
+	if request.Status != "pending" && request.Status != "rejected" && request.Status != "cancelled" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Cannot delete a request that is " + request.Status,
+		})
+	}
 	if err := db.Delete(&request).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete request: " + err.Error(),
@@ -240,6 +399,12 @@ func RequestRoutes(app *fiber.App, db *gorm.DB) {
 	app.Post("/requests/auto", func(c *fiber.Ctx) error {
 		return AutoCreateRequest(db, c)
 	})
+	app.Get("/requests/:id/transitions", func(c *fiber.Ctx) error {
+		return LookRequestTransitions(db, c)
+	})
+	app.Post("/requests/:id/transitions", func(c *fiber.Ctx) error {
+		return TransitionRequest(db, c)
+	})
 	app.Put("/requests/:id", func(c *fiber.Ctx) error {
 		return UpdateRequest(db, c)
 	})
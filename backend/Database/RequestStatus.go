@@ -0,0 +1,339 @@
+package Database
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// สาขาที่ผู้ใช้ต้องอยู่จึงจะเปลี่ยนสถานะได้
+const (
+	requestSideFrom = "from" // สาขาที่ส่งสินค้า
+	requestSideTo   = "to"   // สาขาที่ขอรับสินค้า
+	requestSideAny  = "any"
+)
+
+// requestTransition สิทธิ์และสาขาที่ต้องใช้ในการเปลี่ยนสถานะหนึ่งแบบ
+type requestTransition struct {
+	Permission Middleware.Permission
+	Side       string
+}
+
+// สถานะที่เปลี่ยนไปได้จากแต่ละสถานะ
+// pending -> approved -> picked -> in_transit -> received
+// ปฏิเสธได้ตอน pending และยกเลิกได้จนกว่าสินค้าจะออกจากสาขา (in_transit)
+var requestTransitions = map[string]map[string]requestTransition{
+	"pending": {
+		"approved":  {Middleware.PermRequestsWrite, requestSideFrom},
+		"rejected":  {Middleware.PermRequestsWrite, requestSideFrom},
+		"cancelled": {Middleware.PermRequestsWrite, requestSideTo},
+	},
+	"approved": {
+		"picked":    {Middleware.PermRequestsFulfil, requestSideFrom},
+		"cancelled": {Middleware.PermRequestsWrite, requestSideAny},
+	},
+	"picked": {
+		"in_transit": {Middleware.PermRequestsFulfil, requestSideFrom},
+		"cancelled":  {Middleware.PermRequestsWrite, requestSideAny},
+	},
+	"in_transit": {
+		"received": {Middleware.PermRequestsFulfil, requestSideTo},
+	},
+}
+
+// สถานะที่ยังรอสินค้าเข้าสาขาที่ขอ
+var requestOpenStatuses = []string{"pending", "approved", "picked", "in_transit"}
+
+// requestFaultHook ใช้จำลองความผิดพลาดระหว่างย้าย stock ของ Request (ใช้ตอนทดสอบเท่านั้น ปกติเป็น nil)
+// ถูกเรียกก่อนแต่ละขั้นตอนด้วยชื่อขั้นตอน ถ้าคืน error ทั้ง Transaction จะถูก rollback
+var requestFaultHook func(step string) error
+
+// เรียก requestFaultHook ถ้ามีการตั้งไว้
+func requestFault(step string) error {
+	if requestFaultHook == nil {
+		return nil
+	}
+	return requestFaultHook(step)
+}
+
+// บันทึกประวัติการเปลี่ยนสถานะของ Request
+func logRequestTransition(tx *gorm.DB, requestID string, from string, to string, employeeID string, note string) error {
+	return tx.Create(&Models.RequestTransitions{
+		TransitionID: uuid.New().String(),
+		RequestID:    requestID,
+		FromStatus:   from,
+		ToStatus:     to,
+		EmployeeID:   employeeID,
+		Note:         note,
+		CreatedAt:    time.Now(),
+	}).Error
+}
+
+// ตรวจว่าเคยบันทึก StockMovements ประเภทนี้ของ Request แล้วหรือไม่ กันการย้าย stock ซ้ำ
+func requestStockMoved(tx *gorm.DB, requestID string, movementType string) (bool, error) {
+	var count int64
+	err := tx.Model(&Models.StockMovements{}).
+		Where("reference_type = ? AND reference_id = ? AND type = ?", "request", requestID, movementType).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// requestLineUpdate จำนวนที่ส่ง (in_transit) หรือรับจริง (received) ของสินค้าหนึ่งรายการ
+// ระบุรายการด้วย requestitemid หรือ productid ถ้าจำนวนไม่ตรงต้องมี note
+type requestLineUpdate struct {
+	RequestItemID string `json:"requestitemid"`
+	ProductID     string `json:"productid"`
+	Quantity      int    `json:"quantity"`
+	Note          string `json:"note"`
+}
+
+// ต่อหมายเหตุความคลาดเคลื่อนของรายการ
+func appendDiscrepancy(current string, note string) string {
+	if current == "" {
+		return note
+	}
+	return current + "; " + note
+}
+
+// กำหนดจำนวนที่ส่ง/รับของแต่ละรายการตามสถานะใหม่ ค่าเริ่มต้นคือส่งครบตามที่ขอและรับครบตามที่ส่ง
+// คืนข้อความ error ถ้าข้อมูลไม่ถูกต้อง
+func applyLineQuantities(items []Models.RequestItems, to string, updates []requestLineUpdate) string {
+	if to != "in_transit" && to != "received" {
+		return ""
+	}
+	for i := range items {
+		if to == "in_transit" {
+			items[i].ShippedQuantity = items[i].Quantity
+		} else {
+			items[i].ReceivedQuantity = items[i].ShippedQuantity
+		}
+	}
+
+	for _, update := range updates {
+		index := -1
+		for i, item := range items {
+			if (update.RequestItemID != "" && item.RequestItemID == update.RequestItemID) ||
+				(update.RequestItemID == "" && item.ProductID == update.ProductID) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return "Item " + update.RequestItemID + update.ProductID + " is not part of this request"
+		}
+		item := &items[index]
+		limit := item.Quantity
+		if to == "received" {
+			limit = item.ShippedQuantity
+		}
+		if update.Quantity < 0 || update.Quantity > limit {
+			return "Quantity of product " + item.ProductID + " must be between 0 and " + strconv.Itoa(limit)
+		}
+		if update.Quantity != limit {
+			if update.Note == "" {
+				return "A note is required when the quantity of product " + item.ProductID + " differs"
+			}
+			item.DiscrepancyNote = appendDiscrepancy(item.DiscrepancyNote, to+": "+update.Note)
+		}
+		if to == "in_transit" {
+			item.ShippedQuantity = update.Quantity
+		} else {
+			item.ReceivedQuantity = update.Quantity
+		}
+	}
+
+	if to == "in_transit" {
+		shipped := 0
+		for _, item := range items {
+			shipped += item.ShippedQuantity
+		}
+		if shipped == 0 {
+			return "Nothing to ship, cancel the request instead"
+		}
+	}
+	return ""
+}
+
+// ย้าย stock ตามสถานะใหม่: in_transit ตัดจำนวนที่ส่งออกจากสาขาที่ส่ง, received เพิ่มจำนวนที่รับจริงเข้าสาขาที่รับ
+func applyRequestStock(tx *gorm.DB, request Models.Requests, items []Models.RequestItems, to string, employeeID string) error {
+	ref := stockRef{
+		ReferenceType: "request",
+		ReferenceID:   request.RequestID,
+		EmployeeID:    employeeID,
+	}
+	switch to {
+	case "in_transit":
+		ref.Type = "transfer_out"
+	case "received":
+		ref.Type = "transfer_in"
+	default:
+		return nil
+	}
+	moved, err := requestStockMoved(tx, request.RequestID, ref.Type)
+	if err != nil || moved {
+		return err
+	}
+
+	for _, item := range items {
+		if err := requestFault("stock:" + item.ProductID); err != nil {
+			return err
+		}
+		if to == "in_transit" && item.ShippedQuantity > 0 {
+			_, err = decrementInventory(tx, request.FromBranchID, item.ProductID, item.ShippedQuantity, ref)
+		} else if to == "received" && item.ReceivedQuantity > 0 {
+			_, err = incrementInventory(tx, request.ToBranchID, item.ProductID, item.ReceivedQuantity, ref)
+		}
+		if err != nil {
+			return err
+		}
+		if err := requestFault("item:" + item.ProductID); err != nil {
+			return err
+		}
+		if err := tx.Model(&item).Select("shipped_quantity", "received_quantity", "discrepancy_note").Updates(&item).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// เปลี่ยนสถานะของ Request ตาม state machine ภายใน Transaction เดียวกับการย้าย stock
+// ถ้า Request อยู่ในสถานะที่ขอแล้วจะคืนค่าเดิมโดยไม่ย้าย stock ซ้ำ (เรียกซ้ำได้)
+// การย้าย stock ทุกรายการ จำนวนที่ส่ง/รับ สถานะ และประวัติ สำเร็จพร้อมกันหรือ rollback ทั้งหมด
+func transitionRequest(db *gorm.DB, c *fiber.Ctx, requestID string, to string, note string, lines []requestLineUpdate) (Models.Requests, *fiber.Error, error) {
+	user := Middleware.CurrentUser(c)
+	var request Models.Requests
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("request_id = ?", requestID).First(&request).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Request not found")
+			return nil
+		}
+		if !user.CanAccessBranch(request.FromBranchID) && !user.CanAccessBranch(request.ToBranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if request.Status == to {
+			return nil
+		}
+
+		rule, ok := requestTransitions[request.Status][to]
+		if !ok {
+			failure = fiber.NewError(fiber.StatusConflict, "Cannot change request from "+request.Status+" to "+to)
+			return nil
+		}
+		if !Middleware.HasPermission(user.Role, rule.Permission) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have permission to change request to "+to)
+			return nil
+		}
+		switch rule.Side {
+		case requestSideFrom:
+			if !user.CanAccessBranch(request.FromBranchID) {
+				failure = fiber.NewError(fiber.StatusForbidden, "Only the sending branch can change request to "+to)
+				return nil
+			}
+		case requestSideTo:
+			if !user.CanAccessBranch(request.ToBranchID) {
+				failure = fiber.NewError(fiber.StatusForbidden, "Only the receiving branch can change request to "+to)
+				return nil
+			}
+		}
+
+		var items []Models.RequestItems
+		if err := tx.Where("request_id = ?", request.RequestID).Order("product_id").Find(&items).Error; err != nil {
+			return err
+		}
+		if msg := applyLineQuantities(items, to, lines); msg != "" {
+			failure = fiber.NewError(fiber.StatusBadRequest, msg)
+			return nil
+		}
+		// รายการก่อนหน้าอาจย้าย stock ไปแล้ว ต้องคืน error เพื่อ rollback แทนการ commit บางส่วน
+		if err := applyRequestStock(tx, request, items, to, user.EmployeeID); err != nil {
+			switch {
+			case errors.Is(err, ErrInsufficientStock):
+				failure = fiber.NewError(fiber.StatusConflict, "Not enough stock in sending branch")
+				return failure
+			case errors.Is(err, ErrInventoryNotFound):
+				failure = fiber.NewError(fiber.StatusConflict, "Product not found in sending branch")
+				return failure
+			}
+			return err
+		}
+
+		if err := requestFault("status"); err != nil {
+			return err
+		}
+		from := request.Status
+		request.Status = to
+		request.UpdatedAt = time.Now()
+		request.Items = items
+		if err := tx.Model(&request).Omit(clause.Associations).Select("status", "updated_at").Updates(&request).Error; err != nil {
+			return err
+		}
+		if err := requestFault("transition"); err != nil {
+			return err
+		}
+		return logRequestTransition(tx, request.RequestID, from, to, user.EmployeeID, note)
+	})
+	if failure != nil {
+		return request, failure, nil
+	}
+	return request, failure, err
+}
+
+// เปลี่ยนสถานะของ Request (body: status, note และ items สำหรับจำนวนที่ส่ง/รับจริงเมื่อไม่ครบ)
+func TransitionRequest(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		Status string              `json:"status"`
+		Note   string              `json:"note"`
+		Items  []requestLineUpdate `json:"items"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if req.Status == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Status is required",
+		})
+	}
+
+	request, failure, err := transitionRequest(db, c, c.Params("id"), req.Status, req.Note, req.Items)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update request: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.JSON(fiber.Map{"Data": request})
+}
+
+// ดูประวัติการเปลี่ยนสถานะของ Request
+func LookRequestTransitions(db *gorm.DB, c *fiber.Ctx) error {
+	var request Models.Requests
+	if err := db.Where("request_id = ?", c.Params("id")).First(&request).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Request not found",
+		})
+	}
+	if !canAccessBranch(c, request.FromBranchID, request.ToBranchID) {
+		return branchForbidden(c)
+	}
+
+	var transitions []Models.RequestTransitions
+	if err := db.Where("request_id = ?", request.RequestID).Order("created_at").Find(&transitions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find request transitions: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": transitions})
+}
@@ -0,0 +1,194 @@
+package Database
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+// คำขอโอนสินค้าสองรายการจากสาขา from ไป to พร้อม stock ตั้งต้น
+type transferFixture struct {
+	request  Models.Requests
+	from     Models.Branches
+	to       Models.Branches
+	products []Models.Product // เรียงตาม product_id เหมือนลำดับที่ย้าย stock
+	tokens   map[string]string
+}
+
+func createTransferFixture(t *testing.T, db *gorm.DB, status string) transferFixture {
+	t.Helper()
+	f := transferFixture{
+		from: createTestBranch(t, db),
+		to:   createTestBranch(t, db),
+	}
+	f.products = []Models.Product{createTestProduct(t, db, 50), createTestProduct(t, db, 80)}
+	if f.products[1].ProductID < f.products[0].ProductID {
+		f.products[0], f.products[1] = f.products[1], f.products[0]
+	}
+
+	// สาขาปลายทางมีสินค้าแรกอยู่แล้ว สินค้าที่สองยังไม่มีแถว Inventory
+	createTestInventory(t, db, f.from.BranchID, f.products[0].ProductID, 10)
+	createTestInventory(t, db, f.from.BranchID, f.products[1].ProductID, 10)
+	createTestInventory(t, db, f.to.BranchID, f.products[0].ProductID, 5)
+
+	f.request = Models.Requests{
+		RequestID:    uuid.New().String(),
+		FromBranchID: f.from.BranchID,
+		ToBranchID:   f.to.BranchID,
+		Status:       status,
+	}
+	mustCreate(t, db, &f.request)
+	for i, product := range f.products {
+		item := Models.RequestItems{
+			RequestItemID: uuid.New().String(),
+			RequestID:     f.request.RequestID,
+			ProductID:     product.ProductID,
+			Quantity:      3 + i,
+		}
+		if status == "in_transit" {
+			item.ShippedQuantity = item.Quantity
+		}
+		mustCreate(t, db, &item)
+	}
+
+	f.tokens = map[string]string{
+		"from": testToken(t, createTestEmployee(t, db, "Manager", &f.from.BranchID)),
+		"to":   testToken(t, createTestEmployee(t, db, "Manager", &f.to.BranchID)),
+	}
+	return f
+}
+
+// สถานะของข้อมูลที่การเปลี่ยนสถานะแตะได้ทั้งหมด
+type transferSnapshot struct {
+	Inventory   []Models.Inventory
+	Movements   []Models.StockMovements
+	Items       []Models.RequestItems
+	Status      string
+	Transitions int64
+}
+
+func takeTransferSnapshot(t *testing.T, db *gorm.DB, f transferFixture) transferSnapshot {
+	t.Helper()
+	var s transferSnapshot
+	branches := []string{f.from.BranchID, f.to.BranchID}
+	if err := db.Where("branch_id IN ?", branches).Order("inventory_id").Find(&s.Inventory).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("branch_id IN ?", branches).Order("movement_id").Find(&s.Movements).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("request_id = ?", f.request.RequestID).Order("product_id").Find(&s.Items).Error; err != nil {
+		t.Fatal(err)
+	}
+	var request Models.Requests
+	if err := db.Where("request_id = ?", f.request.RequestID).First(&request).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.Status = request.Status
+	if err := db.Model(&Models.RequestTransitions{}).Where("request_id = ?", f.request.RequestID).Count(&s.Transitions).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// ความผิดพลาดที่ขั้นตอนใดก็ตามของการส่ง/รับสินค้าต้องไม่ทิ้งการย้าย stock บางส่วนไว้
+func TestTransitionRequestFaultLeavesNoPartialStockMovement(t *testing.T) {
+	db := testDB(t)
+	app := fiber.New()
+	app.Use(Middleware.IsAuthenticated(db))
+	RequestRoutes(app, db)
+
+	phases := []struct {
+		from string // สถานะเริ่มต้นของคำขอ
+		to   string
+		side string // สาขาของผู้เปลี่ยนสถานะ
+	}{
+		{"picked", "in_transit", "from"},
+		{"in_transit", "received", "to"},
+	}
+
+	for _, phase := range phases {
+		steps := []func(f transferFixture) string{
+			func(f transferFixture) string { return "stock:" + f.products[0].ProductID },
+			func(f transferFixture) string { return "item:" + f.products[0].ProductID },
+			func(f transferFixture) string { return "stock:" + f.products[1].ProductID },
+			func(f transferFixture) string { return "item:" + f.products[1].ProductID },
+			func(f transferFixture) string { return "status" },
+			func(f transferFixture) string { return "transition" },
+		}
+		names := []string{"stock:first", "item:first", "stock:second", "item:second", "status", "transition"}
+
+		for i, step := range steps {
+			t.Run(phase.to+"/"+names[i], func(t *testing.T) {
+				f := createTransferFixture(t, db, phase.from)
+				before := takeTransferSnapshot(t, db, f)
+
+				target := step(f)
+				fired := false
+				requestFaultHook = func(s string) error {
+					if s == target {
+						fired = true
+						return errInjectedFault
+					}
+					return nil
+				}
+				defer func() { requestFaultHook = nil }()
+
+				status, body, err := doRequest(app, http.MethodPost, "/requests/"+f.request.RequestID+"/transitions", f.tokens[phase.side], fiber.Map{"status": phase.to})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !fired {
+					t.Fatalf("fault %q was never reached (status %d: %s)", target, status, body)
+				}
+				if status != fiber.StatusInternalServerError {
+					t.Fatalf("status = %d, want 500: %s", status, body)
+				}
+
+				after := takeTransferSnapshot(t, db, f)
+				if !reflect.DeepEqual(before, after) {
+					t.Fatalf("state changed after fault at %q\nbefore: %+v\nafter:  %+v", target, before, after)
+				}
+			})
+		}
+
+		// ไม่มี fault ต้องย้าย stock ครบทุกรายการครั้งเดียว
+		t.Run(phase.to+"/no fault", func(t *testing.T) {
+			f := createTransferFixture(t, db, phase.from)
+			before := takeTransferSnapshot(t, db, f)
+
+			status, body, err := doRequest(app, http.MethodPost, "/requests/"+f.request.RequestID+"/transitions", f.tokens[phase.side], fiber.Map{"status": phase.to})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != fiber.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", status, body)
+			}
+
+			after := takeTransferSnapshot(t, db, f)
+			if after.Status != phase.to {
+				t.Fatalf("request status = %q, want %q", after.Status, phase.to)
+			}
+			if after.Transitions != before.Transitions+1 {
+				t.Fatalf("transitions = %d, want %d", after.Transitions, before.Transitions+1)
+			}
+			if moved := len(after.Movements) - len(before.Movements); moved != len(f.products) {
+				t.Fatalf("stock movements added = %d, want %d", moved, len(f.products))
+			}
+			for _, inventory := range after.Inventory {
+				if total := ledgerTotal(t, db, inventory.InventoryID); total != inventory.Quantity {
+					t.Fatalf("inventory %s quantity %d does not match ledger %d", inventory.InventoryID, inventory.Quantity, total)
+				}
+			}
+		})
+	}
+}
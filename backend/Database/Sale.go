@@ -1,22 +1,241 @@
 package Database
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"math"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
 	"github.com/posproject/Models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// SaleLineError รายละเอียดของรายการขายที่ข้อมูลไม่ตรงกับราคาในระบบ
+type SaleLineError struct {
+	Line        int     `json:"line"`
+	ProductID   string  `json:"productid"`
+	Reason      string  `json:"reason"`
+	ClientValue float64 `json:"clientvalue,omitempty"`
+	ServerValue float64 `json:"servervalue,omitempty"`
+}
+
+// ปัดเศษจำนวนเงินให้เหลือ 2 ตำแหน่ง (สตางค์)
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// เปรียบเทียบจำนวนเงินโดยยอมให้คลาดเคลื่อนไม่เกินครึ่งสตางค์
+func moneyEqual(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// salePricing ผลการคำนวณราคาและภาษีของการขายทั้งบิล
+type salePricing struct {
+	Items          []Models.SaleItems
+	GrossAmount    float64 // ยอดตามราคาป้ายก่อนหักส่วนลด
+	DiscountAmount float64 // ส่วนลดรวม (โปรโมชัน + ส่วนลดเอง)
+	ManualDiscount float64 // ส่วนลดที่พนักงานให้เอง (รายการ + ท้ายบิล)
+	TotalAmount    float64 // ยอดรวม VAT
+	NetAmount      float64 // ยอดก่อน VAT
+	VatAmount      float64
+}
+
+// saleDiscounts ส่วนลดที่ใช้กับการขายทั้งบิล
+type saleDiscounts struct {
+	Promotions   []Models.Promotions // โปรโมชันที่ใช้ได้ ณ เวลาที่ขาย เรียงตาม priority
+	BillDiscount float64             // ส่วนลดท้ายบิล (บาท)
+}
+
+// คำนวณราคา ส่วนลด และ VAT ของแต่ละรายการขายจากราคาสินค้าและการตั้งค่าภาษีในระบบ
+// ราคาที่ client ส่งมาใช้เพื่อตรวจสอบเท่านั้น ถ้าส่งมาแล้วไม่ตรงจะถูกรายงานใน lineErrors
+// ลำดับการลด: โปรโมชัน -> ส่วนลดรายการ (manualdiscount) -> ส่วนลดท้ายบิล แล้วจึงคิด VAT จากยอดหลังหักส่วนลด
+func priceSaleItems(tx *gorm.DB, items []Models.SaleItems, discounts saleDiscounts) (salePricing, []SaleLineError, error) {
+	var pricing salePricing
+
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	var products []Models.Product
+	if err := tx.Where("product_id IN ?", productIDs).Find(&products).Error; err != nil {
+		return pricing, nil, err
+	}
+	productByID := make(map[string]Models.Product, len(products))
+	categoryIDs := make([]string, 0, len(products))
+	for _, product := range products {
+		productByID[product.ProductID] = product
+		if product.CategoryID != "" {
+			categoryIDs = append(categoryIDs, product.CategoryID)
+		}
+	}
+
+	var categories []Models.Category
+	if len(categoryIDs) > 0 {
+		if err := tx.Where("category_id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+			return pricing, nil, err
+		}
+	}
+	categoryByID := make(map[string]*Models.Category, len(categories))
+	for i := range categories {
+		categoryByID[categories[i].CategoryID] = &categories[i]
+	}
+
+	// ยอดของแต่ละรายการหลังหักส่วนลด (ก่อนคิด VAT)
+	type pricedLine struct {
+		line   int
+		item   Models.SaleItems
+		amount float64
+		rule   taxRule
+	}
+
+	// โปรโมชันคิดจากจำนวนรวมของสินค้าเดียวกันทั้งบิล (สแกนสินค้าเดียวกันหลายบรรทัดยังได้ซื้อ X แถม Y/ราคาชุด)
+	// แล้วกระจายส่วนลดกลับไปแต่ละบรรทัดตามจำนวน (บรรทัดสุดท้ายรับเศษที่เหลือ)
+	quantityByProduct := make(map[string]int)
+	for _, item := range items {
+		if _, ok := productByID[item.ProductID]; ok && item.Quantity > 0 {
+			quantityByProduct[item.ProductID] += item.Quantity
+		}
+	}
+	type linePromotion struct {
+		promotion *Models.Promotions
+		discount  float64
+	}
+	promotionByLine := make(map[int]linePromotion)
+	for productID, quantity := range quantityByProduct {
+		product := productByID[productID]
+		promotion, discount := bestPromotion(discounts.Promotions, product, quantity)
+		if promotion == nil {
+			continue
+		}
+		remaining, remainingQuantity := discount, quantity
+		for i, item := range items {
+			if item.ProductID != productID || item.Quantity <= 0 {
+				continue
+			}
+			share := remaining
+			if item.Quantity < remainingQuantity {
+				share = roundMoney(discount * float64(item.Quantity) / float64(quantity))
+			}
+			if lineAmount := roundMoney(product.Price * float64(item.Quantity)); share > lineAmount {
+				share = lineAmount
+			}
+			promotionByLine[i] = linePromotion{promotion: promotion, discount: share}
+			remaining = roundMoney(remaining - share)
+			remainingQuantity -= item.Quantity
+		}
+	}
+
+	var lineErrors []SaleLineError
+	lines := make([]pricedLine, 0, len(items))
+	var discountedTotal float64
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			lineErrors = append(lineErrors, SaleLineError{Line: i, ProductID: item.ProductID, Reason: "invalid quantity", ClientValue: float64(item.Quantity)})
+			continue
+		}
+
+		product, ok := productByID[item.ProductID]
+		if !ok {
+			lineErrors = append(lineErrors, SaleLineError{Line: i, ProductID: item.ProductID, Reason: "product not found"})
+			continue
+		}
+
+		// ยอดตามราคาป้าย (ก่อนหักส่วนลดและก่อนบวก VAT กรณีราคาไม่รวม VAT)
+		lineAmount := roundMoney(product.Price * float64(item.Quantity))
+		if item.Price != 0 && !moneyEqual(item.Price, product.Price) {
+			lineErrors = append(lineErrors, SaleLineError{Line: i, ProductID: item.ProductID, Reason: "price mismatch", ClientValue: item.Price, ServerValue: product.Price})
+		}
+
+		// ส่วนแบ่งของโปรโมชันที่ดีที่สุดของสินค้านี้
+		item.PromotionID = nil
+		item.PromotionDiscount = 0
+		if applied, ok := promotionByLine[i]; ok {
+			item.PromotionID = &applied.promotion.PromotionID
+			item.PromotionDiscount = applied.discount
+		}
+
+		// ส่วนลดรายการที่พนักงานให้เอง
+		item.ManualDiscount = roundMoney(item.ManualDiscount)
+		if item.ManualDiscount < 0 || item.ManualDiscount > roundMoney(lineAmount-item.PromotionDiscount) {
+			lineErrors = append(lineErrors, SaleLineError{Line: i, ProductID: item.ProductID, Reason: "invalid manual discount", ClientValue: item.ManualDiscount, ServerValue: roundMoney(lineAmount - item.PromotionDiscount)})
+			continue
+		}
+
+		item.Price = product.Price
+		amount := roundMoney(lineAmount - item.PromotionDiscount - item.ManualDiscount)
+		lines = append(lines, pricedLine{line: i, item: item, amount: amount, rule: resolveTaxRule(product, categoryByID[product.CategoryID])})
+		pricing.GrossAmount += lineAmount
+		discountedTotal += amount
+	}
+
+	// กระจายส่วนลดท้ายบิลตามสัดส่วนยอดของแต่ละรายการ (รายการสุดท้ายรับเศษที่เหลือ)
+	billDiscount := roundMoney(discounts.BillDiscount)
+	if billDiscount < 0 || billDiscount > roundMoney(discountedTotal) {
+		lineErrors = append(lineErrors, SaleLineError{Line: -1, Reason: "invalid bill discount", ClientValue: billDiscount, ServerValue: roundMoney(discountedTotal)})
+		billDiscount = 0
+	}
+	remainingBill := billDiscount
+	for i := range lines {
+		if remainingBill <= 0 {
+			break
+		}
+		share := roundMoney(billDiscount * lines[i].amount / discountedTotal)
+		if i == len(lines)-1 || share > remainingBill {
+			share = remainingBill
+		}
+		if share > lines[i].amount {
+			share = lines[i].amount
+		}
+		lines[i].amount = roundMoney(lines[i].amount - share)
+		lines[i].item.ManualDiscount = roundMoney(lines[i].item.ManualDiscount + share)
+		remainingBill = roundMoney(remainingBill - share)
+	}
+
+	// ใช้ราคาและภาษีจากระบบเสมอ โดยคิด VAT จากยอดหลังหักส่วนลด
+	pricing.Items = make([]Models.SaleItems, 0, len(lines))
+	for _, line := range lines {
+		item := line.item
+		net, vat, total := computeLineTax(line.amount, line.rule)
+		// TotalPrice ที่ client ส่งมาต้องตรงกับยอดที่บันทึกจริง (หลังหักส่วนลดและรวม VAT)
+		if item.TotalPrice != 0 && !moneyEqual(item.TotalPrice, total) {
+			lineErrors = append(lineErrors, SaleLineError{Line: line.line, ProductID: item.ProductID, Reason: "total mismatch", ClientValue: item.TotalPrice, ServerValue: total})
+		}
+		item.TotalPrice = total
+		item.VatRate = line.rule.Rate
+		item.NetAmount = net
+		item.VatAmount = vat
+		pricing.Items = append(pricing.Items, item)
+		pricing.DiscountAmount += item.PromotionDiscount + item.ManualDiscount
+		pricing.ManualDiscount += item.ManualDiscount
+		pricing.TotalAmount += total
+		pricing.NetAmount += net
+		pricing.VatAmount += vat
+	}
+
+	pricing.GrossAmount = roundMoney(pricing.GrossAmount)
+	pricing.DiscountAmount = roundMoney(pricing.DiscountAmount)
+	pricing.ManualDiscount = roundMoney(pricing.ManualDiscount)
+	pricing.TotalAmount = roundMoney(pricing.TotalAmount)
+	pricing.NetAmount = roundMoney(pricing.NetAmount)
+	pricing.VatAmount = roundMoney(pricing.VatAmount)
+	return pricing, lineErrors, nil
+}
+
 // เพิ่ม Sale พร้อม SaleItems, สร้างใบเสร็จและอัปเดต Inventory
 func AddSale(db *gorm.DB, c *fiber.Ctx) error {
 	type SaleRequest struct {
-		EmployeeID string             `json:"employeeid"`
-		BranchID   string             `json:"branchid"`
-		SaleItems  []Models.SaleItems `json:"saleitems"`
+		BranchID      string             `json:"branchid"`
+		SaleItems     []Models.SaleItems `json:"saleitems"`
+		TotalAmount   *float64           `json:"totalamount"` // ยอดรวมที่ client คำนวณไว้ (ใช้ตรวจสอบเท่านั้น)
+		Payments      []TenderRequest    `json:"payments"`
+		CustomerID    string             `json:"customerid"`    // ลูกค้าสมาชิก (ไม่บังคับ)
+		CustomerPhone string             `json:"customerphone"` // ใช้แทน customerid ได้
+		BillDiscount  float64            `json:"billdiscount"`  // ส่วนลดท้ายบิล (บาท)
 	}
 
 	var req SaleRequest
@@ -26,24 +245,152 @@ func AddSale(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
-	// คำนวณยอดขายรวม
-	var totalAmount float64
-	for _, item := range req.SaleItems {
-		totalAmount += item.TotalPrice
+	// พนักงานและสาขาของการขายมาจาก token ไม่ใช้ค่าที่ส่งมาใน body
+	branchID, ok := writeBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	if branchID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "BranchID is required",
+		})
+	}
+	req.BranchID = branchID
+	employeeID := Middleware.CurrentUser(c).EmployeeID
+	if employeeID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Employee is required",
+		})
+	}
+
+	if len(req.SaleItems) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sale must have at least one item",
+		})
+	}
+
+	// โปรโมชันที่ใช้ได้กับสาขา ณ เวลาที่ขาย
+	now := time.Now()
+	promotions, err := loadActivePromotions(db, req.BranchID, now)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load promotions: " + err.Error(),
+		})
+	}
+
+	// คำนวณราคา ส่วนลด และยอดขายรวมจากราคาสินค้าในระบบ
+	pricing, lineErrors, err := priceSaleItems(db, req.SaleItems, saleDiscounts{Promotions: promotions, BillDiscount: req.BillDiscount})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load product prices: " + err.Error(),
+		})
+	}
+	if len(lineErrors) > 0 || (req.TotalAmount != nil && !moneyEqual(*req.TotalAmount, pricing.TotalAmount)) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":       "Sale items do not match server prices",
+			"lines":       lineErrors,
+			"totalamount": pricing.TotalAmount,
+		})
+	}
+	saleItems := pricing.Items
+	totalAmount := pricing.TotalAmount
+
+	// ส่วนลดที่พนักงานให้เองต้องไม่เกินเพดานของ role
+	if pricing.ManualDiscount > 0 {
+		role := claimString(c, "role")
+		limit := roundMoney(pricing.GrossAmount * manualDiscountLimits[role] / 100)
+		if pricing.ManualDiscount > limit {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": fmt.Sprintf("Manual discount of %.2f exceeds the %.0f%% limit for role %s", pricing.ManualDiscount, manualDiscountLimits[role], role),
+			})
+		}
+	}
+
+	// ตรวจสอบว่าการชำระเงินครอบคลุมยอดขาย และคำนวณเงินทอน
+	payments, change, err := allocateTenders(totalAmount, req.Payments)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "Invalid payment: " + err.Error(),
+			"totalamount": totalAmount,
+		})
+	}
+
+	// หาลูกค้าสมาชิกจาก ID หรือเบอร์โทร
+	var customerID *string
+	if req.CustomerID != "" || req.CustomerPhone != "" {
+		var customer Models.Customers
+		query := db.Where("customer_id = ?", req.CustomerID)
+		if req.CustomerID == "" {
+			query = db.Where("phone = ?", normalizePhone(req.CustomerPhone))
+		}
+		if err := query.First(&customer).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Customer not found",
+			})
+		}
+		customerID = &customer.CustomerID
+	}
+	for _, payment := range payments {
+		if payment.Method == "points" && customerID == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Points payment requires a customer",
+			})
+		}
 	}
 
 	// สร้าง Sales
 	sale := Models.Sales{
-		SaleID:      uuid.New().String(),
-		EmployeeID:  req.EmployeeID,
-		BranchID:    req.BranchID,
-		TotalAmount: totalAmount,
-		CreatedAt:   time.Now(),
+		SaleID:         uuid.New().String(),
+		EmployeeID:     employeeID,
+		BranchID:       req.BranchID,
+		TotalAmount:    totalAmount,
+		NetAmount:      pricing.NetAmount,
+		VatAmount:      pricing.VatAmount,
+		DiscountAmount: pricing.DiscountAmount,
+		BillDiscount:   roundMoney(req.BillDiscount),
+		Status:         "completed",
+		CustomerID:     customerID,
+		CreatedAt:      now,
 	}
 
 	// ใช้ Transaction เพื่อความปลอดภัย
 	tx := db.Begin()
 
+	// การขายต้องอยู่ในกะที่เปิดอยู่ของพนักงาน (lock แบบ share เพื่อไม่ให้ปิดกะระหว่างขาย)
+	shift, err := lockOpenShift(tx, sale.EmployeeID, sale.BranchID, "SHARE")
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, ErrNoOpenShift) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "No open shift. Open a shift before selling",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load shift: " + err.Error(),
+		})
+	}
+	sale.ShiftID = &shift.ShiftID
+
+	// ตัดแต้มที่ใช้ชำระ และคำนวณแต้มที่ได้รับจากยอดที่ไม่ได้ชำระด้วยแต้ม
+	var customer Models.Customers
+	if customerID != nil {
+		customer, err = lockCustomer(tx, *customerID)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load customer: " + err.Error(),
+			})
+		}
+		redeemed, err := redeemPointsTenders(tx, &customer, sale.SaleID, payments)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid points payment: " + err.Error(),
+			})
+		}
+		sale.PointsEarned = pointsForAmount(totalAmount-redeemed, customer.Tier)
+	}
+
 	if err := tx.Create(&sale).Error; err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -51,8 +398,27 @@ func AddSale(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	if err := postPoints(tx, &customer, sale.PointsEarned, "earn", &sale.SaleID, nil); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record points: " + err.Error(),
+		})
+	}
+
+	// บันทึกการชำระเงิน
+	for i := range payments {
+		payments[i].SaleID = sale.SaleID
+		payments[i].CreatedAt = sale.CreatedAt
+		if err := tx.Create(&payments[i]).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create payment: " + err.Error(),
+			})
+		}
+	}
+
 	// เพิ่ม SaleItems และอัปเดต Inventory
-	for _, item := range req.SaleItems {
+	for _, item := range saleItems {
 		item.SaleID = sale.SaleID
 		if err := tx.Create(&item).Error; err != nil {
 			tx.Rollback()
@@ -61,41 +427,50 @@ func AddSale(db *gorm.DB, c *fiber.Ctx) error {
 			})
 		}
 
-		// อัปเดต Inventory
-		var inventory Models.Inventory
-		if err := tx.Where("product_id = ? AND branch_id = ?", item.ProductID, sale.BranchID).First(&inventory).Error; err == nil {
-			if inventory.Quantity < item.Quantity {
-				tx.Rollback()
+		// ตัด stock แบบ atomic เพื่อไม่ให้ขายเกินจำนวนที่มีเมื่อ checkout พร้อมกัน
+		if _, err := decrementInventory(tx, sale.BranchID, item.ProductID, item.Quantity, stockRef{
+			Type:          "sale",
+			ReferenceType: "sale",
+			ReferenceID:   sale.SaleID,
+			EmployeeID:    sale.EmployeeID,
+		}); err != nil {
+			tx.Rollback()
+			switch {
+			case errors.Is(err, ErrInventoryNotFound):
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Inventory not found for product: " + item.ProductID,
+				})
+			case errors.Is(err, ErrInsufficientStock):
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 					"error": "Not enough inventory for product: " + item.ProductID,
 				})
-			}
-			inventory.Quantity -= item.Quantity
-			inventory.UpdatedAt = time.Now()
-			if err := tx.Save(&inventory).Error; err != nil {
-				tx.Rollback()
+			default:
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"error": "Failed to update inventory: " + err.Error(),
 				})
 			}
-		} else {
-			tx.Rollback()
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Inventory not found for product: " + item.ProductID,
-			})
 		}
 	}
 
-	// สร้างหมายเลขใบเสร็จ
-	rand.Seed(time.Now().UnixNano())                               // ตั้งค่า Seed ให้สุ่มได้ทุกครั้ง
-	receiptNumber := fmt.Sprintf("R%010d", rand.Intn(10000000000)) // สุ่มตัวเลข 5 หลัก
+	// สร้างหมายเลขใบเสร็จแบบเรียงลำดับต่อสาขาต่อวัน (จองภายใน Transaction)
+	receiptNumber, err := generateReceiptNumber(tx, sale.BranchID, sale.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate receipt number: " + err.Error(),
+		})
+	}
 
 	receipt := Models.Receipts{
-		SaleID:        sale.SaleID,
-		BranchID:      sale.BranchID,
-		ReceiptNumber: receiptNumber,
-		TotalAmount:   totalAmount,
-		ReceiptDate:   time.Now(),
+		SaleID:         sale.SaleID,
+		BranchID:       sale.BranchID,
+		ReceiptNumber:  receiptNumber,
+		TotalAmount:    totalAmount,
+		NetAmount:      pricing.NetAmount,
+		VatAmount:      pricing.VatAmount,
+		DiscountAmount: pricing.DiscountAmount,
+		ReceiptDate:    time.Now(),
+		ReceiptType:    "sale",
 	}
 
 	if err := tx.Create(&receipt).Error; err != nil {
@@ -106,13 +481,18 @@ func AddSale(db *gorm.DB, c *fiber.Ctx) error {
 	}
 
 	// สร้าง ReceiptItems
-	for _, item := range req.SaleItems {
+	for _, item := range saleItems {
 		receiptItem := Models.ReceiptItems{
-			ReceiptID:  receipt.ReceiptID,
-			ProductID:  item.ProductID,
-			Quantity:   item.Quantity,
-			UnitPrice:  item.Price, // ใช้ราคาจาก SaleItems
-			TotalPrice: item.TotalPrice,
+			ReceiptID:      receipt.ReceiptID,
+			ProductID:      item.ProductID,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.Price, // ใช้ราคาจาก SaleItems
+			TotalPrice:     item.TotalPrice,
+			VatRate:        item.VatRate,
+			NetAmount:      item.NetAmount,
+			VatAmount:      item.VatAmount,
+			PromotionID:    item.PromotionID,
+			DiscountAmount: roundMoney(item.PromotionDiscount + item.ManualDiscount),
 		}
 		if err := tx.Create(&receiptItem).Error; err != nil {
 			tx.Rollback()
@@ -122,18 +502,28 @@ func AddSale(db *gorm.DB, c *fiber.Ctx) error {
 		}
 	}
 
-	tx.Commit()
+	// เลขใบเสร็จ การชำระเงิน และการตัด stock มีผลเมื่อ commit สำเร็จเท่านั้น
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save sale: " + err.Error(),
+		})
+	}
+
+	receipt.Payments = payments
+	receipt.ChangeDue = change
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Sale and receipt created successfully",
 		"sale":    sale,
 		"receipt": receipt,
+		"change":  change,
+		"points":  sale.PointsEarned,
 	})
 }
 
 // ดู Sales ทั้งหมด
 func LookSales(db *gorm.DB, c *fiber.Ctx) error {
 	var sales []Models.Sales
-	if err := db.Find(&sales).Error; err != nil {
+	if err := scopeBranch(c, db, "branch_id").Find(&sales).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to find sales: " + err.Error(),
 		})
@@ -150,92 +540,79 @@ func FindSale(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Sale not found",
 		})
 	}
-	return c.JSON(fiber.Map{"Data": sale})
-}
-
-// อัปเดต Sale
-func UpdateSale(db *gorm.DB, c *fiber.Ctx) error {
-	id := c.Params("id")
-	var sale Models.Sales
-	if err := db.Where("sale_id = ?", id).First(&sale).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Sale not found",
-		})
-	}
-
-	var req Models.Sales
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid JSON format: " + err.Error(),
-		})
-	}
-
-	sale.EmployeeID = req.EmployeeID
-	sale.BranchID = req.BranchID
-	sale.TotalAmount = req.TotalAmount
-	sale.CreatedAt = time.Now()
-
-	if err := db.Save(&sale).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update sale: " + err.Error(),
-		})
+	if !canAccessBranch(c, sale.BranchID) {
+		return branchForbidden(c)
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Updated": "Succeed"})
+	return c.JSON(fiber.Map{"Data": sale})
 }
 
-// ลบ Sale และข้อมูลที่เกี่ยวข้อง
+// ลบ Sale ที่ไม่มีข้อมูลทางบัญชีผูกอยู่ออกจากระบบถาวร (เฉพาะ Super Admin) เช่น ข้อมูลทดสอบหรือข้อมูลเก่าก่อนมี ledger
+// การขายที่มีการชำระเงิน แต้ม stock movement ใบกำกับภาษี การคืนเงิน หรืออยู่ในกะ ต้องใช้ POST /sales/:id/void แทน
+// เพื่อเก็บประวัติและคืน stock
 func DeleteSale(db *gorm.DB, c *fiber.Ctx) error {
-	id := c.Params("id") // รับ sale_id
-
-	// ค้นหา Sale
-	var sale Models.Sales
-	if err := db.Where("sale_id = ?", id).First(&sale).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Sale not found",
+	if claimString(c, "role") != "Super Admin" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only Super Admin can delete sales, use void or refund instead",
 		})
 	}
 
-	// ใช้ Transaction เพื่อความปลอดภัย
-	tx := db.Begin()
+	id := c.Params("id") // รับ sale_id
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// ค้นหา Sale
+		var sale Models.Sales
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sale_id = ?", id).First(&sale).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Sale not found")
+			return nil
+		}
 
-	// ค้นหา receipt_id ที่เกี่ยวข้องกับ sale_id
-	var receipt Models.Receipts
-	if err := tx.Where("sale_id = ?", id).First(&receipt).Error; err == nil {
-		// ลบ ReceiptItems ที่มี receipt_id นี้
-		if err := tx.Where("receipt_id = ?", receipt.ReceiptID).Delete(&Models.ReceiptItems{}).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to delete receipt items: " + err.Error(),
-			})
+		// ข้อมูลที่อ้างอิงการขายนี้ ถ้ามีอยู่ต้อง void แทนการลบ
+		if sale.ShiftID != nil {
+			failure = fiber.NewError(fiber.StatusConflict, "Sale belongs to a shift, void it instead")
+			return nil
+		}
+		dependents := []struct {
+			name  string
+			query *gorm.DB
+		}{
+			{"payments", tx.Model(&Models.Payments{}).Where("sale_id = ?", id)},
+			{"points", tx.Model(&Models.PointsLedger{}).Where("sale_id = ?", id)},
+			{"stock movements", tx.Model(&Models.StockMovements{}).Where("reference_type = ? AND reference_id = ?", "sale", id)},
+			{"tax invoices", tx.Model(&Models.TaxInvoices{}).Where("sale_id = ?", id)},
+			{"refunds", tx.Model(&Models.Refunds{}).Where("sale_id = ?", id)},
+		}
+		for _, dependent := range dependents {
+			var count int64
+			if err := dependent.query.Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				failure = fiber.NewError(fiber.StatusConflict, "Sale has "+dependent.name+", void it instead")
+				return nil
+			}
 		}
 
-		// ลบ Receipts
+		// ลบ ReceiptItems, Receipts, SaleItems และ Sale
+		receiptIDs := tx.Model(&Models.Receipts{}).Select("receipt_id").Where("sale_id = ?", id)
+		if err := tx.Where("receipt_id IN (?)", receiptIDs).Delete(&Models.ReceiptItems{}).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("sale_id = ?", id).Delete(&Models.Receipts{}).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to delete receipt: " + err.Error(),
-			})
+			return err
 		}
-	}
-
-	// ลบ SaleItems ที่เกี่ยวข้อง
-	if err := tx.Where("sale_id = ?", id).Delete(&Models.SaleItems{}).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete sale items: " + err.Error(),
-		})
-	}
-
-	// ลบ Sale
-	if err := tx.Delete(&sale).Error; err != nil {
-		tx.Rollback()
+		if err := tx.Where("sale_id = ?", id).Delete(&Models.SaleItems{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&sale).Error
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete sale: " + err.Error(),
 		})
 	}
-
-	tx.Commit()
-
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"Deleted": "Succeed"})
 }
 
@@ -250,9 +627,6 @@ func SaleRoutes(app *fiber.App, db *gorm.DB) {
 	app.Post("/sales", func(c *fiber.Ctx) error {
 		return AddSale(db, c)
 	})
-	app.Put("/sales/:id", func(c *fiber.Ctx) error {
-		return UpdateSale(db, c)
-	})
 	app.Delete("/sales/:id", func(c *fiber.Ctx) error {
 		return DeleteSale(db, c)
 	})
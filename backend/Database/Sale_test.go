@@ -0,0 +1,97 @@
+package Database
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+)
+
+// แคชเชียร์หลายคนขายสินค้าชิ้นสุดท้ายพร้อมกัน ต้องขายได้ไม่เกินจำนวนที่มีและ stock ต้องไม่ติดลบ
+func TestAddSaleConcurrentCheckoutNeverOversells(t *testing.T) {
+	db := testDB(t)
+	app := fiber.New()
+	app.Use(Middleware.IsAuthenticated(db))
+	SaleRoutes(app, db)
+
+	const stock = 3
+	const cashiers = 12
+	branch := createTestBranch(t, db)
+	product := createTestProduct(t, db, 100)
+	inventory := createTestInventory(t, db, branch.BranchID, product.ProductID, stock)
+
+	tokens := make([]string, cashiers)
+	for i := range tokens {
+		employee := createTestEmployee(t, db, "Cashier", &branch.BranchID)
+		openTestShift(t, db, employee)
+		tokens[i] = testToken(t, employee)
+	}
+
+	body := fiber.Map{
+		"saleitems": []fiber.Map{{"productid": product.ProductID, "quantity": 1}},
+		"payments":  []fiber.Map{{"method": "cash", "amount": 1000}},
+	}
+
+	statuses := make([]int, cashiers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			status, respBody, err := doRequest(app, http.MethodPost, "/sales", tokens[i], body)
+			if err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+			if status != fiber.StatusOK && status != fiber.StatusBadRequest {
+				t.Errorf("request %d: status %d: %s", i, status, respBody)
+			}
+			statuses[i] = status
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, status := range statuses {
+		if status == fiber.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != stock {
+		t.Fatalf("successful sales = %d, want %d (statuses %v)", succeeded, stock, statuses)
+	}
+
+	var after Models.Inventory
+	if err := db.Where("inventory_id = ?", inventory.InventoryID).First(&after).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Quantity != 0 {
+		t.Fatalf("inventory quantity = %d, want 0", after.Quantity)
+	}
+	if total := ledgerTotal(t, db, inventory.InventoryID); total != after.Quantity {
+		t.Fatalf("ledger total = %d, inventory quantity = %d", total, after.Quantity)
+	}
+
+	var sales int64
+	if err := db.Model(&Models.Sales{}).Where("branch_id = ?", branch.BranchID).Count(&sales).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sales != stock {
+		t.Fatalf("sales recorded = %d, want %d", sales, stock)
+	}
+
+	// ไม่มี movement ใดทำให้ยอดคงเหลือติดลบ
+	var negative int64
+	if err := db.Model(&Models.StockMovements{}).Where("inventory_id = ? AND balance_after < 0", inventory.InventoryID).Count(&negative).Error; err != nil {
+		t.Fatal(err)
+	}
+	if negative > 0 {
+		t.Fatalf("%d stock movements left a negative balance", negative)
+	}
+}
@@ -0,0 +1,81 @@
+package Database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// จองเลขลำดับถัดไปของ scope และ period ที่กำหนด
+// ต้องเรียกภายใน Transaction เดียวกับการสร้างเอกสาร: แถวของ counter จะถูก lock จนกว่าจะ commit
+// ทำให้ checkout พร้อมกันได้เลขไม่ซ้ำ และถ้า rollback เลขที่จองไว้จะถูกคืนด้วย (ไม่มีเลขข้าม)
+func nextSequence(tx *gorm.DB, scope string, period string) (int64, error) {
+	var value int64
+	err := tx.Raw(`
+		INSERT INTO "SequenceCounters" (scope, period, last_value, updated_at)
+		VALUES (?, ?, 1, NOW())
+		ON CONFLICT (scope, period)
+		DO UPDATE SET last_value = "SequenceCounters".last_value + 1, updated_at = NOW()
+		RETURNING last_value`, scope, period).Scan(&value).Error
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// ดึงรหัสสาขาสำหรับใช้ในเลขเอกสาร ถ้าสาขายังไม่มีรหัสจะใช้ 8 ตัวแรกของ BranchID แทน
+func branchCode(tx *gorm.DB, branchID string) (string, error) {
+	var branch Models.Branches
+	if err := tx.Where("branch_id = ?", branchID).First(&branch).Error; err != nil {
+		return "", fmt.Errorf("branch %s not found: %w", branchID, err)
+	}
+	if branch.BranchCode != "" {
+		return branch.BranchCode, nil
+	}
+	code := strings.ReplaceAll(branch.BranchID, "-", "")
+	if len(code) > 8 {
+		code = code[:8]
+	}
+	return strings.ToUpper(code), nil
+}
+
+// สร้างเลขเอกสารของสาขาแบบรายวัน เช่น BKK01-20261018-000123
+func nextBranchDocumentNumber(tx *gorm.DB, kind string, prefix string, branchID string, at time.Time) (string, error) {
+	code, err := branchCode(tx, branchID)
+	if err != nil {
+		return "", err
+	}
+	day := at.Format("20060102")
+	seq, err := nextSequence(tx, kind+":"+branchID, day)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s-%s-%06d", prefix, code, day, seq), nil
+}
+
+// สร้างหมายเลขใบเสร็จ เช่น BKK01-20261018-000123
+func generateReceiptNumber(tx *gorm.DB, branchID string, at time.Time) (string, error) {
+	return nextBranchDocumentNumber(tx, "receipt", "", branchID, at)
+}
+
+// สร้างหมายเลข Shipment เช่น SHIP-BKK01-20261018-000001
+func generateShipmentNumber(tx *gorm.DB, branchID string, at time.Time) (string, error) {
+	return nextBranchDocumentNumber(tx, "shipment", "SHIP-", branchID, at)
+}
+
+// สร้างเลขใบกำกับภาษีเต็มรูปแบบเรียงลำดับต่อสาขาต่อปี เช่น INV-BKK01-2026-000001
+func generateTaxInvoiceNumber(tx *gorm.DB, branchID string, at time.Time) (string, error) {
+	code, err := branchCode(tx, branchID)
+	if err != nil {
+		return "", err
+	}
+	year := at.Format("2006")
+	seq, err := nextSequence(tx, "taxinvoice:"+branchID, year)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INV-%s-%s-%06d", code, year, seq), nil
+}
@@ -0,0 +1,506 @@
+package Database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ธนบัตรและเหรียญไทยที่ใช้นับเงินตอนปิดกะ
+var thaiDenominations = []float64{1000, 500, 100, 50, 20, 10, 5, 2, 1, 0.5, 0.25}
+
+// ErrNoOpenShift พนักงานยังไม่ได้เปิดกะที่สาขานี้
+var ErrNoOpenShift = errors.New("no open shift")
+
+// TenderSummary ยอดรวมของช่องทางชำระเงิน/คืนเงินหนึ่งช่องทางในกะ
+type TenderSummary struct {
+	Method string  `json:"method"`
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// DenominationCount จำนวนธนบัตร/เหรียญที่นับได้
+type DenominationCount struct {
+	Denomination float64 `json:"denomination"`
+	Quantity     int     `json:"quantity"`
+}
+
+// ShiftReport รายงาน X (ระหว่างกะ) หรือ Z (ปิดกะ)
+type ShiftReport struct {
+	Type         string                   `json:"type"` // X, Z
+	Shift        Models.Shifts            `json:"shift"`
+	SalesCount   int                      `json:"salescount"`
+	SalesTotal   float64                  `json:"salestotal"`
+	VoidCount    int                      `json:"voidcount"`
+	Tenders      []TenderSummary          `json:"tenders"`
+	RefundCount  int                      `json:"refundcount"`
+	RefundTotal  float64                  `json:"refundtotal"`
+	Refunds      []TenderSummary          `json:"refunds"`
+	OpeningFloat float64                  `json:"openingfloat"`
+	CashSales    float64                  `json:"cashsales"` // เงินสดที่รับจริง (หักเงินทอนแล้ว)
+	CashRefunds  float64                  `json:"cashrefunds"`
+	PayIns       float64                  `json:"payins"`
+	PayOuts      float64                  `json:"payouts"`
+	ExpectedCash float64                  `json:"expectedcash"`
+	CountedCash  *float64                 `json:"countedcash"`
+	Variance     *float64                 `json:"variance"`
+	Counts       []Models.ShiftCashCounts `json:"counts,omitempty"`
+	GeneratedAt  time.Time                `json:"generatedat"`
+}
+
+// หากะที่เปิดอยู่ของพนักงานที่สาขา พร้อม lock แถวตาม strength ("SHARE" หรือ "UPDATE")
+func lockOpenShift(tx *gorm.DB, employeeID string, branchID string, strength string) (Models.Shifts, error) {
+	var shifts []Models.Shifts
+	if err := tx.Clauses(clause.Locking{Strength: strength}).
+		Where("employee_id = ? AND branch_id = ? AND status = ?", employeeID, branchID, "open").
+		Limit(1).Find(&shifts).Error; err != nil {
+		return Models.Shifts{}, err
+	}
+	if len(shifts) == 0 {
+		return Models.Shifts{}, ErrNoOpenShift
+	}
+	return shifts[0], nil
+}
+
+// ผู้ใช้จัดการกะนี้ได้หรือไม่ (เจ้าของกะ หรือผู้มีสิทธิ์ shifts:manage ในสาขาเดียวกัน)
+func canManageShift(c *fiber.Ctx, shift Models.Shifts) bool {
+	user := Middleware.CurrentUser(c)
+	if !user.CanAccessBranch(shift.BranchID) {
+		return false
+	}
+	return user.EmployeeID == shift.EmployeeID || Middleware.HasPermission(user.Role, Middleware.PermShiftsManage)
+}
+
+// คำนวณรายงานของกะจากการขาย การคืนเงิน และการนำเงินเข้า/ออกที่ผูกกับกะ
+func buildShiftReport(tx *gorm.DB, shift Models.Shifts) (ShiftReport, error) {
+	report := ShiftReport{
+		Type:         "X",
+		Shift:        shift,
+		OpeningFloat: shift.OpeningFloat,
+		Tenders:      []TenderSummary{},
+		Refunds:      []TenderSummary{},
+		GeneratedAt:  time.Now(),
+	}
+	if shift.Status == "closed" {
+		report.Type = "Z"
+	}
+
+	var sales struct {
+		Count int
+		Total float64
+		Voids int
+	}
+	if err := tx.Model(&Models.Sales{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(total_amount), 0) AS total, COUNT(*) FILTER (WHERE status = 'voided') AS voids").
+		Where("shift_id = ?", shift.ShiftID).Scan(&sales).Error; err != nil {
+		return report, err
+	}
+	report.SalesCount = sales.Count
+	report.SalesTotal = roundMoney(sales.Total)
+	report.VoidCount = sales.Voids
+
+	if err := tx.Model(&Models.Payments{}).
+		Select("method, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount").
+		Where("sale_id IN (?)", tx.Model(&Models.Sales{}).Select("sale_id").Where("shift_id = ?", shift.ShiftID)).
+		Group("method").Order("method").Scan(&report.Tenders).Error; err != nil {
+		return report, err
+	}
+	for i, tender := range report.Tenders {
+		report.Tenders[i].Amount = roundMoney(tender.Amount)
+		if tender.Method == "cash" {
+			report.CashSales = roundMoney(tender.Amount)
+		}
+	}
+
+	if err := tx.Model(&Models.Refunds{}).
+		Select("method, COUNT(*) AS count, COALESCE(SUM(total_amount - points_amount), 0) AS amount").
+		Where("shift_id = ?", shift.ShiftID).
+		Group("method").Order("method").Scan(&report.Refunds).Error; err != nil {
+		return report, err
+	}
+	for i, refund := range report.Refunds {
+		report.Refunds[i].Amount = roundMoney(refund.Amount)
+		report.RefundCount += refund.Count
+		report.RefundTotal += refund.Amount
+		if refund.Method == "cash" {
+			report.CashRefunds = roundMoney(refund.Amount)
+		}
+	}
+	report.RefundTotal = roundMoney(report.RefundTotal)
+
+	var movements []Models.ShiftCashMovements
+	if err := tx.Where("shift_id = ?", shift.ShiftID).Order("created_at").Find(&movements).Error; err != nil {
+		return report, err
+	}
+	for _, movement := range movements {
+		if movement.Type == "pay_in" {
+			report.PayIns += movement.Amount
+		} else {
+			report.PayOuts += movement.Amount
+		}
+	}
+	report.PayIns = roundMoney(report.PayIns)
+	report.PayOuts = roundMoney(report.PayOuts)
+	report.Shift.Movements = movements
+
+	report.ExpectedCash = roundMoney(report.OpeningFloat + report.CashSales + report.PayIns - report.PayOuts - report.CashRefunds)
+
+	if shift.Status == "closed" {
+		if err := tx.Where("shift_id = ?", shift.ShiftID).Order("denomination DESC").Find(&report.Counts).Error; err != nil {
+			return report, err
+		}
+		report.CountedCash = shift.CountedCash
+		report.Variance = shift.Variance
+	}
+	return report, nil
+}
+
+// เปิดกะของพนักงานปัจจุบันพร้อมเงินทอนตั้งต้น
+func OpenShift(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		BranchID     string  `json:"branchid"`
+		OpeningFloat float64 `json:"openingfloat"`
+		Note         string  `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if req.OpeningFloat < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Opening float cannot be negative",
+		})
+	}
+
+	user := Middleware.CurrentUser(c)
+	branchID, ok := writeBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	if branchID == "" || user.EmployeeID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "BranchID is required",
+		})
+	}
+
+	var open int64
+	db.Model(&Models.Shifts{}).Where("employee_id = ? AND status = ?", user.EmployeeID, "open").Count(&open)
+	if open > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Employee already has an open shift",
+		})
+	}
+
+	shift := Models.Shifts{
+		ShiftID:      uuid.New().String(),
+		BranchID:     branchID,
+		EmployeeID:   user.EmployeeID,
+		Status:       "open",
+		OpeningFloat: roundMoney(req.OpeningFloat),
+		Note:         req.Note,
+		OpenedAt:     time.Now(),
+	}
+	if user.DeviceID != "" {
+		shift.DeviceID = &user.DeviceID
+	}
+	if err := db.Create(&shift).Error; err != nil {
+		// unique index ของกะที่เปิดอยู่กันการเปิดซ้อนกันพร้อมกัน
+		if strings.Contains(err.Error(), "idx_shifts_open_employee") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Employee already has an open shift",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to open shift: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": shift})
+}
+
+// ดูกะที่เปิดอยู่ของพนักงานปัจจุบันพร้อมรายงาน X
+func CurrentShift(db *gorm.DB, c *fiber.Ctx) error {
+	var shift Models.Shifts
+	if err := db.Where("employee_id = ? AND status = ?", Middleware.CurrentUser(c).EmployeeID, "open").First(&shift).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No open shift",
+		})
+	}
+	report, err := buildShiftReport(db, shift)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build shift report: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": report})
+}
+
+// บันทึกการนำเงินเข้า/ออกจากลิ้นชักระหว่างกะ
+func AddShiftMovement(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		Type   string  `json:"type"`
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if req.Type != "pay_in" && req.Type != "pay_out" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "type must be pay_in or pay_out",
+		})
+	}
+	amount := roundMoney(req.Amount)
+	if amount <= 0 || strings.TrimSpace(req.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Amount must be greater than zero and reason is required",
+		})
+	}
+
+	var movement Models.ShiftCashMovements
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var shift Models.Shifts
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("shift_id = ?", c.Params("id")).First(&shift).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Shift not found")
+			return nil
+		}
+		if !canManageShift(c, shift) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this shift")
+			return nil
+		}
+		if shift.Status != "open" {
+			failure = fiber.NewError(fiber.StatusConflict, "Shift is already closed")
+			return nil
+		}
+
+		// นำเงินออกได้ไม่เกินเงินสดที่ควรมีในลิ้นชัก
+		if req.Type == "pay_out" {
+			report, err := buildShiftReport(tx, shift)
+			if err != nil {
+				return err
+			}
+			if amount > report.ExpectedCash+0.005 {
+				failure = fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Pay-out of %.2f exceeds cash in drawer %.2f", amount, report.ExpectedCash))
+				return nil
+			}
+		}
+
+		movement = Models.ShiftCashMovements{
+			MovementID: uuid.New().String(),
+			ShiftID:    shift.ShiftID,
+			Type:       req.Type,
+			Amount:     amount,
+			Reason:     strings.TrimSpace(req.Reason),
+			EmployeeID: Middleware.CurrentUser(c).EmployeeID,
+			CreatedAt:  time.Now(),
+		}
+		return tx.Create(&movement).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record cash movement: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": movement})
+}
+
+// ปิดกะด้วยจำนวนเงินสดที่นับได้แยกตามชนิดธนบัตร/เหรียญ และคืนรายงาน Z
+func CloseShift(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		Counts []DenominationCount `json:"counts"`
+		Note   string              `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	// ตรวจสอบชนิดธนบัตร/เหรียญและรวมยอดที่นับได้
+	valid := make(map[float64]bool, len(thaiDenominations))
+	for _, d := range thaiDenominations {
+		valid[d] = true
+	}
+	seen := make(map[float64]bool)
+	var counted float64
+	for _, count := range req.Counts {
+		if !valid[count.Denomination] || seen[count.Denomination] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":         fmt.Sprintf("Invalid or duplicate denomination: %.2f", count.Denomination),
+				"denominations": thaiDenominations,
+			})
+		}
+		if count.Quantity < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Quantity for denomination %.2f cannot be negative", count.Denomination),
+			})
+		}
+		seen[count.Denomination] = true
+		counted += count.Denomination * float64(count.Quantity)
+	}
+	counted = roundMoney(counted)
+
+	var report ShiftReport
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// lock กะไว้เพื่อรอการขายที่กำลังทำรายการในกะนี้ให้เสร็จก่อน
+		var shift Models.Shifts
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("shift_id = ?", c.Params("id")).First(&shift).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Shift not found")
+			return nil
+		}
+		if !canManageShift(c, shift) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this shift")
+			return nil
+		}
+		if shift.Status != "open" {
+			failure = fiber.NewError(fiber.StatusConflict, "Shift is already closed")
+			return nil
+		}
+
+		for _, count := range req.Counts {
+			row := Models.ShiftCashCounts{
+				ShiftID:      shift.ShiftID,
+				Denomination: count.Denomination,
+				Quantity:     count.Quantity,
+				Amount:       roundMoney(count.Denomination * float64(count.Quantity)),
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+
+		expected, err := buildShiftReport(tx, shift)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		closedBy := Middleware.CurrentUser(c).EmployeeID
+		variance := roundMoney(counted - expected.ExpectedCash)
+		shift.Status = "closed"
+		shift.ExpectedCash = &expected.ExpectedCash
+		shift.CountedCash = &counted
+		shift.Variance = &variance
+		shift.ClosedAt = &now
+		shift.ClosedBy = &closedBy
+		if req.Note != "" {
+			shift.Note = req.Note
+		}
+		if err := tx.Model(&shift).Select("status", "expected_cash", "counted_cash", "variance", "closed_at", "closed_by", "note").Updates(&shift).Error; err != nil {
+			return err
+		}
+
+		report, err = buildShiftReport(tx, shift)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to close shift: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.JSON(fiber.Map{"Data": report})
+}
+
+// ดูรายงานของกะ (X ถ้ากะยังเปิดอยู่, Z ถ้าปิดแล้ว)
+// เจ้าของกะดูได้เสมอ ส่วนกะของคนอื่นต้องมีสิทธิ์ shifts:read
+func ShiftReportHandler(db *gorm.DB, c *fiber.Ctx) error {
+	var shift Models.Shifts
+	if err := db.Where("shift_id = ?", c.Params("id")).First(&shift).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Shift not found",
+		})
+	}
+	user := Middleware.CurrentUser(c)
+	if !canAccessBranch(c, shift.BranchID) {
+		return branchForbidden(c)
+	}
+	if user.EmployeeID != shift.EmployeeID && !Middleware.HasPermission(user.Role, Middleware.PermShiftsRead) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":      "Missing permission: " + string(Middleware.PermShiftsRead),
+			"permission": Middleware.PermShiftsRead,
+		})
+	}
+
+	report, err := buildShiftReport(db, shift)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build shift report: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": report})
+}
+
+// ดู Shifts ทั้งหมดของสาขา กรองด้วย ?status= และ ?employeeid=
+func LookShifts(db *gorm.DB, c *fiber.Ctx) error {
+	query := scopeBranch(c, db, "branch_id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if employeeID := c.Query("employeeid"); employeeID != "" {
+		query = query.Where("employee_id = ?", employeeID)
+	}
+
+	var shifts []Models.Shifts
+	if err := query.Order("opened_at DESC").Find(&shifts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find shifts: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": shifts})
+}
+
+// หา Shift ตาม ID พร้อมรายการเงินเข้า/ออกและจำนวนเงินที่นับได้
+func FindShift(db *gorm.DB, c *fiber.Ctx) error {
+	var shift Models.Shifts
+	if err := db.Preload("Movements").Preload("Counts").Where("shift_id = ?", c.Params("id")).First(&shift).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Shift not found",
+		})
+	}
+	if !canAccessBranch(c, shift.BranchID) {
+		return branchForbidden(c)
+	}
+	return c.JSON(fiber.Map{"Data": shift})
+}
+
+// Route สำหรับ Shifts
+func ShiftRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/shifts", func(c *fiber.Ctx) error {
+		return LookShifts(db, c)
+	})
+	app.Get("/shifts/current", func(c *fiber.Ctx) error {
+		return CurrentShift(db, c)
+	})
+	app.Get("/shifts/:id", func(c *fiber.Ctx) error {
+		return FindShift(db, c)
+	})
+	app.Get("/shifts/:id/report", func(c *fiber.Ctx) error {
+		return ShiftReportHandler(db, c)
+	})
+	app.Post("/shifts/open", func(c *fiber.Ctx) error {
+		return OpenShift(db, c)
+	})
+	app.Post("/shifts/:id/movements", func(c *fiber.Ctx) error {
+		return AddShiftMovement(db, c)
+	})
+	app.Post("/shifts/:id/close", func(c *fiber.Ctx) error {
+		return CloseShift(db, c)
+	})
+}
@@ -1,30 +1,16 @@
 package Database
 
 import (
-	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
 	"github.com/posproject/Models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func generateShipmentNumber() (string, error) {
-	// ตั้งค่า seed สำหรับสุ่มค่า
-	rand.Seed(time.Now().UnixNano())
-
-	// ดึงวันที่ปัจจุบันในรูปแบบ YYYYMMDD
-	today := time.Now().Format("20060102")
-
-	// สุ่มตัวเลข 5 หลัก (10000 - 99999)
-	randomNumber := rand.Intn(90000) + 10000
-
-	// คืนค่า Shipment Number
-	return fmt.Sprintf("SHIP-%s-%05d", today, randomNumber), nil
-}
-
 func AddShipment(db *gorm.DB, c *fiber.Ctx) error {
 	var req struct {
 		BranchID string                 `json:"branchid" binding:"required"`
@@ -37,6 +23,12 @@ func AddShipment(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
+	branchID, ok := writeBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	req.BranchID = branchID
+
 	// ตรวจสอบ Branch
 	var branch Models.Branches
 	if err := db.Where("branch_id = ?", req.BranchID).First(&branch).Error; err != nil {
@@ -45,17 +37,18 @@ func AddShipment(db *gorm.DB, c *fiber.Ctx) error {
 		})
 	}
 
-	// สร้าง Shipment Number
-	shipmentNumber, err := generateShipmentNumber()
+	// เริ่ม Transaction
+	tx := db.Begin()
+
+	// สร้าง Shipment Number แบบเรียงลำดับต่อสาขาต่อวัน (จองภายใน Transaction)
+	shipmentNumber, err := generateShipmentNumber(tx, req.BranchID, time.Now())
 	if err != nil {
+		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate shipment number: " + err.Error(),
 		})
 	}
 
-	// เริ่ม Transaction
-	tx := db.Begin()
-
 	newShipment := Models.Shipments{
 		ShipmentID:     uuid.New().String(),
 		ShipmentNumber: shipmentNumber, // ✅ ใช้ค่าที่สร้างได้
@@ -92,7 +85,11 @@ func AddShipment(db *gorm.DB, c *fiber.Ctx) error {
 		}
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save shipment: " + err.Error(),
+		})
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New Shipment": newShipment})
 }
@@ -106,9 +103,7 @@ func LookShipments(db *gorm.DB, c *fiber.Ctx) error {
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
-	if branchID := c.Query("branchid"); branchID != "" {
-		query = query.Where("branch_id = ?", branchID)
-	}
+	query = scopeBranch(c, query, "branch_id")
 
 	// ค้นหา shipments
 	if err := query.Find(&shipments).Error; err != nil {
@@ -128,19 +123,23 @@ func FindShipment(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Shipment not found",
 		})
 	}
+	if !canAccessBranch(c, shipment.BranchID) {
+		return branchForbidden(c)
+	}
 	return c.JSON(fiber.Map{"Data": shipment})
 }
 
+// สถานะของ Shipment ที่ตั้งได้
+var shipmentStatuses = map[string]bool{
+	"pending":   true,
+	"received":  true,
+	"cancelled": true,
+}
+
 // อัปเดต Status ของ Shipment
+// เมื่อเปลี่ยนเป็น received จะรับสินค้าทุกรายการเข้า Inventory ของสาขา (shipment_receipt) ครั้งเดียวเท่านั้น
+// Shipment ที่รับแล้วเปลี่ยนสถานะไม่ได้ เพราะ stock ถูกบันทึกเข้า ledger แล้ว
 func UpdateShipment(db *gorm.DB, c *fiber.Ctx) error {
-	id := c.Params("id")
-	var shipment Models.Shipments
-	if err := db.Where("shipment_id = ?", id).First(&shipment).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Shipment not found",
-		})
-	}
-
 	var req struct {
 		Status string `json:"status"`
 	}
@@ -150,13 +149,62 @@ func UpdateShipment(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Invalid JSON format: " + err.Error(),
 		})
 	}
-
-	if req.Status != "" {
-		shipment.Status = req.Status
-		shipment.UpdatedAt = time.Now()
+	if !shipmentStatuses[req.Status] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Status must be pending, received or cancelled",
+		})
 	}
 
-	if err := db.Save(&shipment).Error; err != nil {
+	user := Middleware.CurrentUser(c)
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var shipment Models.Shipments
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("shipment_id = ?", c.Params("id")).First(&shipment).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Shipment not found")
+			return nil
+		}
+		if !user.CanAccessBranch(shipment.BranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if req.Status == shipment.Status {
+			return nil
+		}
+		if shipment.Status == "received" {
+			failure = fiber.NewError(fiber.StatusConflict, "Shipment has already been received")
+			return nil
+		}
+
+		if req.Status == "received" {
+			var items []Models.ShipmentItems
+			if err := tx.Where("shipment_id = ?", shipment.ShipmentID).Order("product_id").Find(&items).Error; err != nil {
+				return err
+			}
+			for _, item := range items {
+				if item.Quantity <= 0 {
+					continue
+				}
+				if _, err := incrementInventory(tx, shipment.BranchID, item.ProductID, item.Quantity, stockRef{
+					Type:          "shipment_receipt",
+					ReferenceType: "shipment",
+					ReferenceID:   shipment.ShipmentID,
+					EmployeeID:    user.EmployeeID,
+					Note:          "Shipment " + shipment.ShipmentNumber,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Model(&shipment).Omit(clause.Associations).Updates(map[string]interface{}{
+			"status":     req.Status,
+			"updated_at": time.Now(),
+		}).Error
+	})
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update shipment: " + err.Error(),
 		})
@@ -173,6 +221,15 @@ func DeleteShipment(db *gorm.DB, c *fiber.Ctx) error {
 			"error": "Shipment not found",
 		})
 	}
+	if !canAccessBranch(c, shipment.BranchID) {
+		return branchForbidden(c)
+	}
+	// Shipment ที่รับเข้า stock แล้วมี StockMovements อ้างอิงอยู่ ลบไม่ได้
+	if shipment.Status == "received" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Received shipment cannot be deleted",
+		})
+	}
 
 	// ลบ ShipmentItems ก่อน
 	if err := db.Where("shipment_id = ?", id).Delete(&Models.ShipmentItems{}).Error; err != nil {
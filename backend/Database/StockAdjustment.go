@@ -0,0 +1,328 @@
+package Database
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// เหตุผลของการปรับ stock และทิศทางของจำนวน (-1 = ลด, +1 = เพิ่ม)
+var adjustmentReasonCodes = map[string]int{
+	"damage":      -1, // สินค้าเสียหาย
+	"theft":       -1, // สินค้าสูญหาย/ถูกขโมย
+	"expiry":      -1, // สินค้าหมดอายุ
+	"sample":      -1, // นำไปใช้เป็นตัวอย่าง
+	"found_stock": 1,  // พบสินค้าเพิ่ม
+}
+
+// มูลค่าเริ่มต้น (บาท) ที่การปรับ stock ต้องรออนุมัติ
+const defaultAdjustmentApprovalThreshold = 1000.0
+
+// มูลค่าที่การปรับ stock ต้องรออนุมัติ ตั้งค่าได้ด้วย ADJUSTMENT_APPROVAL_THRESHOLD
+func adjustmentApprovalThreshold() float64 {
+	value := os.Getenv("ADJUSTMENT_APPROVAL_THRESHOLD")
+	if value == "" {
+		return defaultAdjustmentApprovalThreshold
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < 0 {
+		log.Printf("Invalid ADJUSTMENT_APPROVAL_THRESHOLD %q, using %.2f", value, defaultAdjustmentApprovalThreshold)
+		return defaultAdjustmentApprovalThreshold
+	}
+	return threshold
+}
+
+// AdjustmentSummary ยอดปรับ stock ของสาขาแยกตามเหตุผล
+type AdjustmentSummary struct {
+	BranchID   string  `json:"branchid"`
+	BName      string  `json:"bname"`
+	ReasonCode string  `json:"reasoncode"`
+	Count      int64   `json:"count"`
+	Quantity   int64   `json:"quantity"`
+	Value      float64 `json:"value"`
+	Pending    int64   `json:"pending"` // จำนวนรายการที่ยังรออนุมัติ
+}
+
+// ปรับจำนวนใน Inventory ตามรายการปรับ stock และบันทึก StockMovements
+func applyAdjustment(tx *gorm.DB, adjustment *Models.StockAdjustments) error {
+	ref := stockRef{
+		Type:          "adjustment",
+		ReferenceType: "adjustment",
+		ReferenceID:   adjustment.AdjustmentID,
+		EmployeeID:    adjustment.RequestedBy,
+		Note:          adjustment.ReasonCode + ": " + adjustment.Note,
+	}
+	var err error
+	if adjustment.Quantity < 0 {
+		_, err = decrementInventory(tx, adjustment.BranchID, adjustment.ProductID, -adjustment.Quantity, ref)
+	} else {
+		_, err = incrementInventory(tx, adjustment.BranchID, adjustment.ProductID, adjustment.Quantity, ref)
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	adjustment.Status = "applied"
+	adjustment.AppliedAt = &now
+	return nil
+}
+
+// รายการปรับ stock ของ Inventory มูลค่าคิดตามราคาขาย
+func newStockAdjustment(inventory Models.Inventory, product Models.Product, quantity int, reasonCode string, note string, requestedBy string) Models.StockAdjustments {
+	units := quantity
+	if units < 0 {
+		units = -units
+	}
+	return Models.StockAdjustments{
+		AdjustmentID: uuid.New().String(),
+		InventoryID:  inventory.InventoryID,
+		BranchID:     inventory.BranchID,
+		ProductID:    inventory.ProductID,
+		Quantity:     quantity,
+		ReasonCode:   reasonCode,
+		Note:         note,
+		Value:        roundMoney(float64(units) * product.Price),
+		Status:       "pending",
+		RequestedBy:  requestedBy,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// บันทึกรายการปรับ stock ถ้ามูลค่าไม่เกินเกณฑ์จะมีผลกับ Inventory ทันที ไม่เช่นนั้นจะรออนุมัติ
+func submitStockAdjustment(tx *gorm.DB, adjustment *Models.StockAdjustments) error {
+	if adjustment.Value <= adjustmentApprovalThreshold() {
+		if err := applyAdjustment(tx, adjustment); err != nil {
+			return err
+		}
+	}
+	return tx.Create(adjustment).Error
+}
+
+// สร้างรายการปรับ stock ถ้ามูลค่าไม่เกินเกณฑ์จะมีผลกับ Inventory ทันที ไม่เช่นนั้นจะรออนุมัติ
+func AddStockAdjustment(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		InventoryID string `json:"inventoryid"`
+		Quantity    int    `json:"quantity"`
+		ReasonCode  string `json:"reasoncode"`
+		Note        string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	direction, ok := adjustmentReasonCodes[req.ReasonCode]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid reason code: " + req.ReasonCode,
+		})
+	}
+	if strings.TrimSpace(req.Note) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Note is required",
+		})
+	}
+	// ส่งจำนวนมาเป็นบวกหรือลบก็ได้ ทิศทางกำหนดจากเหตุผล
+	units := req.Quantity
+	if units < 0 {
+		units = -units
+	}
+	if units == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must not be zero",
+		})
+	}
+
+	var inventory Models.Inventory
+	if err := db.Where("inventory_id = ?", req.InventoryID).First(&inventory).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inventory not found",
+		})
+	}
+	if !canAccessBranch(c, inventory.BranchID) {
+		return branchForbidden(c)
+	}
+	var product Models.Product
+	if err := db.Where("product_id = ?", inventory.ProductID).First(&product).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Product not found for inventory",
+		})
+	}
+
+	adjustment := newStockAdjustment(inventory, product, units*direction, req.ReasonCode, strings.TrimSpace(req.Note), Middleware.CurrentUser(c).EmployeeID)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return submitStockAdjustment(tx, &adjustment)
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStock) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Adjustment would make stock negative",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create stock adjustment: " + err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": adjustment})
+}
+
+// อนุมัติหรือปฏิเสธรายการปรับ stock ที่รออนุมัติ ผู้อนุมัติต้องไม่ใช่ผู้ขอ
+func reviewStockAdjustment(db *gorm.DB, c *fiber.Ctx, approve bool) error {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid JSON format: " + err.Error(),
+			})
+		}
+	}
+
+	var adjustment Models.StockAdjustments
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("adjustment_id = ?", c.Params("id")).First(&adjustment).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Stock adjustment not found")
+			return nil
+		}
+		user := Middleware.CurrentUser(c)
+		if !user.CanAccessBranch(adjustment.BranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if adjustment.Status != "pending" {
+			failure = fiber.NewError(fiber.StatusConflict, "Stock adjustment is already "+adjustment.Status)
+			return nil
+		}
+		if adjustment.RequestedBy == user.EmployeeID {
+			failure = fiber.NewError(fiber.StatusForbidden, "You cannot review your own stock adjustment")
+			return nil
+		}
+
+		now := time.Now()
+		adjustment.ReviewedBy = &user.EmployeeID
+		adjustment.ReviewedAt = &now
+		adjustment.ReviewNote = req.Note
+		if approve {
+			if err := applyAdjustment(tx, &adjustment); err != nil {
+				if errors.Is(err, ErrInsufficientStock) {
+					failure = fiber.NewError(fiber.StatusConflict, "Adjustment would make stock negative")
+					return nil
+				}
+				return err
+			}
+		} else {
+			adjustment.Status = "rejected"
+		}
+		return tx.Model(&adjustment).Select("status", "reviewed_by", "reviewed_at", "review_note", "applied_at").Updates(&adjustment).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to review stock adjustment: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.JSON(fiber.Map{"Data": adjustment})
+}
+
+func ApproveStockAdjustment(db *gorm.DB, c *fiber.Ctx) error {
+	return reviewStockAdjustment(db, c, true)
+}
+
+func RejectStockAdjustment(db *gorm.DB, c *fiber.Ctx) error {
+	return reviewStockAdjustment(db, c, false)
+}
+
+// ดูรายการปรับ stock ของสาขา กรองด้วย ?status= ?reasoncode= ?inventoryid=
+func LookStockAdjustments(db *gorm.DB, c *fiber.Ctx) error {
+	query := scopeBranch(c, db, "branch_id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if reasonCode := c.Query("reasoncode"); reasonCode != "" {
+		query = query.Where("reason_code = ?", reasonCode)
+	}
+	if inventoryID := c.Query("inventoryid"); inventoryID != "" {
+		query = query.Where("inventory_id = ?", inventoryID)
+	}
+
+	var adjustments []Models.StockAdjustments
+	if err := query.Order("created_at DESC").Find(&adjustments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find stock adjustments: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": adjustments})
+}
+
+// รายงานการปรับ stock แยกตามสาขาและเหตุผลในหนึ่งเดือน (นับเฉพาะรายการที่มีผลแล้ว)
+func AdjustmentReport(db *gorm.DB, c *fiber.Ctx) error {
+	start, end, err := parseMonth(c.Query("month"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid month, expected YYYY-MM",
+		})
+	}
+
+	query := db.Table(`"StockAdjustments" AS a`).
+		Select("a.branch_id, b.b_name, a.reason_code, "+
+			"COUNT(*) FILTER (WHERE a.status = 'applied') AS count, "+
+			"COALESCE(SUM(a.quantity) FILTER (WHERE a.status = 'applied'), 0) AS quantity, "+
+			"COALESCE(SUM(a.value) FILTER (WHERE a.status = 'applied'), 0) AS value, "+
+			"COUNT(*) FILTER (WHERE a.status = 'pending') AS pending").
+		Joins(`LEFT JOIN "Branches" AS b ON b.branch_id = a.branch_id`).
+		Where("a.created_at >= ? AND a.created_at < ?", start, end)
+	query = scopeBranch(c, query, "a.branch_id")
+
+	rows := []AdjustmentSummary{}
+	if err := query.Group("a.branch_id, b.b_name, a.reason_code").Order("b.b_name, a.reason_code").Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build adjustment report: " + err.Error(),
+		})
+	}
+
+	var total float64
+	for i := range rows {
+		rows[i].Value = roundMoney(rows[i].Value)
+		total += rows[i].Value
+	}
+	return c.JSON(fiber.Map{
+		"Data":      rows,
+		"Month":     start.Format("2006-01"),
+		"Total":     roundMoney(total),
+		"Threshold": adjustmentApprovalThreshold(),
+	})
+}
+
+// Route สำหรับการปรับ stock (ต้องลงทะเบียนก่อน /inventory/:id)
+func StockAdjustmentRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/inventory/adjustments", func(c *fiber.Ctx) error {
+		return LookStockAdjustments(db, c)
+	})
+	app.Post("/inventory/adjustments", func(c *fiber.Ctx) error {
+		return AddStockAdjustment(db, c)
+	})
+	app.Post("/inventory/adjustments/:id/approve", func(c *fiber.Ctx) error {
+		return ApproveStockAdjustment(db, c)
+	})
+	app.Post("/inventory/adjustments/:id/reject", func(c *fiber.Ctx) error {
+		return RejectStockAdjustment(db, c)
+	})
+	app.Get("/reports/adjustments", func(c *fiber.Ctx) error {
+		return AdjustmentReport(db, c)
+	})
+}
@@ -0,0 +1,171 @@
+package Database
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// stockRef เหตุผลและเอกสารอ้างอิงของการเปลี่ยนจำนวนสินค้า
+type stockRef struct {
+	Type          string // sale, refund, transfer_out, transfer_in, shipment_receipt, adjustment, count_correction, opening_balance
+	ReferenceType string
+	ReferenceID   string
+	EmployeeID    string
+	Note          string
+}
+
+// StockDrift Inventory ที่จำนวนไม่ตรงกับผลรวมของ StockMovements
+type StockDrift struct {
+	InventoryID string `json:"inventoryid"`
+	BranchID    string `json:"branchid"`
+	ProductID   string `json:"productid"`
+	Quantity    int    `json:"quantity"`    // จำนวนใน Inventory
+	LedgerTotal int    `json:"ledgertotal"` // ผลรวมของ StockMovements
+	Drift       int    `json:"drift"`       // Quantity - LedgerTotal
+}
+
+// บันทึก StockMovements หลังจากเปลี่ยนจำนวนใน Inventory แล้ว (inventory.Quantity คือยอดหลังเปลี่ยน)
+// ต้องเรียกภายใน Transaction เดียวกับการเปลี่ยนจำนวน
+func recordStockMovement(tx *gorm.DB, inventory Models.Inventory, quantity int, ref stockRef) error {
+	if quantity == 0 {
+		return nil
+	}
+	movement := Models.StockMovements{
+		MovementID:    uuid.New().String(),
+		InventoryID:   inventory.InventoryID,
+		BranchID:      inventory.BranchID,
+		ProductID:     inventory.ProductID,
+		Type:          ref.Type,
+		Quantity:      quantity,
+		BalanceAfter:  inventory.Quantity,
+		ReferenceType: ref.ReferenceType,
+		Note:          ref.Note,
+		CreatedAt:     time.Now(),
+	}
+	if ref.ReferenceID != "" {
+		movement.ReferenceID = &ref.ReferenceID
+	}
+	if ref.EmployeeID != "" {
+		movement.EmployeeID = &ref.EmployeeID
+	}
+	return tx.Create(&movement).Error
+}
+
+// หา Inventory ที่จำนวนไม่ตรงกับ ledger (branchID ว่าง = ทุกสาขา)
+func findStockDrift(db *gorm.DB, branchID string) ([]StockDrift, error) {
+	query := db.Table(`"Inventory" i`).
+		Select("i.inventory_id, i.branch_id, i.product_id, i.quantity, COALESCE(SUM(m.quantity), 0) AS ledger_total, i.quantity - COALESCE(SUM(m.quantity), 0) AS drift").
+		Joins(`LEFT JOIN "StockMovements" m ON m.inventory_id = i.inventory_id`).
+		Group("i.inventory_id, i.branch_id, i.product_id, i.quantity").
+		Having("i.quantity <> COALESCE(SUM(m.quantity), 0)").
+		Order("i.branch_id, i.product_id")
+	if branchID != "" {
+		query = query.Where("i.branch_id = ?", branchID)
+	}
+	drifts := []StockDrift{}
+	err := query.Scan(&drifts).Error
+	return drifts, err
+}
+
+// ดูประวัติการเคลื่อนไหวของ Inventory กรองด้วย ?type= ?from= ?to= (YYYY-MM-DD) และ ?limit=
+func LookStockMovements(db *gorm.DB, c *fiber.Ctx) error {
+	var inventory Models.Inventory
+	if err := db.Where("inventory_id = ?", c.Params("id")).First(&inventory).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inventory not found",
+		})
+	}
+	if !canAccessBranch(c, inventory.BranchID) {
+		return branchForbidden(c)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "200"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be between 1 and 1000",
+		})
+	}
+	query := db.Where("inventory_id = ?", inventory.InventoryID)
+	if movementType := c.Query("type"); movementType != "" {
+		query = query.Where("type = ?", movementType)
+	}
+	if from := c.Query("from"); from != "" {
+		start, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "from must be in YYYY-MM-DD format",
+			})
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if to := c.Query("to"); to != "" {
+		end, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "to must be in YYYY-MM-DD format",
+			})
+		}
+		query = query.Where("created_at < ?", end.AddDate(0, 0, 1))
+	}
+
+	var movements []Models.StockMovements
+	if err := query.Order("created_at DESC").Limit(limit).Find(&movements).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find stock movements: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"Inventory": inventory,
+		"Data":      movements,
+	})
+}
+
+// ตรวจหา Inventory ที่จำนวนไม่ตรงกับ StockMovements ของสาขา (Super Admin ใช้ ?branchid= หรือดูทุกสาขา)
+func ReconcileInventory(db *gorm.DB, c *fiber.Ctx) error {
+	var branches []Models.Branches
+	if err := scopeBranch(c, db.Select("branch_id"), "branch_id").Find(&branches).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find branches: " + err.Error(),
+		})
+	}
+
+	drifts := []StockDrift{}
+	for _, branch := range branches {
+		branchDrifts, err := findStockDrift(db, branch.BranchID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to reconcile inventory: " + err.Error(),
+			})
+		}
+		drifts = append(drifts, branchDrifts...)
+	}
+	return c.JSON(fiber.Map{
+		"consistent": len(drifts) == 0,
+		"Data":       drifts,
+	})
+}
+
+// StartInventoryReconciliation ตรวจหา Inventory ที่ไม่ตรงกับ ledger เป็นระยะ และ log รายการที่พบ
+func StartInventoryReconciliation(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			drifts, err := findStockDrift(db, "")
+			if err != nil {
+				log.Println("Inventory reconciliation failed: ", err)
+				continue
+			}
+			for _, d := range drifts {
+				log.Printf("inventory drift: inventory=%s branch=%s product=%s quantity=%d ledger=%d drift=%d",
+					d.InventoryID, d.BranchID, d.ProductID, d.Quantity, d.LedgerTotal, d.Drift)
+			}
+		}
+	}()
+}
@@ -0,0 +1,558 @@
+package Database
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StocktakeVariance ผลต่างของสินค้าหนึ่งรายการในรอบนับ
+// จำนวนที่ควรมี = snapshot + StockMovements หลัง snapshot จนถึงเวลาที่นับครั้งล่าสุด
+// ทำให้การขาย/รับสินค้าระหว่างที่กำลังนับไม่ถูกนับเป็นผลต่าง
+type StocktakeVariance struct {
+	LineID           string  `json:"lineid"`
+	InventoryID      string  `json:"inventoryid"`
+	ProductID        string  `json:"productid"`
+	ProductCode      string  `json:"productcode"`
+	ProductName      string  `json:"productname"`
+	SnapshotQuantity int     `json:"snapshotquantity"`
+	MovementsSince   int     `json:"movementssince"` // การเคลื่อนไหวหลัง snapshot จนถึงเวลาที่นับ
+	ExpectedQuantity int     `json:"expectedquantity"`
+	CountedQuantity  *int    `json:"countedquantity"` // null = ยังไม่นับ
+	Variance         int     `json:"variance"`
+	Value            float64 `json:"value"` // มูลค่าผลต่างตามราคาขาย
+}
+
+// แถวของ StocktakeLines พร้อมข้อมูลสินค้า
+type stocktakeLineRow struct {
+	Models.StocktakeLines
+	ProductCode string
+	ProductName string
+	Price       float64
+}
+
+// คำนวณผลต่างของทุกรายการในรอบนับ
+// รายการที่ยังไม่นับ: รอบ full ถือว่านับได้ 0 ส่วนรอบ cycle ไม่ปรับ (variance = 0)
+func stocktakeVariances(db *gorm.DB, stocktake Models.Stocktakes) ([]StocktakeVariance, error) {
+	var lines []stocktakeLineRow
+	if err := db.Table(`"StocktakeLines" AS l`).
+		Select("l.*, p.product_code, p.product_name, p.price").
+		Joins(`JOIN "Products" AS p ON p.product_id = l.product_id`).
+		Where("l.stocktake_id = ?", stocktake.StocktakeID).
+		Order("p.product_code").
+		Scan(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	// เวลาที่นับครั้งล่าสุดของแต่ละรายการ
+	var lastCounts []struct {
+		LineID    string
+		CountedAt time.Time
+	}
+	if err := db.Model(&Models.StocktakeCounts{}).
+		Select("line_id, MAX(created_at) AS counted_at").
+		Where("stocktake_id = ?", stocktake.StocktakeID).
+		Group("line_id").
+		Scan(&lastCounts).Error; err != nil {
+		return nil, err
+	}
+	countedAt := make(map[string]time.Time, len(lastCounts))
+	for _, last := range lastCounts {
+		countedAt[last.LineID] = last.CountedAt
+	}
+
+	// การเคลื่อนไหวของสินค้าในสาขาหลัง snapshot (ไม่รวมการปรับจากรอบนับนี้เอง)
+	var movements []Models.StockMovements
+	if err := db.Select("inventory_id", "quantity", "created_at").
+		Where("branch_id = ? AND created_at > ?", stocktake.BranchID, stocktake.SnapshotAt).
+		Where("COALESCE(reference_type, '') <> ? OR reference_id IS DISTINCT FROM ?", "stocktake", stocktake.StocktakeID).
+		Where(`inventory_id IN (SELECT inventory_id FROM "StocktakeLines" WHERE stocktake_id = ?)`, stocktake.StocktakeID).
+		Find(&movements).Error; err != nil {
+		return nil, err
+	}
+	byInventory := make(map[string][]Models.StockMovements)
+	for _, m := range movements {
+		byInventory[m.InventoryID] = append(byInventory[m.InventoryID], m)
+	}
+
+	variances := make([]StocktakeVariance, 0, len(lines))
+	for _, line := range lines {
+		until, counted := countedAt[line.LineID]
+		since := 0
+		for _, m := range byInventory[line.InventoryID] {
+			if !counted || !m.CreatedAt.After(until) {
+				since += m.Quantity
+			}
+		}
+
+		v := StocktakeVariance{
+			LineID:           line.LineID,
+			InventoryID:      line.InventoryID,
+			ProductID:        line.ProductID,
+			ProductCode:      line.ProductCode,
+			ProductName:      line.ProductName,
+			SnapshotQuantity: line.SnapshotQuantity,
+			MovementsSince:   since,
+			ExpectedQuantity: line.SnapshotQuantity + since,
+			CountedQuantity:  line.CountedQuantity,
+		}
+		switch {
+		case line.CountedQuantity != nil:
+			v.Variance = *line.CountedQuantity - v.ExpectedQuantity
+		case stocktake.Type == "full":
+			v.Variance = -v.ExpectedQuantity
+		}
+		v.Value = roundMoney(float64(v.Variance) * line.Price)
+		variances = append(variances, v)
+	}
+	return variances, nil
+}
+
+// เริ่มรอบนับสต็อกของสาขา บันทึกจำนวนใน Inventory ณ เวลาเริ่ม
+// type = full นับทุกสินค้า, type = cycle นับเฉพาะหมวดหมู่ categoryid
+func AddStocktake(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		BranchID   string `json:"branchid"`
+		Type       string `json:"type"`
+		CategoryID string `json:"categoryid"`
+		Note       string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	if req.Type == "" {
+		req.Type = "full"
+	}
+	if req.Type != "full" && req.Type != "cycle" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Type must be full or cycle",
+		})
+	}
+	if req.Type == "cycle" && req.CategoryID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "CategoryID is required for a cycle count",
+		})
+	}
+
+	user := Middleware.CurrentUser(c)
+	branchID, ok := writeBranch(c, req.BranchID)
+	if !ok {
+		return branchForbidden(c)
+	}
+	if branchID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "BranchID is required",
+		})
+	}
+
+	stocktake := Models.Stocktakes{
+		StocktakeID: uuid.New().String(),
+		BranchID:    branchID,
+		Type:        req.Type,
+		Status:      "open",
+		Note:        req.Note,
+		CreatedBy:   user.EmployeeID,
+		CreatedAt:   time.Now(),
+	}
+	if req.Type == "cycle" {
+		stocktake.CategoryID = &req.CategoryID
+	}
+
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// lock สาขาเพื่อไม่ให้เริ่มรอบนับที่ทับกันพร้อมกัน
+		var branch Models.Branches
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("branch_id = ?", branchID).First(&branch).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Branch not found")
+			return nil
+		}
+		overlap := tx.Model(&Models.Stocktakes{}).Where("branch_id = ? AND status = ?", branchID, "open")
+		if req.Type == "cycle" {
+			overlap = overlap.Where("type = ? OR category_id = ?", "full", req.CategoryID)
+		}
+		var open int64
+		if err := overlap.Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			failure = fiber.NewError(fiber.StatusConflict, "An open stocktake already covers these products")
+			return nil
+		}
+
+		// lock แถว Inventory ให้การขายที่กำลังทำอยู่ commit ก่อนแล้วจึงบันทึกเวลา snapshot
+		query := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("branch_id = ?", branchID)
+		if req.Type == "cycle" {
+			query = query.Where(`product_id IN (SELECT product_id FROM "Products" WHERE category_id = ?)`, req.CategoryID)
+		}
+		var inventories []Models.Inventory
+		if err := query.Find(&inventories).Error; err != nil {
+			return err
+		}
+		if len(inventories) == 0 {
+			failure = fiber.NewError(fiber.StatusBadRequest, "No inventory to count")
+			return nil
+		}
+		stocktake.SnapshotAt = time.Now()
+
+		if err := tx.Create(&stocktake).Error; err != nil {
+			return err
+		}
+		lines := make([]Models.StocktakeLines, 0, len(inventories))
+		for _, inventory := range inventories {
+			lines = append(lines, Models.StocktakeLines{
+				LineID:           uuid.New().String(),
+				StocktakeID:      stocktake.StocktakeID,
+				InventoryID:      inventory.InventoryID,
+				ProductID:        inventory.ProductID,
+				SnapshotQuantity: inventory.Quantity,
+			})
+		}
+		if err := tx.CreateInBatches(&lines, 500).Error; err != nil {
+			return err
+		}
+		stocktake.Lines = lines
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start stocktake: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": stocktake})
+}
+
+// บันทึกจำนวนที่นับได้ รับได้ทั้งรายการเดียวหรือหลายรายการใน "counts"
+// ระบุสินค้าด้วย productid (กรอกจำนวน) หรือ barcode (รหัสสินค้า จำนวนเริ่มต้น 1 ต่อการสแกน)
+// พนักงานหลายคนนับสินค้าเดียวกันได้ ยอดนับจะรวมกัน และส่งจำนวนติดลบเพื่อแก้การสแกนผิดได้
+func AddStocktakeCounts(db *gorm.DB, c *fiber.Ctx) error {
+	type countEntry struct {
+		ProductID string `json:"productid"`
+		Barcode   string `json:"barcode"`
+		Quantity  *int   `json:"quantity"`
+	}
+	var req struct {
+		countEntry
+		Counts []countEntry `json:"counts"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+	entries := req.Counts
+	if len(entries) == 0 {
+		entries = []countEntry{req.countEntry}
+	}
+
+	user := Middleware.CurrentUser(c)
+	var counts []Models.StocktakeCounts
+	var lines []Models.StocktakeLines
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// lock แบบ SHARE ให้หลายคนนับพร้อมกันได้ แต่ไม่ให้อนุมัติ/ยกเลิกระหว่างบันทึก
+		var stocktake Models.Stocktakes
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("stocktake_id = ?", c.Params("id")).First(&stocktake).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Stocktake not found")
+			return nil
+		}
+		if !user.CanAccessBranch(stocktake.BranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if stocktake.Status != "open" {
+			failure = fiber.NewError(fiber.StatusConflict, "Stocktake is already "+stocktake.Status)
+			return nil
+		}
+
+		for _, entry := range entries {
+			source := "manual"
+			productID := entry.ProductID
+			if entry.Barcode != "" {
+				source = "scan"
+				var product Models.Product
+				if err := tx.Select("product_id").Where("product_code = ?", strings.TrimSpace(entry.Barcode)).First(&product).Error; err != nil {
+					failure = fiber.NewError(fiber.StatusBadRequest, "Unknown barcode: "+entry.Barcode)
+					return nil
+				}
+				productID = product.ProductID
+			}
+			if productID == "" {
+				failure = fiber.NewError(fiber.StatusBadRequest, "ProductID or barcode is required")
+				return nil
+			}
+			quantity := 1
+			if entry.Quantity != nil {
+				quantity = *entry.Quantity
+			} else if source == "manual" {
+				failure = fiber.NewError(fiber.StatusBadRequest, "Quantity is required")
+				return nil
+			}
+			if quantity == 0 {
+				continue
+			}
+
+			var line Models.StocktakeLines
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("stocktake_id = ? AND product_id = ?", stocktake.StocktakeID, productID).
+				First(&line).Error; err != nil {
+				failure = fiber.NewError(fiber.StatusBadRequest, "Product "+productID+" is not part of this stocktake")
+				return nil
+			}
+			total := quantity
+			if line.CountedQuantity != nil {
+				total += *line.CountedQuantity
+			}
+			if total < 0 {
+				failure = fiber.NewError(fiber.StatusBadRequest, "Counted quantity cannot be negative for product "+productID)
+				return nil
+			}
+			if err := tx.Model(&line).Update("counted_quantity", total).Error; err != nil {
+				return err
+			}
+			line.CountedQuantity = &total
+
+			count := Models.StocktakeCounts{
+				CountID:     uuid.New().String(),
+				StocktakeID: stocktake.StocktakeID,
+				LineID:      line.LineID,
+				ProductID:   productID,
+				Quantity:    quantity,
+				Source:      source,
+				CounterID:   user.EmployeeID,
+				CreatedAt:   time.Now(),
+			}
+			if err := tx.Create(&count).Error; err != nil {
+				return err
+			}
+			counts = append(counts, count)
+			lines = append(lines, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record counts: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"New":   counts,
+		"Lines": lines,
+	})
+}
+
+// ดูผลต่างของรอบนับ (รอบที่อนุมัติแล้วจะคำนวณตามเวลาที่นับเช่นเดียวกัน)
+func LookStocktakeVariances(db *gorm.DB, c *fiber.Ctx) error {
+	var stocktake Models.Stocktakes
+	if err := db.Where("stocktake_id = ?", c.Params("id")).First(&stocktake).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Stocktake not found",
+		})
+	}
+	if !canAccessBranch(c, stocktake.BranchID) {
+		return branchForbidden(c)
+	}
+
+	variances, err := stocktakeVariances(db, stocktake)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to calculate variances: " + err.Error(),
+		})
+	}
+	var counted int
+	var value float64
+	for _, v := range variances {
+		if v.CountedQuantity != nil {
+			counted++
+		}
+		value += v.Value
+	}
+	return c.JSON(fiber.Map{
+		"Stocktake":     stocktake,
+		"Data":          variances,
+		"Lines":         len(variances),
+		"Counted":       counted,
+		"VarianceValue": roundMoney(value),
+	})
+}
+
+// อนุมัติรอบนับ ปรับ Inventory ตามผลต่างด้วย StockMovements ประเภท count_correction
+func ApproveStocktake(db *gorm.DB, c *fiber.Ctx) error {
+	user := Middleware.CurrentUser(c)
+	var stocktake Models.Stocktakes
+	var variances []StocktakeVariance
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stocktake_id = ?", c.Params("id")).First(&stocktake).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Stocktake not found")
+			return nil
+		}
+		if !user.CanAccessBranch(stocktake.BranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if stocktake.Status != "open" {
+			failure = fiber.NewError(fiber.StatusConflict, "Stocktake is already "+stocktake.Status)
+			return nil
+		}
+
+		var err error
+		variances, err = stocktakeVariances(tx, stocktake)
+		if err != nil {
+			return err
+		}
+		ref := stockRef{
+			Type:          "count_correction",
+			ReferenceType: "stocktake",
+			ReferenceID:   stocktake.StocktakeID,
+			EmployeeID:    user.EmployeeID,
+			Note:          "stocktake " + stocktake.Type,
+		}
+		for _, v := range variances {
+			if v.Variance < 0 {
+				_, err = decrementInventory(tx, stocktake.BranchID, v.ProductID, -v.Variance, ref)
+			} else if v.Variance > 0 {
+				_, err = incrementInventory(tx, stocktake.BranchID, v.ProductID, v.Variance, ref)
+			}
+			if err != nil {
+				if errors.Is(err, ErrInsufficientStock) {
+					failure = fiber.NewError(fiber.StatusConflict, "Current stock of "+v.ProductCode+" is lower than the count correction, recount the product")
+					return nil
+				}
+				return err
+			}
+			if err := tx.Model(&Models.StocktakeLines{}).Where("line_id = ?", v.LineID).Updates(map[string]interface{}{
+				"expected_quantity": v.ExpectedQuantity,
+				"variance":          v.Variance,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		stocktake.Status = "approved"
+		stocktake.ApprovedBy = &user.EmployeeID
+		stocktake.ApprovedAt = &now
+		return tx.Model(&stocktake).Select("status", "approved_by", "approved_at").Updates(&stocktake).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to approve stocktake: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.JSON(fiber.Map{
+		"Data":      stocktake,
+		"Variances": variances,
+	})
+}
+
+// ยกเลิกรอบนับที่ยังไม่อนุมัติ (ไม่เปลี่ยน Inventory)
+func CancelStocktake(db *gorm.DB, c *fiber.Ctx) error {
+	var stocktake Models.Stocktakes
+	var failure *fiber.Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stocktake_id = ?", c.Params("id")).First(&stocktake).Error; err != nil {
+			failure = fiber.NewError(fiber.StatusNotFound, "Stocktake not found")
+			return nil
+		}
+		if !Middleware.CurrentUser(c).CanAccessBranch(stocktake.BranchID) {
+			failure = fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+			return nil
+		}
+		if stocktake.Status != "open" {
+			failure = fiber.NewError(fiber.StatusConflict, "Stocktake is already "+stocktake.Status)
+			return nil
+		}
+		stocktake.Status = "cancelled"
+		return tx.Model(&stocktake).Update("status", stocktake.Status).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel stocktake: " + err.Error(),
+		})
+	}
+	if failure != nil {
+		return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+	}
+	return c.JSON(fiber.Map{"Data": stocktake})
+}
+
+// ดูรอบนับของสาขา กรองด้วย ?status=
+func LookStocktakes(db *gorm.DB, c *fiber.Ctx) error {
+	query := scopeBranch(c, db, "branch_id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var stocktakes []Models.Stocktakes
+	if err := query.Order("created_at DESC").Find(&stocktakes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find stocktakes: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": stocktakes})
+}
+
+// ดูรอบนับพร้อมรายการสินค้าและประวัติการนับ
+func FindStocktake(db *gorm.DB, c *fiber.Ctx) error {
+	var stocktake Models.Stocktakes
+	if err := db.Preload("Lines").Where("stocktake_id = ?", c.Params("id")).First(&stocktake).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Stocktake not found",
+		})
+	}
+	if !canAccessBranch(c, stocktake.BranchID) {
+		return branchForbidden(c)
+	}
+	var counts []Models.StocktakeCounts
+	if err := db.Where("stocktake_id = ?", stocktake.StocktakeID).Order("created_at").Find(&counts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find counts: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"Data":   stocktake,
+		"Counts": counts,
+	})
+}
+
+// Route สำหรับรอบนับสต็อก
+func StocktakeRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/stocktakes", func(c *fiber.Ctx) error {
+		return LookStocktakes(db, c)
+	})
+	app.Get("/stocktakes/:id", func(c *fiber.Ctx) error {
+		return FindStocktake(db, c)
+	})
+	app.Get("/stocktakes/:id/variances", func(c *fiber.Ctx) error {
+		return LookStocktakeVariances(db, c)
+	})
+	app.Post("/stocktakes", func(c *fiber.Ctx) error {
+		return AddStocktake(db, c)
+	})
+	app.Post("/stocktakes/:id/counts", func(c *fiber.Ctx) error {
+		return AddStocktakeCounts(db, c)
+	})
+	app.Post("/stocktakes/:id/approve", func(c *fiber.Ctx) error {
+		return ApproveStocktake(db, c)
+	})
+	app.Post("/stocktakes/:id/cancel", func(c *fiber.Ctx) error {
+		return CancelStocktake(db, c)
+	})
+}
@@ -0,0 +1,65 @@
+package Database
+
+import (
+	"fmt"
+
+	"github.com/posproject/Models"
+)
+
+// อัตรา VAT มาตรฐานของประเทศไทย
+const defaultVatRate = 7.0
+
+// taxRule วิธีคิดภาษีของสินค้าหนึ่งรายการ
+type taxRule struct {
+	Mode string  // inclusive = ราคารวม VAT แล้ว, exclusive = ราคายังไม่รวม VAT, exempt = ได้รับยกเว้น VAT
+	Rate float64 // อัตรา VAT (%)
+}
+
+// หา taxRule ของสินค้า โดยค่าที่ตั้งไว้ที่ Product จะแทนค่าของ Category
+func resolveTaxRule(product Models.Product, category *Models.Category) taxRule {
+	rule := taxRule{Mode: "inclusive", Rate: defaultVatRate}
+	if category != nil {
+		if category.TaxMode != "" {
+			rule.Mode = category.TaxMode
+		}
+		rule.Rate = category.TaxRate
+	}
+	if product.TaxMode != "" {
+		rule.Mode = product.TaxMode
+	}
+	if product.TaxRate != nil {
+		rule.Rate = *product.TaxRate
+	}
+	if rule.Mode == "exempt" {
+		rule.Rate = 0
+	}
+	return rule
+}
+
+// คำนวณยอดก่อน VAT, VAT และยอดรวมของรายการขาย จากยอดตามราคาป้าย (ราคา x จำนวน)
+func computeLineTax(amount float64, rule taxRule) (net float64, vat float64, total float64) {
+	amount = roundMoney(amount)
+	switch rule.Mode {
+	case "exclusive":
+		vat = roundMoney(amount * rule.Rate / 100)
+		return amount, vat, roundMoney(amount + vat)
+	case "exempt":
+		return amount, 0, amount
+	default: // inclusive
+		vat = roundMoney(amount * rule.Rate / (100 + rule.Rate))
+		return roundMoney(amount - vat), vat, amount
+	}
+}
+
+// ตรวจสอบค่าการตั้งค่าภาษีที่ส่งมาจาก client
+func validateTaxSettings(mode string, rate *float64) error {
+	switch mode {
+	case "", "inclusive", "exclusive", "exempt":
+	default:
+		return fmt.Errorf("invalid tax mode: %s", mode)
+	}
+	if rate != nil && (*rate < 0 || *rate > 100) {
+		return fmt.Errorf("tax rate must be between 0 and 100")
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package Database
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Models"
+	"github.com/posproject/Printing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ตรวจสอบเลขประจำตัวผู้เสียภาษี 13 หลักด้วย checksum ของกรมสรรพากร
+// หลักที่ 13 = (11 - (ผลรวมของหลักที่ i คูณ (14 - i) สำหรับ i = 1..12) mod 11) mod 10
+func validThaiTaxID(taxID string) bool {
+	if len(taxID) != 13 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := taxID[i]
+		if d < '0' || d > '9' {
+			return false
+		}
+		sum += int(d-'0') * (13 - i)
+	}
+	last := taxID[12]
+	if last < '0' || last > '9' {
+		return false
+	}
+	return (11-sum%11)%10 == int(last-'0')
+}
+
+// ออกใบกำกับภาษีเต็มรูปจากใบเสร็จที่มีอยู่
+func AddTaxInvoice(db *gorm.DB, c *fiber.Ctx) error {
+	var req struct {
+		BuyerName    string `json:"buyername"`
+		BuyerAddress string `json:"buyeraddress"`
+		BuyerTaxID   string `json:"buyertaxid"`
+		BuyerBranch  string `json:"buyerbranch"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format: " + err.Error(),
+		})
+	}
+
+	req.BuyerTaxID = strings.ReplaceAll(strings.TrimSpace(req.BuyerTaxID), "-", "")
+	if strings.TrimSpace(req.BuyerName) == "" || strings.TrimSpace(req.BuyerAddress) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Buyer name and address are required",
+		})
+	}
+	if !validThaiTaxID(req.BuyerTaxID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid buyer tax ID",
+		})
+	}
+	if req.BuyerBranch == "" {
+		req.BuyerBranch = "สำนักงานใหญ่"
+	}
+
+	var invoice Models.TaxInvoices
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var receipt Models.Receipts
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("receipt_id = ?", c.Params("id")).First(&receipt).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Receipt not found")
+		}
+		if !canAccessBranch(c, receipt.BranchID) {
+			return fiber.NewError(fiber.StatusForbidden, "You do not have access to this branch")
+		}
+		if receipt.ReceiptType == "credit_note" {
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot issue a tax invoice for a credit note")
+		}
+
+		// lock การขายแบบ SHARE ไม่ให้ void/คืนเงินระหว่างออกใบกำกับภาษี
+		var sale Models.Sales
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("sale_id", "status").Where("sale_id = ?", receipt.SaleID).First(&sale).Error; err != nil {
+			return fiber.NewError(fiber.StatusNotFound, "Sale not found")
+		}
+		if sale.Status == "voided" || sale.Status == "refunded" {
+			return fiber.NewError(fiber.StatusConflict, "Cannot issue a tax invoice for a "+sale.Status+" sale")
+		}
+
+		var existing int64
+		if err := tx.Model(&Models.TaxInvoices{}).Where("receipt_id = ?", receipt.ReceiptID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return fiber.NewError(fiber.StatusConflict, "Tax invoice already issued for this receipt")
+		}
+
+		now := time.Now()
+		invoiceNumber, err := generateTaxInvoiceNumber(tx, receipt.BranchID, now)
+		if err != nil {
+			return err
+		}
+
+		invoice = Models.TaxInvoices{
+			TaxInvoiceID:  uuid.New().String(),
+			InvoiceNumber: invoiceNumber,
+			ReceiptID:     receipt.ReceiptID,
+			ReceiptNumber: receipt.ReceiptNumber,
+			SaleID:        receipt.SaleID,
+			BranchID:      receipt.BranchID,
+			BuyerName:     strings.TrimSpace(req.BuyerName),
+			BuyerAddress:  strings.TrimSpace(req.BuyerAddress),
+			BuyerTaxID:    req.BuyerTaxID,
+			BuyerBranch:   req.BuyerBranch,
+			NetAmount:     receipt.NetAmount,
+			VatAmount:     receipt.VatAmount,
+			TotalAmount:   receipt.TotalAmount,
+			IssuedBy:      claimString(c, "employeeid"),
+			IssuedAt:      now,
+		}
+		return tx.Create(&invoice).Error
+	})
+	if err != nil {
+		var ferr *fiber.Error
+		if errors.As(err, &ferr) {
+			return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create tax invoice: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"New": invoice})
+}
+
+// ดูใบกำกับภาษีทั้งหมด
+func LookTaxInvoices(db *gorm.DB, c *fiber.Ctx) error {
+	var invoices []Models.TaxInvoices
+	query := scopeBranch(c, db, "branch_id")
+	if err := query.Order("issued_at").Find(&invoices).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find tax invoices: " + err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"Data": invoices})
+}
+
+// หาใบกำกับภาษีตาม ID
+func FindTaxInvoice(db *gorm.DB, c *fiber.Ctx) error {
+	var invoice Models.TaxInvoices
+	if err := db.Where("tax_invoice_id = ?", c.Params("id")).First(&invoice).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tax invoice not found",
+		})
+	}
+	if !canAccessBranch(c, invoice.BranchID) {
+		return branchForbidden(c)
+	}
+	return c.JSON(fiber.Map{"Data": invoice})
+}
+
+// taxInvoiceLine รายการสินค้าที่แสดงบนใบกำกับภาษี
+type taxInvoiceLine struct {
+	No          int
+	ProductCode string
+	ProductName string
+	Quantity    int
+	UnitPrice   float64
+	NetAmount   float64
+}
+
+var taxInvoiceTemplate = template.Must(template.New("taxinvoice").Funcs(template.FuncMap{
+	"money": Printing.Money,
+}).Parse(`<!DOCTYPE html>
+<html lang="th">
+<head>
+<meta charset="utf-8">
+<title>{{.Invoice.InvoiceNumber}}</title>
+<style>
+body { font-family: "Sarabun", "TH Sarabun New", sans-serif; font-size: 14px; margin: 24px; }
+h1 { text-align: center; font-size: 20px; margin: 0 0 16px; }
+table { width: 100%; border-collapse: collapse; }
+.items th, .items td { border: 1px solid #000; padding: 4px 6px; }
+.items td.num { text-align: right; }
+.parties td { vertical-align: top; width: 50%; padding-bottom: 12px; }
+.totals td { padding: 2px 6px; text-align: right; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>ใบกำกับภาษี / TAX INVOICE</h1>
+<table class="parties">
+<tr>
+<td>
+<strong>ผู้ขาย</strong><br>
+{{.SellerName}}<br>
+{{.Branch.BName}}<br>
+{{.Branch.Location}}<br>
+เลขประจำตัวผู้เสียภาษี {{.Branch.TaxID}}
+</td>
+<td>
+เลขที่ {{.Invoice.InvoiceNumber}}<br>
+วันที่ {{.Invoice.IssuedAt.Format "02/01/2006"}}<br>
+อ้างอิงใบเสร็จ {{.Invoice.ReceiptNumber}}
+</td>
+</tr>
+<tr>
+<td colspan="2">
+<strong>ผู้ซื้อ</strong><br>
+{{.Invoice.BuyerName}} ({{.Invoice.BuyerBranch}})<br>
+{{.Invoice.BuyerAddress}}<br>
+เลขประจำตัวผู้เสียภาษี {{.Invoice.BuyerTaxID}}
+</td>
+</tr>
+</table>
+<table class="items">
+<thead>
+<tr><th>ลำดับ</th><th>รหัสสินค้า</th><th>รายการ</th><th>จำนวน</th><th>ราคาต่อหน่วย</th><th>จำนวนเงิน (ก่อน VAT)</th></tr>
+</thead>
+<tbody>
+{{range .Lines}}<tr><td class="num">{{.No}}</td><td>{{.ProductCode}}</td><td>{{.ProductName}}</td><td class="num">{{.Quantity}}</td><td class="num">{{money .UnitPrice}}</td><td class="num">{{money .NetAmount}}</td></tr>
+{{end}}
+</tbody>
+</table>
+<table class="totals">
+<tr><td>มูลค่าสินค้า</td><td>{{money .Invoice.NetAmount}}</td></tr>
+<tr><td>ภาษีมูลค่าเพิ่ม</td><td>{{money .Invoice.VatAmount}}</td></tr>
+<tr><td><strong>จำนวนเงินรวมทั้งสิ้น</strong></td><td><strong>{{money .Invoice.TotalAmount}}</strong></td></tr>
+</table>
+</body>
+</html>
+`))
+
+// พิมพ์ใบกำกับภาษีเป็น HTML สำหรับสั่งพิมพ์จาก browser
+func PrintTaxInvoice(db *gorm.DB, c *fiber.Ctx) error {
+	var invoice Models.TaxInvoices
+	if err := db.Where("tax_invoice_id = ?", c.Params("id")).First(&invoice).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tax invoice not found",
+		})
+	}
+	if !canAccessBranch(c, invoice.BranchID) {
+		return branchForbidden(c)
+	}
+
+	var branch Models.Branches
+	db.Where("branch_id = ?", invoice.BranchID).First(&branch)
+
+	var items []Models.ReceiptItems
+	if err := db.Where("receipt_id = ?", invoice.ReceiptID).Find(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find receipt items: " + err.Error(),
+		})
+	}
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var products []Models.Product
+	db.Where("product_id IN ?", productIDs).Find(&products)
+	productByID := make(map[string]Models.Product, len(products))
+	for _, p := range products {
+		productByID[p.ProductID] = p
+	}
+
+	lines := make([]taxInvoiceLine, 0, len(items))
+	for i, item := range items {
+		product := productByID[item.ProductID]
+		lines = append(lines, taxInvoiceLine{
+			No:          i + 1,
+			ProductCode: product.ProductCode,
+			ProductName: product.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   roundMoney(item.NetAmount / float64(item.Quantity)),
+			NetAmount:   item.NetAmount,
+		})
+	}
+
+	sellerName := os.Getenv("COMPANY_NAME")
+	if sellerName == "" {
+		sellerName = branch.BName
+	}
+
+	var buf bytes.Buffer
+	if err := taxInvoiceTemplate.Execute(&buf, fiber.Map{
+		"Invoice":    invoice,
+		"Branch":     branch,
+		"SellerName": sellerName,
+		"Lines":      lines,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render tax invoice: " + err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(buf.Bytes())
+}
+
+// Route สำหรับ Tax Invoices
+func TaxInvoiceRoutes(app *fiber.App, db *gorm.DB) {
+	app.Get("/taxinvoices", func(c *fiber.Ctx) error {
+		return LookTaxInvoices(db, c)
+	})
+	app.Get("/taxinvoices/:id", func(c *fiber.Ctx) error {
+		return FindTaxInvoice(db, c)
+	})
+	app.Get("/taxinvoices/:id/print", func(c *fiber.Ctx) error {
+		return PrintTaxInvoice(db, c)
+	})
+	app.Post("/receipts/:id/taxinvoice", func(c *fiber.Ctx) error {
+		return AddTaxInvoice(db, c)
+	})
+}
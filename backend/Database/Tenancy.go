@@ -0,0 +1,110 @@
+package Database
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/posproject/Middleware"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// กรอง query ให้เห็นเฉพาะข้อมูลของสาขาผู้ใช้
+// Super Admin เห็นทุกสาขาและกรองเองได้ด้วย ?branchid= ส่วน role อื่นถูกบังคับใช้ branchid จาก token
+// ถ้าระบุหลาย column (เช่น frombranchid/tobranchid) จะเห็นแถวที่ column ใดตรงกับสาขา
+func scopeBranch(c *fiber.Ctx, query *gorm.DB, columns ...string) *gorm.DB {
+	user := Middleware.CurrentUser(c)
+	branchID := user.BranchID
+	if user.AllBranches() {
+		branchID = c.Query("branchid")
+		if branchID == "" {
+			return query
+		}
+	} else if requested := c.Query("branchid"); requested != "" && requested != branchID {
+		logCrossBranch(c, user, requested)
+	}
+	if branchID == "" {
+		// ผู้ใช้ที่ไม่มีสาขาใน token จะไม่เห็นข้อมูลของสาขาใดเลย
+		return query.Where("1 = 0")
+	}
+
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = column + " = ?"
+		args[i] = branchID
+	}
+	return query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// กรองข้อมูลที่ไม่มี branch_id ของตัวเองผ่านตารางแม่ (เช่น SaleItems ผ่าน Sales)
+func scopeBranchVia(c *fiber.Ctx, db *gorm.DB, query *gorm.DB, column string, parent interface{}, parentKey string) *gorm.DB {
+	if Middleware.CurrentUser(c).AllBranches() && c.Query("branchid") == "" {
+		return query
+	}
+	return query.Where(column+" IN (?)", scopeBranch(c, db.Model(parent).Select(parentKey), "branch_id"))
+}
+
+// สาขาของการขาย ใช้ตรวจสิทธิ์ข้อมูลที่อ้างอิง sale_id
+func saleBranch(db *gorm.DB, saleID string) string {
+	var sale Models.Sales
+	db.Select("branch_id").Where("sale_id = ?", saleID).First(&sale)
+	return sale.BranchID
+}
+
+// สาขาของใบเสร็จ ใช้ตรวจสิทธิ์ข้อมูลที่อ้างอิง receipt_id
+func receiptBranch(db *gorm.DB, receiptID string) string {
+	var receipt Models.Receipts
+	db.Select("branch_id").Where("receipt_id = ?", receiptID).First(&receipt)
+	return receipt.BranchID
+}
+
+// ตรวจสอบว่าผู้ใช้เข้าถึงข้อมูลที่เป็นของสาขาใดสาขาหนึ่งใน branchIDs ได้หรือไม่ (บันทึก log ถ้าไม่ได้)
+func canAccessBranch(c *fiber.Ctx, branchIDs ...string) bool {
+	user := Middleware.CurrentUser(c)
+	for _, branchID := range branchIDs {
+		if user.CanAccessBranch(branchID) {
+			return true
+		}
+	}
+	logCrossBranch(c, user, strings.Join(branchIDs, ","))
+	return false
+}
+
+// สาขาที่ใช้บันทึกข้อมูลใหม่ โดยยึดตาม token แทนค่าที่ส่งมาใน body
+// Super Admin ระบุสาขาได้เอง ส่วน role อื่นถ้าส่งสาขาอื่นมาจะถูกปฏิเสธ
+func writeBranch(c *fiber.Ctx, requested string) (string, bool) {
+	user := Middleware.CurrentUser(c)
+	if user.AllBranches() {
+		if requested == "" {
+			return user.BranchID, true
+		}
+		return requested, true
+	}
+	if user.BranchID == "" || (requested != "" && requested != user.BranchID) {
+		logCrossBranch(c, user, requested)
+		return "", false
+	}
+	return user.BranchID, true
+}
+
+// ค่าของ branch id ที่เป็น pointer (nil = ไม่มีสาขา)
+func branchValue(branchID *string) string {
+	if branchID == nil {
+		return ""
+	}
+	return *branchID
+}
+
+// ตอบกลับเมื่อผู้ใช้พยายามเข้าถึงข้อมูลของสาขาอื่น
+func branchForbidden(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "You do not have access to this branch",
+	})
+}
+
+func logCrossBranch(c *fiber.Ctx, user Middleware.User, target string) {
+	log.Printf("cross-branch access denied: employee=%s role=%s branch=%s target=%s %s %s",
+		user.EmployeeID, user.Role, user.BranchID, target, c.Method(), c.OriginalURL())
+}
@@ -0,0 +1,261 @@
+package Database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute   // access token อายุสั้น ต่ออายุด้วย refresh token
+	refreshTokenTTL = 7 * 24 * time.Hour // refresh token ใช้ได้ครั้งเดียว และหมุนใหม่ทุกครั้งที่ต่ออายุ
+
+	terminalTokenTTL = 8 * time.Hour       // access token จาก PIN ใช้ได้ประมาณหนึ่งกะ
+	deviceTokenTTL   = 30 * 24 * time.Hour // device token ของเครื่อง POS
+)
+
+// hash ของ refresh token ที่เก็บในฐานข้อมูล (ไม่เก็บ token จริง)
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// claims ของ access token ที่มี jti และ token version ของพนักงาน
+func accessClaims(employee Models.Employees, branchID *string, ttl time.Duration) jwt.MapClaims {
+	var branch interface{} // ใช้ interface{} เพื่อให้เป็น null ได้
+	if branchID != nil {
+		branch = *branchID
+	}
+	return jwt.MapClaims{
+		"jti":        uuid.New().String(),
+		"employeeid": employee.EmployeeID,
+		"email":      employee.Email,
+		"name":       employee.Name,
+		"role":       employee.Role,
+		"branchid":   branch,
+		"tv":         employee.TokenVersion,
+		"exp":        time.Now().Add(ttl).Unix(),
+	}
+}
+
+func signClaims(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// สร้าง access token (JWT) สำหรับ login ด้วยรหัสผ่าน
+func signAccessToken(employee Models.Employees, branchID *string) (string, error) {
+	return signClaims(accessClaims(employee, branchID, accessTokenTTL))
+}
+
+// สร้าง access token สำหรับ login ด้วย PIN ผูกกับเครื่อง POS และสาขาของเครื่อง
+// ไม่มี refresh token พนักงานใส่ PIN ใหม่เมื่อหมดอายุหรือเปลี่ยนคน
+func signTerminalAccessToken(employee Models.Employees, device Models.PosDevices) (string, error) {
+	claims := accessClaims(employee, &device.BranchID, terminalTokenTTL)
+	claims["deviceid"] = device.DeviceID
+	return signClaims(claims)
+}
+
+// สร้าง device token ให้เครื่อง POS ใช้เรียก /login/pin (ใช้กับ route อื่นไม่ได้)
+func signDeviceToken(device Models.PosDevices) (string, error) {
+	return signClaims(jwt.MapClaims{
+		"typ":      "device",
+		"deviceid": device.DeviceID,
+		"branchid": device.BranchID,
+		"exp":      time.Now().Add(deviceTokenTTL).Unix(),
+	})
+}
+
+// ตรวจสอบ device token และคืน device id
+func parseDeviceToken(token string) (string, bool) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil || claims["typ"] != "device" {
+		return "", false
+	}
+	deviceID, _ := claims["deviceid"].(string)
+	return deviceID, deviceID != ""
+}
+
+// ออก refresh token ใหม่ในตระกูลเดียวกัน (familyID ว่าง = login ใหม่)
+func issueRefreshToken(tx *gorm.DB, employee Models.Employees, branchID *string, familyID string) (string, Models.RefreshTokens, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", Models.RefreshTokens{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	record := Models.RefreshTokens{
+		TokenID:      uuid.New().String(),
+		FamilyID:     familyID,
+		EmployeeID:   employee.EmployeeID,
+		TokenHash:    hashRefreshToken(token),
+		BranchID:     branchID,
+		TokenVersion: employee.TokenVersion,
+		ExpiresAt:    time.Now().Add(refreshTokenTTL),
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", record, err
+	}
+	return token, record, nil
+}
+
+// ออก access token และ refresh token คู่กันสำหรับตอบกลับ client
+func issueTokenPair(tx *gorm.DB, employee Models.Employees, branchID *string, familyID string) (fiber.Map, Models.RefreshTokens, error) {
+	accessToken, err := signAccessToken(employee, branchID)
+	if err != nil {
+		return nil, Models.RefreshTokens{}, err
+	}
+	refreshToken, record, err := issueRefreshToken(tx, employee, branchID, familyID)
+	if err != nil {
+		return nil, record, err
+	}
+	return fiber.Map{
+		"token":        accessToken,
+		"refreshtoken": refreshToken,
+		"expiresin":    int(accessTokenTTL.Seconds()),
+	}, record, nil
+}
+
+// ยกเลิก token ทั้งหมดของพนักงาน (ใช้เมื่อลบพนักงาน เปลี่ยน role/สาขา หรือรีเซ็ตรหัสผ่าน)
+// access token เดิมจะใช้ไม่ได้ทันทีเพราะ token version ไม่ตรง และ refresh token ทั้งหมดถูก revoke
+func invalidateEmployeeTokens(tx *gorm.DB, employeeID string) error {
+	if err := tx.Model(&Models.Employees{}).Where("employee_id = ?", employeeID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Models.RefreshTokens{}).
+		Where("employee_id = ? AND revoked_at IS NULL", employeeID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RefreshTokenHandler ต่ออายุ access token ด้วย refresh token และหมุน refresh token ใหม่
+// ถ้า refresh token ที่ถูกใช้ไปแล้วถูกนำมาใช้ซ้ำ จะยกเลิก token ทั้งตระกูล (กรณีถูกขโมย)
+func RefreshTokenHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			RefreshToken string `json:"refreshtoken"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.RefreshToken == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Refresh token is required",
+			})
+		}
+
+		var response fiber.Map
+		var failure *fiber.Error
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var record Models.RefreshTokens
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("token_hash = ?", hashRefreshToken(body.RefreshToken)).
+				First(&record).Error; err != nil {
+				failure = fiber.NewError(fiber.StatusUnauthorized, "Invalid refresh token")
+				return nil
+			}
+
+			now := time.Now()
+			if record.RevokedAt != nil {
+				// ใช้ซ้ำ: ยกเลิกทุก token ในตระกูลนี้ (commit การยกเลิกแม้จะตอบ 401)
+				failure = fiber.NewError(fiber.StatusUnauthorized, "Refresh token has been revoked")
+				return tx.Model(&Models.RefreshTokens{}).
+					Where("family_id = ? AND revoked_at IS NULL", record.FamilyID).
+					Update("revoked_at", now).Error
+			}
+			if now.After(record.ExpiresAt) {
+				failure = fiber.NewError(fiber.StatusUnauthorized, "Refresh token has expired")
+				return nil
+			}
+
+			var employee Models.Employees
+			if err := tx.Where("employee_id = ?", record.EmployeeID).First(&employee).Error; err != nil || employee.TokenVersion != record.TokenVersion {
+				failure = fiber.NewError(fiber.StatusUnauthorized, "Refresh token has been revoked")
+				return nil
+			}
+
+			pair, next, err := issueTokenPair(tx, employee, record.BranchID, record.FamilyID)
+			if err != nil {
+				return err
+			}
+			response = pair
+			return tx.Model(&Models.RefreshTokens{}).Where("token_id = ?", record.TokenID).
+				Updates(map[string]interface{}{"revoked_at": now, "replaced_by": next.TokenID}).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not refresh token: " + err.Error(),
+			})
+		}
+		if failure != nil {
+			return c.Status(failure.Code).JSON(fiber.Map{"error": failure.Message})
+		}
+		return c.JSON(response)
+	}
+}
+
+// LogoutHandler ยกเลิก access token ปัจจุบันและ refresh token ที่ส่งมา
+// ส่ง {"all": true} เพื่อออกจากระบบทุกอุปกรณ์
+func LogoutHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			RefreshToken string `json:"refreshtoken"`
+			All          bool   `json:"all"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid JSON format: " + err.Error(),
+				})
+			}
+		}
+
+		claims, _ := c.Locals("user").(jwt.MapClaims)
+		employeeID := claimString(c, "employeeid")
+		expiresAt := time.Now().Add(accessTokenTTL)
+		if exp, ok := claims["exp"].(float64); ok {
+			expiresAt = time.Unix(int64(exp), 0)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if jti := claimString(c, "jti"); jti != "" {
+				revoked := Models.RevokedTokens{JTI: jti, ExpiresAt: expiresAt, RevokedAt: time.Now()}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+					return err
+				}
+			}
+			if body.All {
+				return invalidateEmployeeTokens(tx, employeeID)
+			}
+			if body.RefreshToken != "" {
+				if err := tx.Model(&Models.RefreshTokens{}).
+					Where("token_hash = ? AND employee_id = ? AND revoked_at IS NULL", hashRefreshToken(body.RefreshToken), employeeID).
+					Update("revoked_at", time.Now()).Error; err != nil {
+					return err
+				}
+			}
+			// ลบรายการที่หมดอายุแล้ว เพราะ token เหล่านั้นใช้ไม่ได้อยู่แล้ว
+			return tx.Where("expires_at < ?", time.Now()).Delete(&Models.RevokedTokens{}).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to logout: " + err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{"message": "Logged out"})
+	}
+}
@@ -2,18 +2,58 @@ package Database
 
 import (
 	"log"
-	"os"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/posproject/Models"
+	"github.com/posproject/Security"
 	"golang.org/x/crypto/bcrypt" // import bcrypt
 	"gorm.io/gorm"
 )
 
+// บันทึกประวัติการ login ด้วยรหัสผ่าน
+func recordLoginAudit(db *gorm.DB, c *fiber.Ctx, email string, employeeID *string, result string) {
+	saveLoginAudit(db, c, Models.LoginAudits{
+		Email:      email,
+		EmployeeID: employeeID,
+		Method:     "password",
+		Result:     result,
+	})
+}
+
+// บันทึกประวัติการ login (ไม่ให้ error ของการบันทึกทำให้ login ล้มเหลว)
+func saveLoginAudit(db *gorm.DB, c *fiber.Ctx, audit Models.LoginAudits) {
+	audit.IP = c.IP()
+	audit.UserAgent = c.Get(fiber.HeaderUserAgent)
+	audit.CreatedAt = time.Now()
+	if err := db.Create(&audit).Error; err != nil {
+		log.Println("Error recording login audit: ", err)
+	}
+}
+
+// ตอบ 429 พร้อม header Retry-After (วินาที)
+func tooManyAttempts(c *fiber.Ctx, decision Security.Decision) error {
+	seconds := int(math.Ceil(decision.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	message := "Too many failed login attempts, please try again later"
+	if decision.Locked {
+		message = "Account is temporarily locked due to too many failed login attempts"
+	}
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":      message,
+		"retryafter": seconds,
+	})
+}
+
 // LoginHandler สำหรับการ login และสร้าง token
-func LoginHandler(db *gorm.DB) fiber.Handler {
+// guard นับการ login ผิดต่อบัญชีและต่อ IP เพื่อหน่วงเวลาและล็อกชั่วคราว
+func LoginHandler(db *gorm.DB, guard *Security.Guard) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// รับข้อมูลจาก body (เช่น email, password และ branchid)
 		var body struct {
@@ -27,62 +67,78 @@ func LoginHandler(db *gorm.DB) fiber.Handler {
 			})
 		}
 
-		// ค้นหาผู้ใช้จากฐานข้อมูล
-		var employee Models.Employees
-		if err := db.Where("email = ?", body.Email).First(&employee).Error; err != nil {
+		// ตรวจสอบว่าบัญชีหรือ IP นี้ถูกหน่วงเวลา/ล็อกอยู่หรือไม่ ก่อนตรวจรหัสผ่าน
+		decision, err := guard.Check(body.Email, c.IP())
+		if err != nil {
+			log.Println("Error checking login attempts: ", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not verify login attempts",
+			})
+		}
+		if !decision.Allowed {
+			result := "throttled"
+			if decision.Locked {
+				result = "locked"
+			}
+			recordLoginAudit(db, c, body.Email, nil, result)
+			return tooManyAttempts(c, decision)
+		}
+
+		// login ผิด: นับทั้งกรณีไม่พบ email และรหัสผ่านผิด เพื่อไม่ให้ใช้เดาว่ามี email ใดในระบบ
+		invalidCredentials := func(employeeID *string) error {
+			if _, err := guard.Failure(body.Email, c.IP()); err != nil {
+				log.Println("Error recording failed login: ", err)
+			}
+			recordLoginAudit(db, c, body.Email, employeeID, "invalid_credentials")
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid credentials",
 			})
 		}
 
+		// ค้นหาผู้ใช้จากฐานข้อมูล
+		var employee Models.Employees
+		if err := db.Where("email = ?", body.Email).First(&employee).Error; err != nil {
+			return invalidCredentials(nil)
+		}
+
 		// ตรวจสอบ password (ใช้ bcrypt ในการตรวจสอบ)
-		err := bcrypt.CompareHashAndPassword([]byte(employee.Password), []byte(body.Password))
+		err = bcrypt.CompareHashAndPassword([]byte(employee.Password), []byte(body.Password))
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid credentials",
-			})
+			return invalidCredentials(&employee.EmployeeID)
 		}
 
 		// ตั้งค่า branchid ตาม role
-		var branchID interface{} // ใช้ interface{} เพื่อให้รับค่า nil ได้
+		branchID := employee.BranchID // ถ้าไม่ใช่ Super Admin ใช้ branchid จากฐานข้อมูล
 		if employee.Role == "Super Admin" {
 			// ถ้าเป็น Super Admin ใช้ branchid ที่ถูกส่งมา (หรือ nil ถ้าไม่มี)
-			if body.BranchID != nil {
-				branchID = *body.BranchID
-			} else {
-				branchID = nil
-			}
-		} else {
-			// ถ้าไม่ใช่ Super Admin ใช้ branchid จากฐานข้อมูล
-			branchID = employee.BranchID
-		}
-
-		// สร้าง JWT token
-		claims := jwt.MapClaims{
-			"employeeid": employee.EmployeeID,
-			"email":      employee.Email,
-			"name":       employee.Name,
-			"role":       employee.Role,
-			"branchid":   branchID,                              // ใช้ branchid ที่กำหนดด้านบน
-			"exp":        time.Now().Add(time.Hour * 24).Unix(), // กำหนดวันหมดอายุเป็น 1 วัน
+			branchID = body.BranchID
 		}
 
-		// สร้าง JWT token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-		// เซ็นชื่อด้วย secret key
-		secretKey := []byte(os.Getenv("JWT_SECRET"))
-		tokenString, err := token.SignedString(secretKey)
+		// สร้าง access token อายุสั้น และ refresh token ที่เก็บไว้ฝั่ง server
+		tokens, _, err := issueTokenPair(db, employee, branchID, "")
 		if err != nil {
-			log.Fatal("Error signing the token: ", err)
+			log.Println("Error issuing tokens: ", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Could not generate token",
 			})
 		}
 
+		if err := guard.Success(body.Email); err != nil {
+			log.Println("Error resetting login attempts: ", err)
+		}
+		recordLoginAudit(db, c, body.Email, &employee.EmployeeID, "success")
+
 		// ส่ง token กลับ
-		return c.JSON(fiber.Map{
-			"token": tokenString,
-		})
+		return c.JSON(tokens)
+	}
+}
+
+// ดึงค่าจาก JWT claims ที่ Middleware.IsAuthenticated เก็บไว้ใน c.Locals("user")
+func claimString(c *fiber.Ctx, key string) string {
+	claims, ok := c.Locals("user").(jwt.MapClaims)
+	if !ok {
+		return ""
 	}
+	value, _ := claims[key].(string)
+	return value
 }
@@ -0,0 +1,181 @@
+package Forecast
+
+import (
+	"math"
+	"time"
+)
+
+// Options การตั้งค่าการพยากรณ์ความต้องการสินค้า
+type Options struct {
+	Window       int     `json:"window"`       // จำนวนวันย้อนหลังที่ใช้คิด moving average
+	SeasonWeeks  int     `json:"seasonweeks"`  // จำนวนสัปดาห์ย้อนหลังที่ใช้คิดสัดส่วนของแต่ละวันในสัปดาห์
+	Horizon      int     `json:"horizon"`      // จำนวนวันที่พยากรณ์ล่วงหน้า (ใช้หาวันที่สินค้าหมด)
+	LeadTimeDays int     `json:"leadtimedays"` // จำนวนวันตั้งแต่สั่งจนสินค้าเข้าสาขา
+	ReviewDays   int     `json:"reviewdays"`   // รอบการสั่งสินค้า (สั่งแล้วต้องพอถึงรอบถัดไป)
+	SafetyDays   float64 `json:"safetydays"`   // stock สำรองคิดเป็นจำนวนวันของยอดขายเฉลี่ย
+}
+
+// DefaultOptions ค่าเริ่มต้น: เฉลี่ย 28 วัน, สัดส่วนวันในสัปดาห์จาก 8 สัปดาห์, พยากรณ์ 90 วัน
+var DefaultOptions = Options{
+	Window:       28,
+	SeasonWeeks:  8,
+	Horizon:      90,
+	LeadTimeDays: 3,
+	ReviewDays:   7,
+	SafetyDays:   2,
+}
+
+// HistoryDays จำนวนวันของประวัติการขายที่ต้องใช้
+func (o Options) HistoryDays() int {
+	if o.SeasonWeeks*7 > o.Window {
+		return o.SeasonWeeks * 7
+	}
+	return o.Window
+}
+
+// DailyDemand ยอดขาย (จำนวนชิ้น) ของสินค้าในหนึ่งวัน
+type DailyDemand struct {
+	Date     time.Time
+	Quantity float64
+}
+
+// Result ผลการพยากรณ์ของ Inventory หนึ่งรายการ
+type Result struct {
+	AverageDaily    float64    `json:"averagedaily"`    // moving average ต่อวัน
+	WeekdayFactors  [7]float64 `json:"weekdayfactors"`  // สัดส่วนของวันอาทิตย์-เสาร์เทียบกับค่าเฉลี่ย
+	DaysOfCover     *float64   `json:"daysofcover"`     // stock พอขายได้กี่วัน (null = ไม่หมดภายใน horizon)
+	StockoutDate    *time.Time `json:"stockoutdate"`    // วันที่คาดว่าสินค้าจะหมด
+	ReorderQuantity int        `json:"reorderquantity"` // จำนวนที่ควรสั่งเพิ่ม
+}
+
+// เวลาเที่ยงคืนของวันเดียวกันใน location ที่กำหนด
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// DailySeries เรียงยอดขายเป็นรายวัน days วันก่อนวัน asOf (เก่าไปใหม่) วันที่ไม่มียอดขายเป็น 0
+// วันที่ของ history ใช้เฉพาะปี/เดือน/วัน จึงได้ผลเหมือนกันไม่ว่าจะอ่านมาจากฐานข้อมูลใน timezone ใด
+func DailySeries(history []DailyDemand, asOf time.Time, days int) []float64 {
+	series := make([]float64, days)
+	if days <= 0 {
+		return series
+	}
+	loc := asOf.Location()
+	start := startOfDay(asOf, loc).AddDate(0, 0, -days)
+	for _, h := range history {
+		day := startOfDay(h.Date, loc)
+		index := int(math.Round(day.Sub(start).Hours() / 24))
+		if index >= 0 && index < days {
+			series[index] += h.Quantity
+		}
+	}
+	return series
+}
+
+// MovingAverage ค่าเฉลี่ยของ window วันล่าสุดใน series
+func MovingAverage(series []float64, window int) float64 {
+	if window <= 0 || len(series) == 0 {
+		return 0
+	}
+	if window > len(series) {
+		window = len(series)
+	}
+	var sum float64
+	for _, v := range series[len(series)-window:] {
+		sum += v
+	}
+	return sum / float64(window)
+}
+
+// WeekdayFactors สัดส่วนยอดขายของแต่ละวันในสัปดาห์ (index ตาม time.Weekday) เทียบกับค่าเฉลี่ยทั้งหมด
+// series ต้องจบที่วันก่อน asOf ถ้าข้อมูลไม่ถึงสองสัปดาห์หรือไม่มียอดขายเลย ทุกวันมีค่าเป็น 1
+func WeekdayFactors(series []float64, asOf time.Time) [7]float64 {
+	factors := [7]float64{1, 1, 1, 1, 1, 1, 1}
+	if len(series) < 14 {
+		return factors
+	}
+	// ใช้เฉพาะสัปดาห์เต็มล่าสุด ให้ทุกวันมีจำนวนตัวอย่างเท่ากัน
+	series = series[len(series)%7:]
+
+	var sums [7]float64
+	var total float64
+	start := startOfDay(asOf, asOf.Location()).AddDate(0, 0, -len(series))
+	for i, v := range series {
+		sums[start.AddDate(0, 0, i).Weekday()] += v
+		total += v
+	}
+	if total <= 0 {
+		return factors
+	}
+	mean := total / 7
+	for day := range factors {
+		factors[day] = sums[day] / mean
+	}
+	return factors
+}
+
+// Project พยากรณ์ยอดขายรายวัน days วันนับจาก start
+func Project(average float64, factors [7]float64, start time.Time, days int) []float64 {
+	daily := make([]float64, days)
+	start = startOfDay(start, start.Location())
+	for i := range daily {
+		daily[i] = average * factors[start.AddDate(0, 0, i).Weekday()]
+	}
+	return daily
+}
+
+// DaysOfCover จำนวนวันที่ stock onHand พอขายตามยอดพยากรณ์ (มีเศษของวันได้)
+// ok = false ถ้าสินค้าไม่หมดภายในช่วงที่พยากรณ์
+func DaysOfCover(onHand float64, daily []float64) (float64, bool) {
+	remaining := onHand
+	if remaining <= 0 {
+		return 0, true
+	}
+	for i, demand := range daily {
+		if demand >= remaining {
+			return float64(i) + remaining/demand, true
+		}
+		remaining -= demand
+	}
+	return float64(len(daily)), false
+}
+
+// ReorderQuantity จำนวนที่ควรสั่งให้พอขายจนสินค้าล็อตถัดไปเข้า (lead time + review) รวม safety stock
+// position คือจำนวนคงเหลือรวมสินค้าที่กำลังเข้ามา
+func ReorderQuantity(position int, average float64, daily []float64, opts Options) int {
+	days := opts.LeadTimeDays + opts.ReviewDays
+	if days > len(daily) {
+		days = len(daily)
+	}
+	var need float64
+	for _, demand := range daily[:days] {
+		need += demand
+	}
+	need += opts.SafetyDays * average
+	quantity := int(math.Ceil(need - float64(position) - 1e-9))
+	if quantity < 0 {
+		return 0
+	}
+	return quantity
+}
+
+// Evaluate พยากรณ์ความต้องการจากประวัติการขาย ณ เวลา asOf
+// ผลลัพธ์ขึ้นกับข้อมูลที่ส่งเข้ามาเท่านั้น (ไม่อ่านเวลาปัจจุบันหรือฐานข้อมูล)
+func Evaluate(history []DailyDemand, onHand int, incoming int, asOf time.Time, opts Options) Result {
+	series := DailySeries(history, asOf, opts.HistoryDays())
+	result := Result{
+		AverageDaily:   MovingAverage(series, opts.Window),
+		WeekdayFactors: WeekdayFactors(series, asOf),
+	}
+	daily := Project(result.AverageDaily, result.WeekdayFactors, asOf, opts.Horizon)
+
+	if cover, ok := DaysOfCover(float64(onHand), daily); ok {
+		cover = math.Round(cover*100) / 100
+		result.DaysOfCover = &cover
+		stockout := startOfDay(asOf, asOf.Location()).AddDate(0, 0, int(cover))
+		result.StockoutDate = &stockout
+	}
+	result.ReorderQuantity = ReorderQuantity(onHand+incoming, result.AverageDaily, daily, opts)
+	return result
+}
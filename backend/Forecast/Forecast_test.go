@@ -0,0 +1,253 @@
+package Forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// จันทร์ 19 ต.ค. 2026 10:00 ตามเวลาไทย
+var testAsOf = time.Date(2026, 10, 19, 10, 0, 0, 0, time.FixedZone("ICT", 7*3600))
+
+func floatEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// ยอดขายรายวัน days วันก่อน asOf ตามจำนวนของแต่ละวันในสัปดาห์
+func weekdayHistory(asOf time.Time, days int, perWeekday [7]float64) []DailyDemand {
+	var history []DailyDemand
+	for d := 1; d <= days; d++ {
+		date := asOf.AddDate(0, 0, -d)
+		if qty := perWeekday[date.Weekday()]; qty != 0 {
+			history = append(history, DailyDemand{Date: date, Quantity: qty})
+		}
+	}
+	return history
+}
+
+// series ยาว days วันที่มียอดขายตามวันในสัปดาห์ (จบที่วันก่อน asOf)
+func weekdaySeries(asOf time.Time, days int, perWeekday [7]float64) []float64 {
+	series := make([]float64, days)
+	start := startOfDay(asOf, asOf.Location()).AddDate(0, 0, -days)
+	for i := range series {
+		series[i] = perWeekday[start.AddDate(0, 0, i).Weekday()]
+	}
+	return series
+}
+
+func constant(value float64, days int) []float64 {
+	daily := make([]float64, days)
+	for i := range daily {
+		daily[i] = value
+	}
+	return daily
+}
+
+func TestDailySeries(t *testing.T) {
+	cases := []struct {
+		name    string
+		history []DailyDemand
+		days    int
+		want    []float64
+	}{
+		{"no history", nil, 3, []float64{0, 0, 0}},
+		{"zero days", []DailyDemand{{Date: testAsOf.AddDate(0, 0, -1), Quantity: 5}}, 0, []float64{}},
+		{
+			"same day is summed",
+			[]DailyDemand{
+				{Date: testAsOf.AddDate(0, 0, -1), Quantity: 2},
+				{Date: testAsOf.AddDate(0, 0, -1).Add(-3 * time.Hour), Quantity: 3},
+				{Date: testAsOf.AddDate(0, 0, -3), Quantity: 1},
+			},
+			3,
+			[]float64{1, 0, 5},
+		},
+		{
+			"outside window and today ignored",
+			[]DailyDemand{
+				{Date: testAsOf.AddDate(0, 0, -4), Quantity: 9},
+				{Date: testAsOf, Quantity: 9},
+				{Date: testAsOf.AddDate(0, 0, -2), Quantity: 4},
+			},
+			3,
+			[]float64{0, 4, 0},
+		},
+		{
+			"date from database in UTC uses calendar day",
+			[]DailyDemand{{Date: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), Quantity: 7}},
+			3,
+			[]float64{0, 0, 7},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DailySeries(tc.history, testAsOf, tc.days)
+			if len(got) != len(tc.want) {
+				t.Fatalf("len = %d, want %d", len(got), len(tc.want))
+			}
+			for i := range got {
+				if !floatEqual(got[i], tc.want[i]) {
+					t.Fatalf("series = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	cases := []struct {
+		name   string
+		series []float64
+		window int
+		want   float64
+	}{
+		{"empty series", nil, 7, 0},
+		{"zero window", []float64{1, 2, 3}, 0, 0},
+		{"latest days only", []float64{1, 2, 3, 4, 5}, 3, 4},
+		{"window longer than series", []float64{2, 4}, 7, 3},
+		{"zero history", constant(0, 28), 28, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MovingAverage(tc.series, tc.window); !floatEqual(got, tc.want) {
+				t.Fatalf("MovingAverage = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWeekdayFactors(t *testing.T) {
+	ones := [7]float64{1, 1, 1, 1, 1, 1, 1}
+	saturdayOnly := weekdaySeries(testAsOf, 14, [7]float64{time.Saturday: 7})
+
+	// วันแรกของ series 15 วันไม่ครบสัปดาห์ ต้องถูกตัดทิ้ง
+	trimmed := append([]float64{1000}, weekdaySeries(testAsOf, 14, [7]float64{1, 1, 1, 1, 1, 1, 1})...)
+
+	cases := []struct {
+		name   string
+		series []float64
+		want   [7]float64
+	}{
+		{"less than two weeks", constant(5, 13), ones},
+		{"zero history", constant(0, 56), ones},
+		{"flat demand", constant(3, 56), ones},
+		{"saturday only", saturdayOnly, [7]float64{time.Saturday: 7}},
+		{
+			"weekend double",
+			weekdaySeries(testAsOf, 28, [7]float64{2, 1, 1, 1, 1, 1, 2}),
+			[7]float64{2 / (9.0 / 7), 1 / (9.0 / 7), 1 / (9.0 / 7), 1 / (9.0 / 7), 1 / (9.0 / 7), 1 / (9.0 / 7), 2 / (9.0 / 7)},
+		},
+		{"partial week trimmed", trimmed, ones},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := WeekdayFactors(tc.series, testAsOf)
+			for day := range got {
+				if !floatEqual(got[day], tc.want[day]) {
+					t.Fatalf("factors = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDaysOfCover(t *testing.T) {
+	cases := []struct {
+		name   string
+		onHand float64
+		daily  []float64
+		want   float64
+		ok     bool
+	}{
+		{"out of stock", 0, constant(4, 5), 0, true},
+		{"negative stock", -3, constant(4, 5), 0, true},
+		{"runs out mid day", 10, constant(4, 5), 2.5, true},
+		{"runs out at end of day", 8, constant(4, 5), 2, true},
+		{"lasts past horizon", 100, constant(1, 2), 2, false},
+		{"zero velocity", 5, constant(0, 3), 3, false},
+		{"uneven days", 10, []float64{0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 7}, 12 + 3.0/7, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := DaysOfCover(tc.onHand, tc.daily)
+			if !floatEqual(got, tc.want) || ok != tc.ok {
+				t.Fatalf("DaysOfCover = %v, %v; want %v, %v", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestReorderQuantity(t *testing.T) {
+	opts := Options{LeadTimeDays: 3, ReviewDays: 7, SafetyDays: 2}
+	cases := []struct {
+		name     string
+		position int
+		average  float64
+		daily    []float64
+		want     int
+	}{
+		{"covers lead time, review and safety", 10, 2, constant(2, 90), 14},
+		{"exact need is not rounded up", 0, 2, constant(2, 90), 24},
+		{"fractional need rounds up", 0, 1.1, constant(1.1, 90), 14},
+		{"enough stock", 30, 2, constant(2, 90), 0},
+		{"horizon shorter than lead time", 0, 2, constant(2, 5), 14},
+		{"zero velocity", 0, 0, constant(0, 90), 0},
+		{"negative position", -5, 0, constant(0, 90), 5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ReorderQuantity(tc.position, tc.average, tc.daily, opts); got != tc.want {
+				t.Fatalf("ReorderQuantity = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	day := func(offset int) *time.Time {
+		d := startOfDay(testAsOf, testAsOf.Location()).AddDate(0, 0, offset)
+		return &d
+	}
+	cover := func(v float64) *float64 { return &v }
+
+	cases := []struct {
+		name     string
+		history  []DailyDemand
+		onHand   int
+		incoming int
+		cover    *float64
+		stockout *time.Time
+		reorder  int
+		average  float64
+	}{
+		{"zero history", nil, 5, 0, nil, nil, 0, 0},
+		{"zero history out of stock", nil, 0, 0, cover(0), day(0), 0, 0},
+		{"steady demand", weekdayHistory(testAsOf, 56, [7]float64{4, 4, 4, 4, 4, 4, 4}), 10, 0, cover(2.5), day(2), 38, 4},
+		{"incoming stock reduces reorder", weekdayHistory(testAsOf, 56, [7]float64{4, 4, 4, 4, 4, 4, 4}), 10, 20, cover(2.5), day(2), 18, 4},
+		{"saturday demand", weekdayHistory(testAsOf, 56, [7]float64{time.Saturday: 7}), 10, 0, cover(12.43), day(12), 0, 1},
+		{"saturday demand out of stock", weekdayHistory(testAsOf, 56, [7]float64{time.Saturday: 7}), 0, 0, cover(0), day(0), 9, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Evaluate(tc.history, tc.onHand, tc.incoming, testAsOf, DefaultOptions)
+			if !floatEqual(got.AverageDaily, tc.average) {
+				t.Fatalf("AverageDaily = %v, want %v", got.AverageDaily, tc.average)
+			}
+			switch {
+			case tc.cover == nil && got.DaysOfCover != nil:
+				t.Fatalf("DaysOfCover = %v, want nil", *got.DaysOfCover)
+			case tc.cover != nil && (got.DaysOfCover == nil || !floatEqual(*got.DaysOfCover, *tc.cover)):
+				t.Fatalf("DaysOfCover = %v, want %v", got.DaysOfCover, *tc.cover)
+			}
+			switch {
+			case tc.stockout == nil && got.StockoutDate != nil:
+				t.Fatalf("StockoutDate = %v, want nil", *got.StockoutDate)
+			case tc.stockout != nil && (got.StockoutDate == nil || !got.StockoutDate.Equal(*tc.stockout)):
+				t.Fatalf("StockoutDate = %v, want %v", got.StockoutDate, *tc.stockout)
+			}
+			if got.ReorderQuantity != tc.reorder {
+				t.Fatalf("ReorderQuantity = %d, want %d", got.ReorderQuantity, tc.reorder)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package Middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// key ของ pg_advisory_xact_lock ที่ใช้เรียงลำดับการเพิ่ม AuditLogs ให้ต่อ hash กันถูกต้อง
+const auditChainLock = 7341001
+
+// ขนาดสูงสุดของ request body ที่เก็บใน AuditLogs
+const auditMaxRequestBody = 8 * 1024
+
+// ตารางและ primary key ของ entity ตาม segment แรกของ path ใช้ดึงข้อมูลก่อน/หลังการเปลี่ยนแปลง
+var auditEntities = map[string]struct {
+	Table string
+	Key   string
+}{
+	"branches":       {"Branches", "branch_id"},
+	"employees":      {"Employees", "employee_id"},
+	"products":       {"Products", "product_id"},
+	"categories":     {"Category", "category_id"},
+	"promotions":     {"Promotions", "promotion_id"},
+	"inventory":      {"Inventory", "inventory_id"},
+	"stocktakes":     {"Stocktakes", "stocktake_id"},
+	"sales":          {"Sales", "sale_id"},
+	"saleitems":      {"SaleItems", "sale_item_id"},
+	"receipts":       {"Receipts", "receipt_id"},
+	"receiptitems":   {"ReceiptItems", "receipt_item_id"},
+	"customers":      {"Customers", "customer_id"},
+	"requests":       {"Requests", "request_id"},
+	"shipments":      {"Shipments", "shipment_id"},
+	"replenishments": {"ReplenishmentSuggestions", "suggestion_id"},
+	"devices":        {"PosDevices", "device_id"},
+	"shifts":         {"Shifts", "shift_id"},
+}
+
+// field ที่ห้ามเก็บค่าจริงใน AuditLogs
+var auditRedactedFields = map[string]bool{
+	"password":      true,
+	"pin":           true,
+	"pin_hash":      true,
+	"secret":        true,
+	"secret_hash":   true,
+	"token":         true,
+	"token_hash":    true,
+	"refreshtoken":  true,
+	"devicetoken":   true,
+	"token_version": true,
+}
+
+// AuditTrail บันทึก AuditLogs ของทุก request ที่เป็น POST/PUT/PATCH/DELETE
+// ต้องใช้หลัง IsAuthenticated เพื่อให้รู้ว่าใครเป็นผู้ทำรายการ
+func AuditTrail(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		method := c.Method()
+		if method != fiber.MethodPost && method != fiber.MethodPut && method != fiber.MethodPatch && method != fiber.MethodDelete {
+			return c.Next()
+		}
+
+		entity, entityID, action := auditTarget(method, c.Path())
+		before := auditSnapshot(db, entity, entityID)
+		request := auditRequestBody(c.Body())
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		// รายการที่สร้างใหม่ใช้ id จาก response
+		if entityID == "" && status < 400 {
+			entityID = auditCreatedID(entity, c.Response().Body())
+		}
+		var after map[string]interface{}
+		if status < 400 {
+			after = auditSnapshot(db, entity, entityID)
+		}
+
+		user := CurrentUser(c)
+		entry := Models.AuditLogs{
+			ActorID:    user.EmployeeID,
+			ActorEmail: user.Email,
+			ActorRole:  user.Role,
+			BranchID:   user.BranchID,
+			DeviceID:   user.DeviceID,
+			Method:     method,
+			Path:       c.Path(),
+			Action:     action,
+			Entity:     entity,
+			EntityID:   entityID,
+			Status:     status,
+			Request:    request,
+			Before:     auditJSON(before),
+			After:      auditJSON(after),
+			Changes:    auditJSON(auditDiff(before, after)),
+			IP:         c.IP(),
+			UserAgent:  c.Get(fiber.HeaderUserAgent),
+		}
+		if appendErr := AppendAuditLog(db, &entry); appendErr != nil {
+			log.Printf("failed to write audit log: %v (%s %s)", appendErr, method, c.Path())
+		}
+		return err
+	}
+}
+
+// AppendAuditLog เพิ่ม AuditLogs ต่อท้าย chain (ใช้ advisory lock ให้เพิ่มได้ทีละแถว)
+func AppendAuditLog(db *gorm.DB, entry *Models.AuditLogs) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error; err != nil {
+			return err
+		}
+
+		var last []Models.AuditLogs
+		if err := tx.Select("sequence", "hash").Order("sequence DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		entry.Sequence = 1
+		entry.PrevHash = ""
+		if len(last) > 0 {
+			entry.Sequence = last[0].Sequence + 1
+			entry.PrevHash = last[0].Hash
+		}
+
+		entry.AuditID = uuid.New().String()
+		// ตัดความละเอียดเวลาให้ตรงกับที่ Postgres เก็บ เพื่อให้คำนวณ hash ซ้ำได้
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = AuditHash(*entry)
+		return tx.Create(entry).Error
+	})
+}
+
+// AuditHash คำนวณ hash ของแถวจากข้อมูลทั้งหมดและ hash ของแถวก่อนหน้า
+func AuditHash(entry Models.AuditLogs) string {
+	fields := []string{
+		entry.AuditID,
+		fmt.Sprint(entry.Sequence),
+		entry.ActorID, entry.ActorEmail, entry.ActorRole, entry.BranchID, entry.DeviceID,
+		entry.Method, entry.Path, entry.Action, entry.Entity, entry.EntityID,
+		fmt.Sprint(entry.Status),
+		entry.Request, entry.Before, entry.After, entry.Changes,
+		entry.IP, entry.UserAgent,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.PrevHash,
+	}
+	// ใช้ JSON ของ array เพื่อไม่ให้ค่าที่มีตัวคั่นปนกันแล้วได้ hash เดียวกัน
+	payload, _ := json.Marshal(fields)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// แยก entity, id และ action จาก path เช่น PUT /products/:id -> products, :id, update
+// POST /sales/:id/refunds -> sales, :id, refunds
+func auditTarget(method string, path string) (string, string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	entity := parts[0]
+
+	var entityID string
+	actionParts := parts[1:]
+	if len(parts) > 1 {
+		if _, err := uuid.Parse(parts[1]); err == nil {
+			entityID = parts[1]
+			actionParts = parts[2:]
+		}
+	}
+
+	if len(actionParts) > 0 {
+		return entity, entityID, strings.Join(actionParts, ".")
+	}
+	switch method {
+	case fiber.MethodPost:
+		return entity, entityID, "create"
+	case fiber.MethodDelete:
+		return entity, entityID, "delete"
+	default:
+		return entity, entityID, "update"
+	}
+}
+
+// ดึงข้อมูลแถวปัจจุบันของ entity (nil ถ้าไม่รู้จัก entity หรือไม่พบแถว)
+func auditSnapshot(db *gorm.DB, entity string, entityID string) map[string]interface{} {
+	target, ok := auditEntities[entity]
+	if !ok || entityID == "" {
+		return nil
+	}
+	var rows []map[string]interface{}
+	if err := db.Table(`"`+target.Table+`"`).Where(target.Key+" = ?", entityID).Limit(1).Find(&rows).Error; err != nil || len(rows) == 0 {
+		return nil
+	}
+	return redactAudit(rows[0]).(map[string]interface{})
+}
+
+// หา id ของรายการที่สร้างใหม่จาก response เช่น {"New": {"productid": ...}} หรือ {"sale": {"saleid": ...}}
+func auditCreatedID(entity string, body []byte) string {
+	target, ok := auditEntities[entity]
+	if !ok {
+		return ""
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ""
+	}
+	jsonKey := strings.ReplaceAll(target.Key, "_", "")
+	if created, ok := response["New"].(map[string]interface{}); ok {
+		if id, ok := created[jsonKey].(string); ok {
+			return id
+		}
+	}
+	for _, value := range response {
+		if object, ok := value.(map[string]interface{}); ok {
+			if id, ok := object[jsonKey].(string); ok {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// body ของ request ที่ตัดข้อมูลลับออกแล้ว
+func auditRequestBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return ""
+	}
+	encoded := auditJSON(redactAudit(parsed))
+	if len(encoded) > auditMaxRequestBody {
+		encoded = encoded[:auditMaxRequestBody]
+	}
+	return encoded
+}
+
+// แทนค่าของ field ลับด้วย [REDACTED] ทุกระดับ
+func redactAudit(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if auditRedactedFields[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+				continue
+			}
+			v[key] = redactAudit(inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactAudit(inner)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// column ที่ค่าเปลี่ยนระหว่าง before และ after
+func auditDiff(before map[string]interface{}, after map[string]interface{}) map[string]interface{} {
+	if before == nil || after == nil {
+		return nil
+	}
+	changes := make(map[string]interface{})
+	for key, to := range after {
+		from := before[key]
+		if auditJSON(from) != auditJSON(to) {
+			changes[key] = map[string]interface{}{"from": from, "to": to}
+		}
+	}
+	for key, from := range before {
+		if _, ok := after[key]; !ok {
+			changes[key] = map[string]interface{}{"from": from, "to": nil}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func auditJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if m, ok := value.(map[string]interface{}); ok && m == nil {
+		return ""
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
@@ -0,0 +1,46 @@
+package Middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// User ข้อมูลผู้ใช้ที่ login อยู่ อ่านจาก claims ของ JWT ที่ IsAuthenticated เก็บไว้ใน c.Locals("user")
+type User struct {
+	EmployeeID string
+	Email      string
+	Name       string
+	Role       string
+	BranchID   string
+	DeviceID   string // เครื่อง POS ที่ login ด้วย PIN (ว่างถ้า login ด้วยรหัสผ่าน)
+}
+
+// CurrentUser ดึงข้อมูลผู้ใช้ของ request ปัจจุบัน (ค่าว่างถ้ายังไม่ผ่าน IsAuthenticated)
+func CurrentUser(c *fiber.Ctx) User {
+	claims, ok := c.Locals("user").(jwt.MapClaims)
+	if !ok {
+		return User{}
+	}
+	get := func(key string) string {
+		value, _ := claims[key].(string)
+		return value
+	}
+	return User{
+		EmployeeID: get("employeeid"),
+		Email:      get("email"),
+		Name:       get("name"),
+		Role:       get("role"),
+		BranchID:   get("branchid"),
+		DeviceID:   get("deviceid"),
+	}
+}
+
+// AllBranches ผู้ใช้เข้าถึงข้อมูลได้ทุกสาขาหรือไม่ (เฉพาะ Super Admin)
+func (u User) AllBranches() bool {
+	return u.Role == "Super Admin"
+}
+
+// CanAccessBranch ผู้ใช้เข้าถึงข้อมูลของสาขานี้ได้หรือไม่
+func (u User) CanAccessBranch(branchID string) bool {
+	return u.AllBranches() || (u.BranchID != "" && u.BranchID == branchID)
+}
@@ -6,9 +6,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
-func IsAuthenticated() fiber.Handler {
+// IsAuthenticated ตรวจสอบ JWT, การยกเลิก token และสิทธิ์ของ role สำหรับ route
+func IsAuthenticated(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// ดึง token จาก header
 		token := c.Get("Authorization")
@@ -28,6 +30,16 @@ func IsAuthenticated() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
 		}
 
+		// device token ของเครื่อง POS ใช้ได้เฉพาะ /login/pin
+		if typ, _ := claims["typ"].(string); typ == "device" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Device token cannot be used for this route"})
+		}
+
+		// ตรวจสอบว่า token ยังไม่ถูกยกเลิก (logout, ลบพนักงาน, เปลี่ยน role หรือรหัสผ่าน)
+		if !tokenActive(db, claims) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token has been revoked"})
+		}
+
 		// ส่งข้อมูลผู้ใช้กลับ (สามารถใช้ user ID จาก claims หรือทำอะไรเพิ่มเติมได้ที่นี่)
 		c.Locals("user", claims)
 
@@ -37,33 +49,24 @@ func IsAuthenticated() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token does not have a valid role"})
 		}
 
-		// ตรวจสอบ role และกำหนดการเข้าถึง route
-		switch role {
-		case "Super Admin":
-			// Admin สามารถเข้าถึงทุกอย่าง
-			return c.Next()
-		case "Manager":
-			// Manager สามารถเข้าถึงทุกอย่าง ยกเว้น สำหรับ branches
-
-			return c.Next()
-		case "Cashier":
-			// Cashier สามารถเข้าถึงเฉพาะ GET method สำหรับ /branches, /products, และ /inventory
-
-			return c.Next()
-
-		case "Audit":
-			// Audit สามารถเข้าถึงข้อมูลทุกอย่าง แต่เฉพาะ GET method เท่านั้น
-			if c.Method() != "GET" {
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-					"error": "Audit role can only perform GET requests",
-				})
-			}
-			return c.Next()
-		default:
-			// ถ้า role ไม่มีสิทธิ์เข้าถึง
+		if !KnownRole(role) {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "You do not have permission",
 			})
 		}
+
+		// ตรวจสอบสิทธิ์ของ role กับตารางสิทธิ์ของ route
+		method := c.Method()
+		if method == fiber.MethodHead {
+			method = fiber.MethodGet
+		}
+		permission, _ := RequiredPermission(method, c.Path())
+		if !HasPermission(role, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":      "Missing permission: " + string(permission),
+				"permission": permission,
+			})
+		}
+		return c.Next()
 	}
 }
@@ -0,0 +1,239 @@
+package Middleware
+
+import (
+	"strings"
+)
+
+// Permission สิทธิ์หนึ่งอย่างในระบบ ในรูปแบบ resource:action
+type Permission string
+
+const (
+	PermAll           Permission = "*"             // ทุกสิทธิ์ (Super Admin)
+	PermAuthenticated Permission = "authenticated" // ผู้ใช้ที่ login แล้วทุก role
+
+	PermBranchesRead          Permission = "branches:read"
+	PermBranchesWrite         Permission = "branches:write"
+	PermReceiptTemplatesWrite Permission = "receipttemplates:write"
+	PermEmployeesRead         Permission = "employees:read"
+	PermEmployeesWrite        Permission = "employees:write"
+	PermDevicesRead           Permission = "devices:read" // เครื่อง POS
+	PermDevicesWrite          Permission = "devices:write"
+	PermCatalogRead           Permission = "catalog:read" // สินค้า หมวดหมู่ โปรโมชัน
+	PermCatalogWrite          Permission = "catalog:write"
+	PermInventoryRead         Permission = "inventory:read"
+	PermInventoryWrite        Permission = "inventory:write"
+	PermInventoryAdjust       Permission = "inventory:adjust"  // ขอปรับ stock พร้อมเหตุผล
+	PermInventoryApprove      Permission = "inventory:approve" // อนุมัติการปรับ stock ที่มูลค่าเกินเกณฑ์
+	PermStocktakesCount       Permission = "stocktakes:count"  // บันทึกจำนวนที่นับได้ในรอบนับสต็อก
+	PermStocktakesManage      Permission = "stocktakes:manage" // เริ่ม/อนุมัติ/ยกเลิกรอบนับสต็อก
+	PermSalesRead             Permission = "sales:read"        // การขาย ใบเสร็จ การชำระเงิน การคืนเงิน
+	PermSalesCreate           Permission = "sales:create"
+	PermSalesRefund           Permission = "sales:refund"
+	PermSalesWrite            Permission = "sales:write" // แก้ไขข้อมูลการขาย/ใบเสร็จย้อนหลัง
+	PermSalesDelete           Permission = "sales:delete"
+	PermTaxInvoicesCreate     Permission = "taxinvoices:create"
+	PermShiftsOperate         Permission = "shifts:operate" // เปิด/ปิดกะและนำเงินเข้าออกลิ้นชักของตัวเอง
+	PermShiftsManage          Permission = "shifts:manage"  // จัดการกะของพนักงานคนอื่น
+	PermShiftsRead            Permission = "shifts:read"
+	PermCustomersRead         Permission = "customers:read"
+	PermCustomersWrite        Permission = "customers:write"
+	PermRequestsRead          Permission = "requests:read"   // คำขอโอนสินค้าและ shipment
+	PermRequestsWrite         Permission = "requests:write"  // สร้าง/อนุมัติ/ปฏิเสธ/ยกเลิกคำขอโอนสินค้า
+	PermRequestsFulfil        Permission = "requests:fulfil" // จัดสินค้า ส่งของ และรับของตามคำขอโอนสินค้า
+	PermReportsRead           Permission = "reports:read"
+	PermSecurityRead          Permission = "security:read" // ประวัติการ login
+	PermAuditRead             Permission = "audit:read"    // ประวัติการเปลี่ยนแปลงข้อมูล (AuditLogs)
+)
+
+// สิทธิ์ของแต่ละ role
+var rolePermissions = map[string][]Permission{
+	"Super Admin": {PermAll},
+	"Manager": {
+		// Manager ทำได้ทุกอย่าง ยกเว้นจัดการสาขาและลบข้อมูลการขาย
+		// (การแก้ไข/ลบบัญชี Super Admin ตรวจสอบใน handler ของ employees)
+		PermBranchesRead, PermReceiptTemplatesWrite,
+		PermEmployeesRead, PermEmployeesWrite,
+		PermDevicesRead, PermDevicesWrite,
+		PermCatalogRead, PermCatalogWrite,
+		PermInventoryRead, PermInventoryWrite, PermInventoryAdjust, PermInventoryApprove,
+		PermStocktakesCount, PermStocktakesManage,
+		PermSalesRead, PermSalesCreate, PermSalesRefund, PermSalesWrite,
+		PermTaxInvoicesCreate,
+		PermShiftsOperate, PermShiftsManage, PermShiftsRead,
+		PermCustomersRead, PermCustomersWrite,
+		PermRequestsRead, PermRequestsWrite, PermRequestsFulfil,
+		PermReportsRead,
+		PermSecurityRead,
+	},
+	"Cashier": {
+		// Cashier ขายสินค้า ดูข้อมูลสินค้า/stock ขอปรับ stock (มูลค่าเกินเกณฑ์ต้องรออนุมัติ) ช่วยนับสต็อก และจัด/ส่ง/รับสินค้าตามคำขอโอน
+		PermBranchesRead,
+		PermCatalogRead,
+		PermInventoryRead, PermInventoryAdjust, PermStocktakesCount,
+		PermSalesRead, PermSalesCreate,
+		PermTaxInvoicesCreate,
+		PermShiftsOperate,
+		PermCustomersRead, PermCustomersWrite,
+		PermRequestsRead, PermRequestsFulfil,
+	},
+	"Audit": {
+		// Audit ดูข้อมูลได้ทุกอย่าง แต่แก้ไขไม่ได้
+		PermBranchesRead,
+		PermEmployeesRead,
+		PermDevicesRead,
+		PermCatalogRead,
+		PermInventoryRead,
+		PermSalesRead,
+		PermShiftsRead,
+		PermCustomersRead,
+		PermRequestsRead,
+		PermReportsRead,
+		PermSecurityRead,
+		PermAuditRead,
+	},
+}
+
+// routeRule สิทธิ์ที่ต้องใช้สำหรับ method + path
+// pattern ใช้รูปแบบเดียวกับ Fiber (:param) และ "*" ท้าย pattern หมายถึง path ย่อยทั้งหมด
+type routeRule struct {
+	Method     string
+	Pattern    string
+	Permission Permission
+}
+
+// ตารางสิทธิ์ของแต่ละ route เรียงจากเฉพาะเจาะจงไปกว้าง (ใช้กฎแรกที่ตรง)
+var routeRules = []routeRule{
+	// Session
+	{"POST", "/logout", PermAuthenticated},
+
+	// Branches
+	{"PUT", "/branches/:id/receipttemplate", PermReceiptTemplatesWrite},
+	{"GET", "/branches/*", PermBranchesRead},
+	{"*", "/branches/*", PermBranchesWrite},
+
+	// Employees (PIN ตั้งของตัวเองได้ทุก role ตรวจสิทธิ์เพิ่มใน handler)
+	{"PUT", "/employees/:id/pin", PermAuthenticated},
+	{"GET", "/employees/*", PermEmployeesRead},
+	{"*", "/employees/*", PermEmployeesWrite},
+
+	// Devices
+	{"GET", "/devices/*", PermDevicesRead},
+	{"*", "/devices/*", PermDevicesWrite},
+
+	// Catalog
+	{"GET", "/products/*", PermCatalogRead},
+	{"*", "/products/*", PermCatalogWrite},
+	{"GET", "/categories/*", PermCatalogRead},
+	{"*", "/categories/*", PermCatalogWrite},
+	{"GET", "/promotions/*", PermCatalogRead},
+	{"*", "/promotions/*", PermCatalogWrite},
+
+	// Inventory
+	{"POST", "/inventory/adjustments", PermInventoryAdjust},
+	{"POST", "/inventory/adjustments/:id/approve", PermInventoryApprove},
+	{"POST", "/inventory/adjustments/:id/reject", PermInventoryApprove},
+	{"GET", "/inventory/*", PermInventoryRead},
+	{"*", "/inventory/*", PermInventoryWrite},
+
+	// Stocktakes
+	{"POST", "/stocktakes/:id/counts", PermStocktakesCount},
+	{"GET", "/stocktakes/*", PermInventoryRead},
+	{"*", "/stocktakes/*", PermStocktakesManage},
+
+	// Sales
+	{"POST", "/sales", PermSalesCreate},
+	{"POST", "/sales/:id/refunds", PermSalesRefund},
+	{"POST", "/sales/:id/void", PermSalesRefund},
+	{"DELETE", "/sales/:id", PermSalesDelete},
+	{"GET", "/sales/*", PermSalesRead},
+	{"*", "/sales/*", PermSalesWrite},
+	{"GET", "/saleitems/*", PermSalesRead},
+	{"GET", "/refunds/*", PermSalesRead},
+
+	// Receipts
+	{"POST", "/receipts/:id/taxinvoice", PermTaxInvoicesCreate},
+	{"GET", "/receipts/*", PermSalesRead},
+	{"GET", "/receiptitems/*", PermSalesRead},
+	{"GET", "/taxinvoices/*", PermSalesRead},
+
+	// Shifts (รายงานของกะตัวเองดูได้ทุก role ตรวจสิทธิ์เพิ่มใน handler)
+	{"GET", "/shifts/current", PermShiftsOperate},
+	{"GET", "/shifts/:id/report", PermAuthenticated},
+	{"GET", "/shifts/*", PermShiftsRead},
+	{"*", "/shifts/*", PermShiftsOperate},
+
+	// Customers
+	{"GET", "/customers/*", PermCustomersRead},
+	{"*", "/customers/*", PermCustomersWrite},
+
+	// Requests และ Shipments (สิทธิ์ของการเปลี่ยนสถานะแต่ละแบบตรวจใน handler)
+	{"POST", "/requests/:id/transitions", PermAuthenticated},
+	{"GET", "/requests/*", PermRequestsRead},
+	{"*", "/requests/*", PermRequestsWrite},
+	{"GET", "/shipments/*", PermRequestsRead},
+	{"*", "/shipments/*", PermRequestsWrite},
+	{"GET", "/replenishments/*", PermRequestsRead},
+	{"*", "/replenishments/*", PermRequestsWrite},
+
+	// Reports
+	{"GET", "/reports/*", PermReportsRead},
+
+	// Security
+	{"GET", "/loginaudits/*", PermSecurityRead},
+	{"GET", "/audit/*", PermAuditRead},
+}
+
+// ตรวจสอบว่า path ตรงกับ pattern หรือไม่
+func matchPattern(pattern string, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range patternParts {
+		if part == "*" {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(pathParts)
+}
+
+// RequiredPermission หาสิทธิ์ที่ต้องใช้ของ method + path
+// ถ้าไม่มีกฎที่ตรง ok จะเป็น false (เฉพาะ Super Admin เข้าถึงได้)
+func RequiredPermission(method string, path string) (Permission, bool) {
+	for _, rule := range routeRules {
+		if rule.Method != "*" && rule.Method != method {
+			continue
+		}
+		if matchPattern(rule.Pattern, path) {
+			return rule.Permission, true
+		}
+	}
+	return PermAll, false
+}
+
+// HasPermission ตรวจสอบว่า role มีสิทธิ์ที่กำหนดหรือไม่
+func HasPermission(role string, permission Permission) bool {
+	if permission == PermAuthenticated {
+		return KnownRole(role)
+	}
+	for _, p := range rolePermissions[role] {
+		if p == PermAll || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownRole ตรวจสอบว่าเป็น role ที่ระบบรู้จักหรือไม่
+func KnownRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
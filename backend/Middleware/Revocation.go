@@ -0,0 +1,38 @@
+package Middleware
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// ตรวจสอบว่า access token ยังไม่ถูกยกเลิก
+// token ต้องมี jti ที่ไม่อยู่ใน RevokedTokens (logout) และ token version ต้องตรงกับของพนักงาน
+// (พนักงานถูกลบ เปลี่ยน role/สาขา หรือรีเซ็ตรหัสผ่านจะทำให้ token version เปลี่ยน)
+// token ที่ได้จาก PIN ต้องมาจากเครื่อง POS ที่ยังใช้งานอยู่
+func tokenActive(db *gorm.DB, claims jwt.MapClaims) bool {
+	jti, _ := claims["jti"].(string)
+	employeeID, _ := claims["employeeid"].(string)
+	version, ok := claims["tv"].(float64)
+	if jti == "" || employeeID == "" || !ok {
+		return false
+	}
+
+	var revoked int64
+	if err := db.Model(&Models.RevokedTokens{}).Where("jti = ?", jti).Count(&revoked).Error; err != nil || revoked > 0 {
+		return false
+	}
+
+	if deviceID, ok := claims["deviceid"].(string); ok {
+		var active int64
+		if err := db.Model(&Models.PosDevices{}).Where("device_id = ? AND status = ?", deviceID, "active").Count(&active).Error; err != nil || active == 0 {
+			return false
+		}
+	}
+
+	var employee Models.Employees
+	if err := db.Select("employee_id", "token_version").Where("employee_id = ?", employeeID).First(&employee).Error; err != nil {
+		return false
+	}
+	return employee.TokenVersion == int(version)
+}
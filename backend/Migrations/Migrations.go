@@ -1,6 +1,7 @@
 package Migrations
 
 import (
+	"fmt"
 	"log"
 	"time"
 
@@ -12,6 +13,31 @@ import (
 
 // Migrate ทำการ migration ทั้งหมดที่ต้องการ
 func Migrate(tx *gorm.DB) error {
+	// สถานะของ Requests เดิมเป็นข้อความอิสระ แปลงให้เป็นสถานะที่รู้จักก่อนเพิ่ม check constraint
+	if tx.Migrator().HasTable(&Models.Requests{}) {
+		if err := tx.Exec(`UPDATE "Requests" SET status = 'received' WHERE status IN ('complete', 'completed')`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE "Requests" SET status = 'pending'
+			WHERE status IS NULL OR status NOT IN ('pending', 'approved', 'picked', 'in_transit', 'received', 'rejected', 'cancelled')`).Error; err != nil {
+			return err
+		}
+	}
+
+	// รหัสสาขาซ้ำกันต้องแก้ก่อนสร้าง unique index ของ branch_code
+	if tx.Migrator().HasColumn(&Models.Branches{}, "branch_code") {
+		if err := assignBranchCodes(tx); err != nil {
+			return err
+		}
+	}
+
+	// Inventory ซ้ำ (สาขาเดียวกัน สินค้าเดียวกัน) ต้องรวมเป็นแถวเดียวก่อนสร้าง unique index
+	if tx.Migrator().HasTable(&Models.Inventory{}) && !tx.Migrator().HasIndex(&Models.Inventory{}, "idx_inventory_branch_product") {
+		if err := mergeDuplicateInventory(tx); err != nil {
+			return err
+		}
+	}
+
 	// รวม AutoMigrate ทั้งหมดไว้ที่นี่
 	if err := tx.AutoMigrate(
 		&Models.Employees{},
@@ -26,10 +52,82 @@ func Migrate(tx *gorm.DB) error {
 		&Models.Category{},
 		&Models.Shipments{},
 		&Models.ShipmentItems{},
+		&Models.SequenceCounters{},
+		&Models.Refunds{},
+		&Models.Payments{},
+		&Models.TaxInvoices{},
+		&Models.ReceiptTemplates{},
+		&Models.RefundItems{},
+		&Models.Customers{},
+		&Models.PointsLedger{},
+		&Models.Promotions{},
+		&Models.RefreshTokens{},
+		&Models.RevokedTokens{},
+		&Models.LoginAttempts{},
+		&Models.LoginAudits{},
+		&Models.PosDevices{},
+		&Models.Shifts{},
+		&Models.ShiftCashMovements{},
+		&Models.ShiftCashCounts{},
+		&Models.AuditLogs{},
+		&Models.StockMovements{},
+		&Models.StockAdjustments{},
+		&Models.Stocktakes{},
+		&Models.StocktakeLines{},
+		&Models.StocktakeCounts{},
+		&Models.ReplenishmentSuggestions{},
+		&Models.RequestItems{},
+		&Models.RequestTransitions{},
 	); err != nil {
 		return err
 	}
 
+	// AuditLogs เพิ่มได้อย่างเดียว ห้ามแก้ไขหรือลบที่ระดับฐานข้อมูล
+	if err := tx.Exec(`
+		CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'AuditLogs is append-only';
+		END;
+		$$ LANGUAGE plpgsql`).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`DROP TRIGGER IF EXISTS trg_audit_logs_append_only ON "AuditLogs"`).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`
+		CREATE TRIGGER trg_audit_logs_append_only
+		BEFORE UPDATE OR DELETE ON "AuditLogs"
+		FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`).Error; err != nil {
+		return err
+	}
+
+	// Requests เดิมมีสินค้าเดียวต่อคำขอ ย้ายไปเป็น RequestItems (จำนวนส่ง/รับตามสถานะ)
+	if tx.Migrator().HasColumn(&Models.Requests{}, "product_id") {
+		if err := tx.Exec(`
+			INSERT INTO "RequestItems" (request_item_id, request_id, product_id, quantity, shipped_quantity, received_quantity)
+			SELECT gen_random_uuid(), r.request_id, r.product_id, r.quantity,
+				CASE WHEN r.status IN ('in_transit', 'received') THEN r.quantity ELSE 0 END,
+				CASE WHEN r.status = 'received' THEN r.quantity ELSE 0 END
+			FROM "Requests" r
+			WHERE r.product_id IS NOT NULL AND r.quantity > 0
+			AND NOT EXISTS (SELECT 1 FROM "RequestItems" i WHERE i.request_id = r.request_id)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`ALTER TABLE "Requests" ALTER COLUMN quantity DROP NOT NULL`).Error; err != nil {
+			return err
+		}
+	}
+
+	// ยอดยกมาของ Inventory ที่มีอยู่ก่อนมี StockMovements เพื่อให้ ledger ตรงกับจำนวนปัจจุบัน
+	if err := tx.Exec(`
+		INSERT INTO "StockMovements" (movement_id, inventory_id, branch_id, product_id, type, quantity, balance_after, reference_type, note, created_at)
+		SELECT gen_random_uuid(), i.inventory_id, i.branch_id, i.product_id, 'opening_balance', i.quantity, i.quantity, 'inventory', 'Opening balance', NOW()
+		FROM "Inventory" i
+		WHERE i.quantity <> 0
+		AND NOT EXISTS (SELECT 1 FROM "StockMovements" m WHERE m.inventory_id = i.inventory_id)`).Error; err != nil {
+		return err
+	}
+
 	// สร้าง branch เริ่มต้นถ้ายังไม่มี
 	var branch Models.Branches
 	tx.Model(&Models.Branches{}).First(&branch)
@@ -39,6 +137,7 @@ func Migrate(tx *gorm.DB) error {
 			BName:          "Main Branch",
 			Location:       "Thailand",
 			GoogleLocation: "13.7563, 100.5018",
+			BranchCode:     "BR01",
 			CreatedAt:      time.Now(),
 		}
 		if err := tx.Create(&branch).Error; err != nil {
@@ -48,6 +147,11 @@ func Migrate(tx *gorm.DB) error {
 		log.Println("Main Branch created successfully!")
 	}
 
+	// กำหนดรหัสสาขาให้สาขาเดิมที่ยังไม่มี (ใช้ในเลขใบเสร็จ/เลข Shipment)
+	if err := assignBranchCodes(tx); err != nil {
+		return err
+	}
+
 	// สร้าง Super Admin ถ้ายังไม่มี
 	var superAdminCount int64
 	tx.Model(&Models.Employees{}).Where("role = ?", "Super Admin").Count(&superAdminCount)
@@ -120,3 +224,105 @@ func Migrate(tx *gorm.DB) error {
 
 	return nil
 }
+
+// แก้รหัสสาขาที่ซ้ำกัน (สาขาที่สร้างก่อนได้ใช้รหัสเดิม) แล้วกำหนดรหัส BRxx ที่ยังว่างให้สาขาที่ไม่มีรหัส
+// รวม Inventory ที่ซ้ำกันเข้าแถวที่เก่าที่สุดของแต่ละ (branch_id, product_id)
+// จำนวนรวมกัน ค่า min/reorder/max ใช้ค่ามากที่สุด และย้ายการอ้างอิง inventory_id ไปที่แถวที่เก็บไว้
+func mergeDuplicateInventory(tx *gorm.DB) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			CREATE TEMP TABLE inventory_merge ON COMMIT DROP AS
+			SELECT inventory_id AS old_id, keep_id FROM (
+				SELECT inventory_id, FIRST_VALUE(inventory_id) OVER (
+					PARTITION BY branch_id, product_id ORDER BY updated_at, inventory_id
+				) AS keep_id
+				FROM "Inventory"
+			) ranked
+			WHERE inventory_id <> keep_id`).Error; err != nil {
+			return err
+		}
+
+		var duplicates int64
+		if err := tx.Raw(`SELECT COUNT(*) FROM inventory_merge`).Scan(&duplicates).Error; err != nil {
+			return err
+		}
+		if duplicates == 0 {
+			return nil
+		}
+		log.Printf("Merging %d duplicate inventory rows", duplicates)
+
+		// ฐานข้อมูลเก่าอาจยังไม่มีคอลัมน์ min/reorder/max
+		levels, mergedLevels := "", ""
+		if tx.Migrator().HasColumn(&Models.Inventory{}, "min_quantity") {
+			levels = `,
+				min_quantity = GREATEST(i.min_quantity, d.min_quantity),
+				reorder_point = GREATEST(i.reorder_point, d.reorder_point),
+				max_quantity = GREATEST(i.max_quantity, d.max_quantity)`
+			mergedLevels = `, MAX(o.min_quantity) AS min_quantity,
+					MAX(o.reorder_point) AS reorder_point, MAX(o.max_quantity) AS max_quantity`
+		}
+		if err := tx.Exec(`
+			UPDATE "Inventory" i SET quantity = i.quantity + d.quantity` + levels + `
+			FROM (
+				SELECT m.keep_id, SUM(o.quantity) AS quantity` + mergedLevels + `
+				FROM inventory_merge m JOIN "Inventory" o ON o.inventory_id = m.old_id
+				GROUP BY m.keep_id
+			) d
+			WHERE i.inventory_id = d.keep_id`).Error; err != nil {
+			return err
+		}
+
+		// ตารางที่อาจยังไม่มีในฐานข้อมูลเก่าข้ามไป
+		for _, table := range []interface{}{
+			&Models.StockMovements{},
+			&Models.StockAdjustments{},
+			&Models.StocktakeLines{},
+			&Models.ReplenishmentSuggestions{},
+		} {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+			if err := tx.Model(table).Where("inventory_id IN (SELECT old_id FROM inventory_merge)").
+				Update("inventory_id", gorm.Expr("(SELECT keep_id FROM inventory_merge WHERE old_id = inventory_id)")).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec(`DELETE FROM "Inventory" WHERE inventory_id IN (SELECT old_id FROM inventory_merge)`).Error
+	})
+}
+
+func assignBranchCodes(tx *gorm.DB) error {
+	if err := tx.Exec(`
+		UPDATE "Branches" b SET branch_code = ''
+		WHERE b.branch_code <> '' AND EXISTS (
+			SELECT 1 FROM "Branches" o
+			WHERE o.branch_code = b.branch_code
+			AND (o.created_at < b.created_at OR (o.created_at = b.created_at AND o.branch_id < b.branch_id))
+		)`).Error; err != nil {
+		return err
+	}
+
+	var branchesWithoutCode []Models.Branches
+	if err := tx.Where("branch_code IS NULL OR branch_code = ''").Order("created_at").Find(&branchesWithoutCode).Error; err != nil {
+		return err
+	}
+	n := 0
+	for _, b := range branchesWithoutCode {
+		for {
+			n++
+			code := fmt.Sprintf("BR%02d", n)
+			var existing int64
+			if err := tx.Model(&Models.Branches{}).Where("branch_code = ?", code).Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing == 0 {
+				if err := tx.Model(&Models.Branches{}).Where("branch_id = ?", b.BranchID).Update("branch_code", code).Error; err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
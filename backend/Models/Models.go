@@ -9,13 +9,15 @@ import (
 
 // Employees struct
 type Employees struct {
-	EmployeeID string    `gorm:"type:uuid;primaryKey" json:"employeeid"`
-	Email      string    `gorm:"type:varchar(20);not null;unique" json:"email"`
-	Password   string    `gorm:"type:varchar(100);not null" json:"password"`
-	Name       string    `gorm:"type:varchar(40);not null" json:"name"`
-	Role       string    `gorm:"type:varchar(12);not null;check:role IN ('Cashier', 'Manager', 'Audit', 'Super Admin')" json:"role"`
-	BranchID   *string   `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"` // เปลี่ยนเป็น *string เพื่อให้สามารถเป็น NULL ได้
-	CreatedAt  time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+	EmployeeID   string    `gorm:"type:uuid;primaryKey" json:"employeeid"`
+	Email        string    `gorm:"type:varchar(20);not null;unique" json:"email"`
+	Password     string    `gorm:"type:varchar(100);not null" json:"password"`
+	Name         string    `gorm:"type:varchar(40);not null" json:"name"`
+	Role         string    `gorm:"type:varchar(12);not null;check:role IN ('Cashier', 'Manager', 'Audit', 'Super Admin')" json:"role"`
+	BranchID     *string   `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"` // เปลี่ยนเป็น *string เพื่อให้สามารถเป็น NULL ได้
+	TokenVersion int       `gorm:"type:int;not null;default:0" json:"-"`          // เพิ่มค่าเมื่อต้องการยกเลิก token ทั้งหมดของพนักงาน
+	PinHash      string    `gorm:"type:varchar(100)" json:"-"`                    // bcrypt ของ PIN 4-6 หลัก สำหรับ login ที่เครื่อง POS
+	CreatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
 }
 
 func (Employees) TableName() string {
@@ -32,7 +34,9 @@ type Branches struct {
 	BranchID       string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"branchid"`
 	BName          string    `gorm:"type:varchar(100);not null" json:"bname"`
 	Location       string    `gorm:"type:varchar(255);not null" json:"location"`
-	GoogleLocation string    `gorm:"type:varchar(255);not null" json:"google_location"` // ฟิลด์ใหม่
+	GoogleLocation string    `gorm:"type:varchar(255);not null" json:"google_location"`                                               // ฟิลด์ใหม่
+	BranchCode     string    `gorm:"type:varchar(10);uniqueIndex:idx_branches_branch_code,where:branch_code <> ''" json:"branchcode"` // รหัสสาขาสำหรับเลขเอกสาร เช่น BKK01 (ห้ามซ้ำ)
+	TaxID          string    `gorm:"type:varchar(13)" json:"taxid"`                                                                   // เลขประจำตัวผู้เสียภาษีของผู้ขาย
 	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
 }
 
@@ -56,6 +60,8 @@ type Product struct {
 	CreatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
 	ImageURL    string    `gorm:"type:varchar(255)" json:"imageurl"` // ฟิลด์สำหรับเก็บ URL ของภาพ
 	CategoryID  string    `gorm:"type:uuid;foreignKey:CategoryID" json:"categoryid"`
+	TaxMode     string    `gorm:"type:varchar(10)" json:"taxmode"`  // inclusive, exclusive, exempt (ว่าง = ใช้ค่าของ Category)
+	TaxRate     *float64  `gorm:"type:numeric(5,2)" json:"taxrate"` // อัตรา VAT (%) (null = ใช้ค่าของ Category)
 }
 
 func (Product) TableName() string {
@@ -65,10 +71,14 @@ func (Product) TableName() string {
 // Inventory struct
 type Inventory struct {
 	InventoryID string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"inventoryid"`
-	ProductID   string    `gorm:"type:uuid;foreignKey:ProductID" json:"productid"`
-	BranchID    string    `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"`
+	ProductID   string    `gorm:"type:uuid;foreignKey:ProductID;uniqueIndex:idx_inventory_branch_product,priority:2" json:"productid"`
+	BranchID    string    `gorm:"type:uuid;foreignKey:BranchID;uniqueIndex:idx_inventory_branch_product,priority:1" json:"branchid"` // สินค้าหนึ่งรายการมีได้แถวเดียวต่อสาขา
 	Quantity    int       `gorm:"type:int;not null" json:"quantity"`
 	UpdatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"updatedat"`
+
+	MinQuantity  int `gorm:"type:int;not null;default:0" json:"minquantity"`  // จำนวนที่ต้องเก็บไว้เสมอ (ไม่โอนออกให้สาขาอื่นต่ำกว่านี้)
+	ReorderPoint int `gorm:"type:int;not null;default:0" json:"reorderpoint"` // เหลือถึงจำนวนนี้แล้วต้องเติม (0 = ไม่เติมอัตโนมัติ)
+	MaxQuantity  int `gorm:"type:int;not null;default:0" json:"maxquantity"`  // เติมให้ถึงจำนวนนี้
 }
 
 func (Inventory) TableName() string {
@@ -77,11 +87,19 @@ func (Inventory) TableName() string {
 
 // Sales struct
 type Sales struct {
-	SaleID      string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"saleid"`
-	EmployeeID  string    `gorm:"type:uuid;foreignKey:EmployeeID" json:"employeeid"`
-	BranchID    string    `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"`
-	TotalAmount float64   `gorm:"type:numeric(10,2);not null" json:"totalamount"`
-	CreatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+	SaleID         string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"saleid"`
+	EmployeeID     string    `gorm:"type:uuid;foreignKey:EmployeeID" json:"employeeid"`
+	BranchID       string    `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"`
+	TotalAmount    float64   `gorm:"type:numeric(10,2);not null" json:"totalamount"`
+	NetAmount      float64   `gorm:"type:numeric(10,2);not null;default:0" json:"netamount"` // ยอดก่อน VAT
+	VatAmount      float64   `gorm:"type:numeric(10,2);not null;default:0" json:"vatamount"`
+	DiscountAmount float64   `gorm:"type:numeric(10,2);not null;default:0" json:"discountamount"` // ส่วนลดรวมทั้งบิล (โปรโมชัน + ส่วนลดเอง)
+	BillDiscount   float64   `gorm:"type:numeric(10,2);not null;default:0" json:"billdiscount"`   // ส่วนลดท้ายบิลที่พนักงานให้
+	CustomerID     *string   `gorm:"type:uuid;index" json:"customerid"`
+	PointsEarned   int       `gorm:"type:int;not null;default:0" json:"pointsearned"`
+	ShiftID        *string   `gorm:"type:uuid;index" json:"shiftid"`                              // กะของพนักงานที่ขาย
+	Status         string    `gorm:"type:varchar(20);not null;default:'completed'" json:"status"` // completed, partially_refunded, refunded, voided
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
 }
 
 func (Sales) TableName() string {
@@ -90,12 +108,18 @@ func (Sales) TableName() string {
 
 // SaleItems struct
 type SaleItems struct {
-	SaleItemID string  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"saleitemid"`
-	SaleID     string  `gorm:"type:uuid;foreignKey:SaleID" json:"saleid"`
-	ProductID  string  `gorm:"type:uuid;foreignKey:ProductID" json:"productid"`
-	Quantity   int     `gorm:"type:int;not null" json:"quantity"`
-	Price      float64 `gorm:"type:numeric(10,2);not null" json:"price"`
-	TotalPrice float64 `gorm:"type:numeric(10,2);not null" json:"totalprice"`
+	SaleItemID        string  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"saleitemid"`
+	SaleID            string  `gorm:"type:uuid;foreignKey:SaleID" json:"saleid"`
+	ProductID         string  `gorm:"type:uuid;foreignKey:ProductID" json:"productid"`
+	Quantity          int     `gorm:"type:int;not null" json:"quantity"`
+	Price             float64 `gorm:"type:numeric(10,2);not null" json:"price"`
+	TotalPrice        float64 `gorm:"type:numeric(10,2);not null" json:"totalprice"` // ยอดรวม VAT
+	VatRate           float64 `gorm:"type:numeric(5,2);not null;default:0" json:"vatrate"`
+	NetAmount         float64 `gorm:"type:numeric(10,2);not null;default:0" json:"netamount"`
+	VatAmount         float64 `gorm:"type:numeric(10,2);not null;default:0" json:"vatamount"`
+	PromotionID       *string `gorm:"type:uuid;index" json:"promotionid"`
+	PromotionDiscount float64 `gorm:"type:numeric(10,2);not null;default:0" json:"promotiondiscount"` // ส่วนลดจากโปรโมชัน
+	ManualDiscount    float64 `gorm:"type:numeric(10,2);not null;default:0" json:"manualdiscount"`    // ส่วนลดที่พนักงานให้เอง (รวมส่วนแบ่งของส่วนลดท้ายบิล)
 	// Removed CreatedAt for simplicity
 }
 
@@ -105,12 +129,22 @@ func (SaleItems) TableName() string {
 
 // Receipts struct
 type Receipts struct {
-	ReceiptID     string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"receiptid"`
-	SaleID        string    `gorm:"type:uuid;foreignKey:SaleID" json:"saleid"`
-	BranchID      string    `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"`
-	ReceiptNumber string    `gorm:"type:varchar(100);not null;unique" json:"receiptnumber"`
-	TotalAmount   float64   `gorm:"type:numeric(10,2);not null" json:"totalamount"`
-	ReceiptDate   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"receiptdate"`
+	ReceiptID      string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"receiptid"`
+	SaleID         string    `gorm:"type:uuid;foreignKey:SaleID" json:"saleid"`
+	BranchID       string    `gorm:"type:uuid;foreignKey:BranchID" json:"branchid"`
+	ReceiptNumber  string    `gorm:"type:varchar(100);not null;unique" json:"receiptnumber"`
+	TotalAmount    float64   `gorm:"type:numeric(10,2);not null" json:"totalamount"`
+	NetAmount      float64   `gorm:"type:numeric(10,2);not null;default:0" json:"netamount"`
+	VatAmount      float64   `gorm:"type:numeric(10,2);not null;default:0" json:"vatamount"`
+	DiscountAmount float64   `gorm:"type:numeric(10,2);not null;default:0" json:"discountamount"`
+	ReceiptDate    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"receiptdate"`
+
+	ReceiptType       string  `gorm:"type:varchar(20);not null;default:'sale'" json:"receipttype"` // sale หรือ credit_note
+	OriginalReceiptID *string `gorm:"type:uuid" json:"originalreceiptid"`                          // ใบเสร็จต้นฉบับของใบลดหนี้
+
+	// รายละเอียดการชำระเงิน (ไม่ได้เก็บในตาราง Receipts ดึงมาจาก Payments ของ SaleID)
+	Payments  []Payments `gorm:"-" json:"payments,omitempty"`
+	ChangeDue float64    `gorm:"-" json:"changedue"`
 }
 
 func (Receipts) TableName() string {
@@ -119,12 +153,17 @@ func (Receipts) TableName() string {
 
 // ReceiptItems struct
 type ReceiptItems struct {
-	ReceiptItemID string  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"receiptitemid"`
-	ReceiptID     string  `gorm:"type:uuid;foreignKey:ReceiptID" json:"receiptid"`
-	ProductID     string  `gorm:"type:uuid;foreignKey:ProductID" json:"productid"`
-	Quantity      int     `gorm:"type:int;not null" json:"quantity"`
-	UnitPrice     float64 `gorm:"type:numeric(10,2);not null" json:"unitprice"`
-	TotalPrice    float64 `gorm:"type:numeric(10,2);not null" json:"totalprice"`
+	ReceiptItemID  string  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"receiptitemid"`
+	ReceiptID      string  `gorm:"type:uuid;foreignKey:ReceiptID" json:"receiptid"`
+	ProductID      string  `gorm:"type:uuid;foreignKey:ProductID" json:"productid"`
+	Quantity       int     `gorm:"type:int;not null" json:"quantity"`
+	UnitPrice      float64 `gorm:"type:numeric(10,2);not null" json:"unitprice"`
+	TotalPrice     float64 `gorm:"type:numeric(10,2);not null" json:"totalprice"`
+	VatRate        float64 `gorm:"type:numeric(5,2);not null;default:0" json:"vatrate"`
+	NetAmount      float64 `gorm:"type:numeric(10,2);not null;default:0" json:"netamount"`
+	VatAmount      float64 `gorm:"type:numeric(10,2);not null;default:0" json:"vatamount"`
+	PromotionID    *string `gorm:"type:uuid" json:"promotionid"`
+	DiscountAmount float64 `gorm:"type:numeric(10,2);not null;default:0" json:"discountamount"`
 	// Removed BranchID as it can be derived from Receipts
 }
 
@@ -132,25 +171,463 @@ func (ReceiptItems) TableName() string {
 	return "ReceiptItems"
 }
 
-// Requests struct
+// Payments struct การชำระเงินของการขาย (หนึ่งการขายชำระได้หลายช่องทาง)
+type Payments struct {
+	PaymentID string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"paymentid"`
+	SaleID    string    `gorm:"type:uuid;not null;index" json:"saleid"`
+	Method    string    `gorm:"type:varchar(20);not null;check:method IN ('cash', 'card', 'promptpay', 'voucher', 'points')" json:"method"`
+	Amount    float64   `gorm:"type:numeric(10,2);not null" json:"amount"`           // ยอดที่นำไปชำระบิล
+	Tendered  float64   `gorm:"type:numeric(10,2);not null" json:"tendered"`         // ยอดที่ลูกค้าจ่ายจริง
+	Change    float64   `gorm:"type:numeric(10,2);not null;default:0" json:"change"` // เงินทอน (เฉพาะเงินสด)
+	Reference string    `gorm:"type:varchar(100)" json:"reference"`                  // เลขอ้างอิงบัตร/QR/voucher
+	CreatedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (Payments) TableName() string {
+	return "Payments"
+}
+
+// ReceiptTemplates struct การตั้งค่ารูปแบบใบเสร็จของแต่ละสาขา
+type ReceiptTemplates struct {
+	BranchID   string    `gorm:"type:uuid;primaryKey" json:"branchid"`
+	HeaderText string    `gorm:"type:varchar(500)" json:"headertext"`
+	FooterText string    `gorm:"type:varchar(500)" json:"footertext"`
+	PaperWidth int       `gorm:"type:int;not null;default:80" json:"paperwidth"`         // 58 หรือ 80 มม.
+	CodeType   string    `gorm:"type:varchar(10);not null;default:'qr'" json:"codetype"` // qr, barcode, none
+	CodePage   int       `gorm:"type:int;not null;default:0" json:"codepage"`            // ค่า n ของ ESC t n สำหรับอักษรไทย (0 = ไม่ส่ง)
+	UpdatedAt  time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"updatedat"`
+}
+
+func (ReceiptTemplates) TableName() string {
+	return "ReceiptTemplates"
+}
+
+// TaxInvoices struct ใบกำกับภาษีเต็มรูปที่ออกจากใบเสร็จ (หนึ่งใบเสร็จออกได้หนึ่งใบ)
+type TaxInvoices struct {
+	TaxInvoiceID  string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"taxinvoiceid"`
+	InvoiceNumber string    `gorm:"type:varchar(50);not null;unique" json:"invoicenumber"`
+	ReceiptID     string    `gorm:"type:uuid;not null;unique" json:"receiptid"`
+	ReceiptNumber string    `gorm:"type:varchar(100);not null" json:"receiptnumber"`
+	SaleID        string    `gorm:"type:uuid;not null" json:"saleid"`
+	BranchID      string    `gorm:"type:uuid;not null" json:"branchid"`
+	BuyerName     string    `gorm:"type:varchar(200);not null" json:"buyername"`
+	BuyerAddress  string    `gorm:"type:varchar(500);not null" json:"buyeraddress"`
+	BuyerTaxID    string    `gorm:"type:varchar(13);not null" json:"buyertaxid"`
+	BuyerBranch   string    `gorm:"type:varchar(50)" json:"buyerbranch"` // เช่น สำนักงานใหญ่ หรือ สาขาที่ 00001
+	NetAmount     float64   `gorm:"type:numeric(10,2);not null" json:"netamount"`
+	VatAmount     float64   `gorm:"type:numeric(10,2);not null" json:"vatamount"`
+	TotalAmount   float64   `gorm:"type:numeric(10,2);not null" json:"totalamount"`
+	IssuedBy      string    `gorm:"type:uuid" json:"issuedby"`
+	IssuedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"issuedat"`
+}
+
+func (TaxInvoices) TableName() string {
+	return "TaxInvoices"
+}
+
+// RefreshTokens struct refresh token ที่ออกให้พนักงาน (เก็บเฉพาะ hash) ใช้แบบหมุนเวียน ใช้ได้ครั้งเดียว
+type RefreshTokens struct {
+	TokenID      string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"tokenid"`
+	FamilyID     string     `gorm:"type:uuid;not null;index" json:"familyid"` // token ที่หมุนต่อกันมาจากการ login ครั้งเดียวกัน
+	EmployeeID   string     `gorm:"type:uuid;not null;index" json:"employeeid"`
+	TokenHash    string     `gorm:"type:varchar(64);not null;unique" json:"-"`
+	BranchID     *string    `gorm:"type:uuid" json:"branchid"` // สาขาที่เลือกตอน login (Super Admin)
+	TokenVersion int        `gorm:"type:int;not null" json:"-"`
+	ExpiresAt    time.Time  `gorm:"type:timestamp;not null" json:"expiresat"`
+	RevokedAt    *time.Time `gorm:"type:timestamp" json:"revokedat"`
+	ReplacedBy   *string    `gorm:"type:uuid" json:"replacedby"`
+	CreatedAt    time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (RefreshTokens) TableName() string {
+	return "RefreshTokens"
+}
+
+// RevokedTokens struct access token ที่ถูกยกเลิกก่อนหมดอายุ (logout) อ้างอิงด้วย jti
+type RevokedTokens struct {
+	JTI       string    `gorm:"type:uuid;primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"type:timestamp;not null;index" json:"expiresat"` // ลบทิ้งได้หลังเวลานี้
+	RevokedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"revokedat"`
+}
+
+func (RevokedTokens) TableName() string {
+	return "RevokedTokens"
+}
+
+// LoginAttempts struct จำนวนครั้งที่ login ผิดติดกันของบัญชีหรือ IP (key เช่น account:email, ip:127.0.0.1)
+type LoginAttempts struct {
+	Key         string     `gorm:"type:varchar(200);primaryKey" json:"key"`
+	Failures    int        `gorm:"type:int;not null;default:0" json:"failures"`
+	LastFailure time.Time  `gorm:"type:timestamp;not null" json:"lastfailure"`
+	LockedUntil *time.Time `gorm:"type:timestamp" json:"lockeduntil"`
+}
+
+func (LoginAttempts) TableName() string {
+	return "LoginAttempts"
+}
+
+// LoginAudits struct ประวัติการ login ทั้งสำเร็จและไม่สำเร็จ
+type LoginAudits struct {
+	AuditID    string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"auditid"`
+	Email      string    `gorm:"type:varchar(100);not null;index" json:"email"`
+	EmployeeID *string   `gorm:"type:uuid;index" json:"employeeid"`
+	IP         string    `gorm:"type:varchar(64);not null" json:"ip"`
+	UserAgent  string    `gorm:"type:varchar(255)" json:"useragent"`
+	Method     string    `gorm:"type:varchar(20);not null;default:'password'" json:"method"` // password, pin
+	DeviceID   *string   `gorm:"type:uuid" json:"deviceid"`                                  // เครื่อง POS ที่ใช้ login ด้วย PIN
+	Result     string    `gorm:"type:varchar(30);not null" json:"result"`                    // success, invalid_credentials, throttled, locked, unlocked
+	CreatedAt  time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;index" json:"createdat"`
+}
+
+func (LoginAudits) TableName() string {
+	return "LoginAudits"
+}
+
+// PosDevices struct เครื่อง POS ที่ลงทะเบียนกับสาขา ใช้ login พนักงานด้วย PIN
+type PosDevices struct {
+	DeviceID   string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"deviceid"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	BranchID   string     `gorm:"type:uuid;not null;index" json:"branchid"`
+	SecretHash string     `gorm:"type:varchar(64);not null" json:"-"` // sha256 ของ secret ที่ให้เครื่องตอนลงทะเบียน
+	Status     string     `gorm:"type:varchar(20);not null;default:'active';check:status IN ('active', 'disabled')" json:"status"`
+	LastSeenAt *time.Time `gorm:"type:timestamp" json:"lastseenat"`
+	CreatedAt  time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (PosDevices) TableName() string {
+	return "PosDevices"
+}
+
+// Shifts struct กะการทำงานของพนักงานกับลิ้นชักเงินสด (เปิดได้ครั้งละหนึ่งกะต่อพนักงาน)
+type Shifts struct {
+	ShiftID      string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"shiftid"`
+	BranchID     string     `gorm:"type:uuid;not null;index" json:"branchid"`
+	EmployeeID   string     `gorm:"type:uuid;not null;uniqueIndex:idx_shifts_open_employee,where:status = 'open'" json:"employeeid"`
+	DeviceID     *string    `gorm:"type:uuid" json:"deviceid"`
+	Status       string     `gorm:"type:varchar(20);not null;default:'open';check:status IN ('open', 'closed')" json:"status"`
+	OpeningFloat float64    `gorm:"type:numeric(10,2);not null;default:0" json:"openingfloat"` // เงินทอนตั้งต้นในลิ้นชัก
+	ExpectedCash *float64   `gorm:"type:numeric(10,2)" json:"expectedcash"`                    // บันทึกตอนปิดกะ
+	CountedCash  *float64   `gorm:"type:numeric(10,2)" json:"countedcash"`
+	Variance     *float64   `gorm:"type:numeric(10,2)" json:"variance"` // นับได้ - ที่ควรมี
+	Note         string     `gorm:"type:varchar(255)" json:"note"`
+	OpenedAt     time.Time  `gorm:"type:timestamp;not null" json:"openedat"`
+	ClosedAt     *time.Time `gorm:"type:timestamp" json:"closedat"`
+	ClosedBy     *string    `gorm:"type:uuid" json:"closedby"`
+
+	Movements []ShiftCashMovements `gorm:"foreignKey:ShiftID;constraint:OnDelete:CASCADE" json:"movements,omitempty"`
+	Counts    []ShiftCashCounts    `gorm:"foreignKey:ShiftID;constraint:OnDelete:CASCADE" json:"counts,omitempty"`
+}
+
+func (Shifts) TableName() string {
+	return "Shifts"
+}
+
+// ShiftCashMovements struct การนำเงินเข้า (pay_in) หรือออก (pay_out) จากลิ้นชักระหว่างกะ
+type ShiftCashMovements struct {
+	MovementID string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"movementid"`
+	ShiftID    string    `gorm:"type:uuid;not null;index" json:"shiftid"`
+	Type       string    `gorm:"type:varchar(10);not null;check:type IN ('pay_in', 'pay_out')" json:"type"`
+	Amount     float64   `gorm:"type:numeric(10,2);not null" json:"amount"`
+	Reason     string    `gorm:"type:varchar(255);not null" json:"reason"`
+	EmployeeID string    `gorm:"type:uuid;not null" json:"employeeid"`
+	CreatedAt  time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (ShiftCashMovements) TableName() string {
+	return "ShiftCashMovements"
+}
+
+// ShiftCashCounts struct จำนวนธนบัตร/เหรียญแต่ละชนิดที่นับได้ตอนปิดกะ
+type ShiftCashCounts struct {
+	ShiftID      string  `gorm:"type:uuid;primaryKey" json:"shiftid"`
+	Denomination float64 `gorm:"type:numeric(10,2);primaryKey" json:"denomination"`
+	Quantity     int     `gorm:"type:int;not null" json:"quantity"`
+	Amount       float64 `gorm:"type:numeric(10,2);not null" json:"amount"`
+}
+
+func (ShiftCashCounts) TableName() string {
+	return "ShiftCashCounts"
+}
+
+// AuditLogs struct ประวัติการเปลี่ยนแปลงข้อมูลทุก request ที่เป็น POST/PUT/PATCH/DELETE
+// เพิ่มได้อย่างเดียว แต่ละแถวเก็บ hash ของแถวก่อนหน้าเพื่อให้ตรวจได้ว่ามีการแก้ไขย้อนหลังหรือไม่
+type AuditLogs struct {
+	AuditID    string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"auditid"`
+	Sequence   int64     `gorm:"type:bigint;not null;uniqueIndex" json:"sequence"`
+	ActorID    string    `gorm:"type:uuid;index" json:"actorid"`
+	ActorEmail string    `gorm:"type:varchar(100)" json:"actoremail"`
+	ActorRole  string    `gorm:"type:varchar(12)" json:"actorrole"`
+	BranchID   string    `gorm:"type:varchar(36);index" json:"branchid"` // สาขาของผู้ทำรายการ
+	DeviceID   string    `gorm:"type:varchar(36)" json:"deviceid"`
+	Method     string    `gorm:"type:varchar(10);not null" json:"method"`
+	Path       string    `gorm:"type:varchar(255);not null" json:"path"`
+	Action     string    `gorm:"type:varchar(30);not null;index" json:"action"` // create, update, delete หรือชื่อ action เช่น refunds, close
+	Entity     string    `gorm:"type:varchar(50);not null;index" json:"entity"`
+	EntityID   string    `gorm:"type:varchar(36);index" json:"entityid"`
+	Status     int       `gorm:"type:int;not null" json:"status"`
+	Request    string    `gorm:"type:text" json:"request"` // body ของ request (ตัดข้อมูลลับออกแล้ว)
+	Before     string    `gorm:"type:text" json:"before"`
+	After      string    `gorm:"type:text" json:"after"`
+	Changes    string    `gorm:"type:text" json:"changes"` // {"column": {"from": ..., "to": ...}}
+	IP         string    `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string    `gorm:"type:varchar(255)" json:"useragent"`
+	CreatedAt  time.Time `gorm:"type:timestamptz;not null;index" json:"createdat"`
+	PrevHash   string    `gorm:"type:varchar(64);not null" json:"prevhash"`
+	Hash       string    `gorm:"type:varchar(64);not null" json:"hash"`
+}
+
+func (AuditLogs) TableName() string {
+	return "AuditLogs"
+}
+
+// StockMovements struct ทุกการเปลี่ยนแปลงจำนวนสินค้าใน Inventory (Quantity ของ Inventory ต้องเท่ากับผลรวมของ ledger)
+type StockMovements struct {
+	MovementID    string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"movementid"`
+	InventoryID   string    `gorm:"type:uuid;not null;index:idx_stock_movements_inventory,priority:1" json:"inventoryid"`
+	BranchID      string    `gorm:"type:uuid;not null;index" json:"branchid"`
+	ProductID     string    `gorm:"type:uuid;not null;index" json:"productid"`
+	Type          string    `gorm:"type:varchar(30);not null;check:type IN ('opening_balance', 'sale', 'refund', 'transfer_out', 'transfer_in', 'shipment_receipt', 'adjustment', 'count_correction')" json:"type"`
+	Quantity      int       `gorm:"type:int;not null" json:"quantity"` // + รับเข้า, - จ่ายออก
+	BalanceAfter  int       `gorm:"type:int;not null" json:"balanceafter"`
+	ReferenceType string    `gorm:"type:varchar(30)" json:"referencetype"` // sale, refund, request, shipment, inventory, adjustment, stocktake
+	ReferenceID   *string   `gorm:"type:uuid;index" json:"referenceid"`
+	EmployeeID    *string   `gorm:"type:uuid" json:"employeeid"`
+	Note          string    `gorm:"type:varchar(255)" json:"note"`
+	CreatedAt     time.Time `gorm:"type:timestamp;not null;index:idx_stock_movements_inventory,priority:2" json:"createdat"`
+}
+
+func (StockMovements) TableName() string {
+	return "StockMovements"
+}
+
+// StockAdjustments struct การปรับจำนวนสินค้าพร้อมเหตุผล มูลค่าเกินเกณฑ์ต้องรออนุมัติก่อนจึงจะมีผลกับ Inventory
+type StockAdjustments struct {
+	AdjustmentID string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"adjustmentid"`
+	InventoryID  string     `gorm:"type:uuid;not null;index" json:"inventoryid"`
+	BranchID     string     `gorm:"type:uuid;not null;index" json:"branchid"`
+	ProductID    string     `gorm:"type:uuid;not null" json:"productid"`
+	Quantity     int        `gorm:"type:int;not null" json:"quantity"` // + พบสินค้าเพิ่ม, - สินค้าหาย/เสียหาย
+	ReasonCode   string     `gorm:"type:varchar(20);not null;check:reason_code IN ('damage', 'theft', 'expiry', 'found_stock', 'sample')" json:"reasoncode"`
+	Note         string     `gorm:"type:varchar(255);not null" json:"note"`
+	Value        float64    `gorm:"type:numeric(10,2);not null" json:"value"` // มูลค่าตามราคาขาย (จำนวน x ราคา)
+	Status       string     `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'applied', 'rejected')" json:"status"`
+	RequestedBy  string     `gorm:"type:uuid;not null" json:"requestedby"`
+	ReviewedBy   *string    `gorm:"type:uuid" json:"reviewedby"`
+	ReviewedAt   *time.Time `gorm:"type:timestamp" json:"reviewedat"`
+	ReviewNote   string     `gorm:"type:varchar(255)" json:"reviewnote"`
+	AppliedAt    *time.Time `gorm:"type:timestamp" json:"appliedat"`
+	CreatedAt    time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;index" json:"createdat"`
+}
+
+func (StockAdjustments) TableName() string {
+	return "StockAdjustments"
+}
+
+// Stocktakes struct รอบการนับสต็อกของสาขา (full = ทุกสินค้า, cycle = เฉพาะหมวดหมู่/สินค้าที่เลือก)
+type Stocktakes struct {
+	StocktakeID string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"stocktakeid"`
+	BranchID    string     `gorm:"type:uuid;not null;index" json:"branchid"`
+	Type        string     `gorm:"type:varchar(10);not null;check:type IN ('full', 'cycle')" json:"type"`
+	CategoryID  *string    `gorm:"type:uuid" json:"categoryid"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'open';check:status IN ('open', 'approved', 'cancelled')" json:"status"`
+	Note        string     `gorm:"type:varchar(255)" json:"note"`
+	SnapshotAt  time.Time  `gorm:"type:timestamp;not null" json:"snapshotat"` // เวลาที่บันทึกจำนวนที่ควรมี
+	CreatedBy   string     `gorm:"type:uuid;not null" json:"createdby"`
+	ApprovedBy  *string    `gorm:"type:uuid" json:"approvedby"`
+	ApprovedAt  *time.Time `gorm:"type:timestamp" json:"approvedat"`
+	CreatedAt   time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+
+	Lines []StocktakeLines `gorm:"foreignKey:StocktakeID;constraint:OnDelete:CASCADE" json:"lines,omitempty"`
+}
+
+func (Stocktakes) TableName() string {
+	return "Stocktakes"
+}
+
+// StocktakeLines struct สินค้าแต่ละรายการในรอบนับ พร้อมจำนวนที่ควรมี ณ เวลาเริ่มนับ
+type StocktakeLines struct {
+	LineID           string `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"lineid"`
+	StocktakeID      string `gorm:"type:uuid;not null;uniqueIndex:idx_stocktake_lines_product,priority:1" json:"stocktakeid"`
+	InventoryID      string `gorm:"type:uuid;not null" json:"inventoryid"`
+	ProductID        string `gorm:"type:uuid;not null;uniqueIndex:idx_stocktake_lines_product,priority:2" json:"productid"`
+	SnapshotQuantity int    `gorm:"type:int;not null" json:"snapshotquantity"`
+	CountedQuantity  *int   `gorm:"type:int" json:"countedquantity"`  // ผลรวมของทุกคนที่นับ (null = ยังไม่นับ)
+	ExpectedQuantity *int   `gorm:"type:int" json:"expectedquantity"` // จำนวนที่ควรมี ณ เวลาที่นับ (บันทึกตอนอนุมัติ)
+	Variance         *int   `gorm:"type:int" json:"variance"`         // นับได้ - ที่ควรมี (บันทึกตอนอนุมัติ)
+}
+
+func (StocktakeLines) TableName() string {
+	return "StocktakeLines"
+}
+
+// StocktakeCounts struct จำนวนที่พนักงานแต่ละคนนับหรือสแกนได้ (หลายคนนับรายการเดียวกันได้ ยอดรวมกัน)
+type StocktakeCounts struct {
+	CountID     string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"countid"`
+	StocktakeID string    `gorm:"type:uuid;not null;index" json:"stocktakeid"`
+	LineID      string    `gorm:"type:uuid;not null;index" json:"lineid"`
+	ProductID   string    `gorm:"type:uuid;not null" json:"productid"`
+	Quantity    int       `gorm:"type:int;not null" json:"quantity"` // ติดลบได้เพื่อแก้การสแกนผิด
+	Source      string    `gorm:"type:varchar(10);not null;default:'manual';check:source IN ('manual', 'scan')" json:"source"`
+	CounterID   string    `gorm:"type:uuid;not null" json:"counterid"`
+	CreatedAt   time.Time `gorm:"type:timestamp;not null" json:"createdat"`
+}
+
+func (StocktakeCounts) TableName() string {
+	return "StocktakeCounts"
+}
+
+// ReplenishmentSuggestions struct รายการเติมสินค้าที่ระบบเสนอเมื่อ Inventory ต่ำกว่าจุดสั่งซื้อ
+// เมื่ออนุมัติจะสร้าง Requests (โอนจากสาขาอื่น) หรือ Shipments (สั่งจาก supplier)
+type ReplenishmentSuggestions struct {
+	SuggestionID string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"suggestionid"`
+	BranchID     string     `gorm:"type:uuid;not null;index;uniqueIndex:idx_replenishment_pending,priority:1,where:status = 'pending'" json:"branchid"`
+	ProductID    string     `gorm:"type:uuid;not null;uniqueIndex:idx_replenishment_pending,priority:2" json:"productid"` // รายการที่รออนุมัติมีได้ครั้งละหนึ่งรายการต่อสินค้า
+	InventoryID  string     `gorm:"type:uuid;not null" json:"inventoryid"`
+	OnHand       int        `gorm:"type:int;not null" json:"onhand"`   // จำนวนคงเหลือตอนที่ตรวจพบ
+	Incoming     int        `gorm:"type:int;not null" json:"incoming"` // จำนวนที่กำลังจะเข้ามาจาก Requests/Shipments ที่ยังไม่เสร็จ
+	ReorderPoint int        `gorm:"type:int;not null" json:"reorderpoint"`
+	MaxQuantity  int        `gorm:"type:int;not null" json:"maxquantity"`
+	AverageDaily float64    `gorm:"type:numeric(10,2);not null;default:0" json:"averagedaily"` // ยอดขายเฉลี่ยต่อวันจากการพยากรณ์
+	DaysOfCover  *float64   `gorm:"type:numeric(10,2)" json:"daysofcover"`                     // stock พอขายได้กี่วัน (null = ไม่หมดในช่วงพยากรณ์)
+	Quantity     int        `gorm:"type:int;not null;check:quantity > 0" json:"quantity"`
+	Source       string     `gorm:"type:varchar(10);not null;check:source IN ('transfer', 'purchase')" json:"source"`
+	FromBranchID *string    `gorm:"type:uuid" json:"frombranchid"` // สาขาที่โอนให้ (เฉพาะ transfer)
+	Status       string     `gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending', 'approved', 'rejected')" json:"status"`
+	RequestID    *string    `gorm:"type:uuid" json:"requestid"`
+	ShipmentID   *string    `gorm:"type:uuid" json:"shipmentid"`
+	ReviewedBy   *string    `gorm:"type:uuid" json:"reviewedby"`
+	ReviewedAt   *time.Time `gorm:"type:timestamp" json:"reviewedat"`
+	CreatedAt    time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (ReplenishmentSuggestions) TableName() string {
+	return "ReplenishmentSuggestions"
+}
+
+// Customers struct ลูกค้าสมาชิกสะสมแต้ม
+type Customers struct {
+	CustomerID    string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"customerid"`
+	Phone         string    `gorm:"type:varchar(20);not null;unique" json:"phone"`
+	Name          string    `gorm:"type:varchar(100);not null" json:"name"`
+	Email         string    `gorm:"type:varchar(100)" json:"email"`
+	Tier          string    `gorm:"type:varchar(20);not null;default:'Standard';check:tier IN ('Standard', 'Silver', 'Gold', 'Platinum')" json:"tier"`
+	PointsBalance int       `gorm:"type:int;not null;default:0" json:"pointsbalance"`
+	CreatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (Customers) TableName() string {
+	return "Customers"
+}
+
+// PointsLedger struct ประวัติการได้รับ/ใช้แต้มของลูกค้า
+type PointsLedger struct {
+	EntryID      string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"entryid"`
+	CustomerID   string    `gorm:"type:uuid;not null;index" json:"customerid"`
+	SaleID       *string   `gorm:"type:uuid" json:"saleid"`
+	RefundID     *string   `gorm:"type:uuid" json:"refundid"`
+	Type         string    `gorm:"type:varchar(20);not null" json:"type"` // earn, redeem, reverse
+	Points       int       `gorm:"type:int;not null" json:"points"`       // บวก = ได้รับ, ลบ = ใช้/หัก
+	BalanceAfter int       `gorm:"type:int;not null" json:"balanceafter"`
+	CreatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (PointsLedger) TableName() string {
+	return "PointsLedger"
+}
+
+// Refunds struct การคืนเงิน/ยกเลิกการขาย อ้างอิงใบลดหนี้ (credit note) ที่ออกให้
+type Refunds struct {
+	RefundID        string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"refundid"`
+	SaleID          string    `gorm:"type:uuid;not null;index" json:"saleid"`
+	ReceiptID       string    `gorm:"type:uuid;not null" json:"receiptid"` // ใบลดหนี้
+	BranchID        string    `gorm:"type:uuid;not null" json:"branchid"`
+	EmployeeID      string    `gorm:"type:uuid" json:"employeeid"`
+	ReasonCode      string    `gorm:"type:varchar(30);not null" json:"reasoncode"`
+	Note            string    `gorm:"type:varchar(255)" json:"note"`
+	TotalAmount     float64   `gorm:"type:numeric(10,2);not null" json:"totalamount"`
+	NetAmount       float64   `gorm:"type:numeric(10,2);not null;default:0" json:"netamount"`
+	VatAmount       float64   `gorm:"type:numeric(10,2);not null;default:0" json:"vatamount"`
+	Method          string    `gorm:"type:varchar(20);not null;default:'cash'" json:"method"`    // ช่องทางที่คืนเงิน: cash, card, promptpay, voucher
+	PointsAmount    float64   `gorm:"type:numeric(10,2);not null;default:0" json:"pointsamount"` // ส่วนของยอดคืนที่คืนเป็นแต้ม (ลูกค้าชำระด้วยแต้ม) คืนเป็นเงินจริง = TotalAmount - PointsAmount
+	PointsShortfall int       `gorm:"type:int;not null;default:0" json:"pointsshortfall"`        // แต้มที่ต้องหักคืนแต่ลูกค้าใช้ไปแล้ว
+	ShiftID         *string   `gorm:"type:uuid;index" json:"shiftid"`                            // กะที่จ่ายเงินคืน (บังคับเมื่อคืนเป็นเงินสด)
+	CreatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+
+	Items []RefundItems `gorm:"foreignKey:RefundID;constraint:OnDelete:CASCADE" json:"items"`
+}
+
+func (Refunds) TableName() string {
+	return "Refunds"
+}
+
+// RefundItems struct รายการสินค้าที่คืนต่อ SaleItems
+type RefundItems struct {
+	RefundItemID string  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"refunditemid"`
+	RefundID     string  `gorm:"type:uuid;not null;index" json:"refundid"`
+	SaleItemID   string  `gorm:"type:uuid;not null;index" json:"saleitemid"`
+	ProductID    string  `gorm:"type:uuid;not null" json:"productid"`
+	Quantity     int     `gorm:"type:int;not null" json:"quantity"`
+	UnitPrice    float64 `gorm:"type:numeric(10,2);not null" json:"unitprice"`
+	TotalPrice   float64 `gorm:"type:numeric(10,2);not null" json:"totalprice"`
+	NetAmount    float64 `gorm:"type:numeric(10,2);not null;default:0" json:"netamount"`
+	VatAmount    float64 `gorm:"type:numeric(10,2);not null;default:0" json:"vatamount"`
+}
+
+func (RefundItems) TableName() string {
+	return "RefundItems"
+}
+
+// Requests struct เอกสารโอนสินค้าระหว่างสาขา (รายการสินค้าอยู่ใน RequestItems)
 type Requests struct {
 	RequestID    string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"requestid"`
 	FromBranchID string    `gorm:"type:uuid;foreignKey:BranchID" json:"frombranchid"`
 	ToBranchID   string    `gorm:"type:uuid;foreignKey:BranchID" json:"tobranchid"`
-	ProductID    string    `gorm:"type:uuid;foreignKey:ProductID" json:"productid"`
-	Quantity     int       `gorm:"type:int;not null" json:"quantity"`
-	Status       string    `gorm:"type:varchar(50);default:'pending'" json:"status"`
+	Status       string    `gorm:"type:varchar(50);not null;default:'pending';check:status IN ('pending', 'approved', 'picked', 'in_transit', 'received', 'rejected', 'cancelled')" json:"status"`
+	Note         string    `gorm:"type:varchar(255)" json:"note"`
 	CreatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+	UpdatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"updatedat"`
+
+	Items []RequestItems `gorm:"foreignKey:RequestID;constraint:OnDelete:CASCADE" json:"items"`
 }
 
 func (Requests) TableName() string {
 	return "Requests"
 }
 
+// RequestItems struct สินค้าแต่ละรายการในเอกสารโอน ส่งและรับได้ไม่ครบตามที่ขอ
+type RequestItems struct {
+	RequestItemID    string `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"requestitemid"`
+	RequestID        string `gorm:"type:uuid;not null;uniqueIndex:idx_request_items_product,priority:1" json:"requestid"`
+	ProductID        string `gorm:"type:uuid;not null;uniqueIndex:idx_request_items_product,priority:2" json:"productid"`
+	Quantity         int    `gorm:"type:int;not null;check:quantity > 0" json:"quantity"` // จำนวนที่ขอ
+	ShippedQuantity  int    `gorm:"type:int;not null;default:0" json:"shippedquantity"`   // จำนวนที่สาขาต้นทางส่งออก
+	ReceivedQuantity int    `gorm:"type:int;not null;default:0" json:"receivedquantity"`  // จำนวนที่สาขาปลายทางรับจริง
+	DiscrepancyNote  string `gorm:"type:varchar(255)" json:"discrepancynote"`             // เหตุผลเมื่อส่ง/รับไม่ตรงกับที่ขอ
+}
+
+func (RequestItems) TableName() string {
+	return "RequestItems"
+}
+
+// RequestTransitions struct ประวัติการเปลี่ยนสถานะของ Requests (ใคร เปลี่ยนจากอะไรเป็นอะไร เมื่อไร)
+type RequestTransitions struct {
+	TransitionID string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"transitionid"`
+	RequestID    string    `gorm:"type:uuid;not null;index" json:"requestid"`
+	FromStatus   string    `gorm:"type:varchar(50)" json:"fromstatus"` // ว่าง = สร้างใหม่
+	ToStatus     string    `gorm:"type:varchar(50);not null" json:"tostatus"`
+	EmployeeID   string    `gorm:"type:uuid" json:"employeeid"`
+	Note         string    `gorm:"type:varchar(255)" json:"note"`
+	CreatedAt    time.Time `gorm:"type:timestamp;not null" json:"createdat"`
+}
+
+func (RequestTransitions) TableName() string {
+	return "RequestTransitions"
+}
+
 // Shipments struct
 type Shipments struct {
 	ShipmentID     string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"shipmentid"`
-	ShipmentNumber string    `gorm:"type:varchar(20);unique;not null" json:"shipmentnumber"` // ✅ เพิ่ม Shipment Number
+	ShipmentNumber string    `gorm:"type:varchar(50);unique;not null" json:"shipmentnumber"` // ✅ เพิ่ม Shipment Number
 	BranchID       string    `gorm:"type:uuid;not null" json:"branchid"`
 	Status         string    `gorm:"type:varchar(50);default:'pending'" json:"status"`
 	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
@@ -176,10 +653,46 @@ func (ShipmentItems) TableName() string {
 type Category struct {
 	CategoryID   string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"categoryid"`
 	CategoryName string    `gorm:"type:varchar(100);not null" json:"categoryname"`
-	CategoryCode string    `gorm:"type:varchar(4);not null;unique" json:"categorycode"` // เพิ่ม CategoryCode
+	CategoryCode string    `gorm:"type:varchar(4);not null;unique" json:"categorycode"`          // เพิ่ม CategoryCode
+	TaxMode      string    `gorm:"type:varchar(10);not null;default:'inclusive'" json:"taxmode"` // inclusive, exclusive, exempt
+	TaxRate      float64   `gorm:"type:numeric(5,2);not null;default:7" json:"taxrate"`          // อัตรา VAT (%)
 	CreatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
 }
 
 func (Category) TableName() string {
 	return "Category"
 }
+
+// Promotions struct โปรโมชันที่ใช้คำนวณส่วนลดอัตโนมัติตอนขาย
+type Promotions struct {
+	PromotionID string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"promotionid"`
+	Name        string     `gorm:"type:varchar(100);not null" json:"name"`
+	Type        string     `gorm:"type:varchar(20);not null;check:type IN ('percent', 'amount', 'buy_x_get_y', 'bundle')" json:"type"`
+	Value       float64    `gorm:"type:numeric(10,2);not null;default:0" json:"value"` // percent: % ที่ลด, amount: บาทที่ลดต่อชิ้น, bundle: ราคาชุด
+	BuyQuantity int        `gorm:"type:int;not null;default:0" json:"buyquantity"`     // buy_x_get_y: จำนวนที่ต้องซื้อ, bundle: จำนวนชิ้นต่อชุด
+	GetQuantity int        `gorm:"type:int;not null;default:0" json:"getquantity"`     // buy_x_get_y: จำนวนที่แถมฟรี
+	ProductID   *string    `gorm:"type:uuid;index" json:"productid"`                   // ถ้าไม่ระบุทั้งสินค้าและหมวดหมู่ใช้กับสินค้าทุกชิ้น
+	CategoryID  *string    `gorm:"type:uuid;index" json:"categoryid"`
+	BranchID    *string    `gorm:"type:uuid;index" json:"branchid"` // ถ้าไม่ระบุใช้ได้ทุกสาขา
+	StartAt     *time.Time `gorm:"type:timestamp" json:"startat"`
+	EndAt       *time.Time `gorm:"type:timestamp" json:"endat"`
+	Priority    int        `gorm:"type:int;not null;default:0" json:"priority"` // ค่ามากถูกเลือกก่อน
+	Status      string     `gorm:"type:varchar(10);not null;default:'active';check:status IN ('active', 'inactive')" json:"status"`
+	CreatedAt   time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"createdat"`
+}
+
+func (Promotions) TableName() string {
+	return "Promotions"
+}
+
+// SequenceCounters struct เก็บเลขลำดับล่าสุดของเอกสารแต่ละชุด แยกตาม scope และช่วงเวลา
+type SequenceCounters struct {
+	Scope     string    `gorm:"type:varchar(100);primaryKey" json:"scope"` // เช่น receipt:<branchid>
+	Period    string    `gorm:"type:varchar(8);primaryKey" json:"period"`  // เช่น 20261018
+	LastValue int64     `gorm:"type:bigint;not null;default:0" json:"lastvalue"`
+	UpdatedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"updatedat"`
+}
+
+func (SequenceCounters) TableName() string {
+	return "SequenceCounters"
+}
@@ -0,0 +1,46 @@
+package Printing
+
+// ความกว้างของแท่ง/ช่องว่างของสัญลักษณ์ CODE128 ค่า 0-106 (106 = Stop)
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+// เข้ารหัสข้อความเป็นบาร์โค้ด CODE128 ชุด B
+// คืนค่าเป็นความกว้างของแท่ง/ช่องว่างสลับกัน (เริ่มจากแท่งดำ) หน่วยเป็น module
+// ตัวอักษรนอกช่วง ASCII 32-127 จะถูกแทนด้วย '?'
+func Code128(data string) []int {
+	values := []int{code128StartB}
+	checksum := code128StartB
+	for i, r := range data {
+		if r < 32 || r > 127 {
+			r = '?'
+		}
+		v := int(r) - 32
+		values = append(values, v)
+		checksum += v * (i + 1)
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	var widths []int
+	for _, v := range values {
+		for _, w := range code128Patterns[v] {
+			widths = append(widths, int(w-'0'))
+		}
+	}
+	return widths
+}
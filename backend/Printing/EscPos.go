@@ -0,0 +1,96 @@
+package Printing
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// คำสั่ง ESC/POS ที่ใช้
+var (
+	escInit        = []byte{0x1B, 0x40}
+	escAlignLeft   = []byte{0x1B, 0x61, 0x00}
+	escAlignCenter = []byte{0x1B, 0x61, 0x01}
+	escBoldOn      = []byte{0x1B, 0x45, 0x01}
+	escBoldOff     = []byte{0x1B, 0x45, 0x00}
+	escFeedAndCut  = []byte{0x1D, 0x56, 0x42, 0x03}
+)
+
+// แปลงข้อความ UTF-8 เป็น TIS-620 ซึ่งเป็น encoding ภาษาไทยที่เครื่องพิมพ์ใบเสร็จรองรับ
+// อักษรไทย U+0E01-U+0E5B ตรงกับ 0xA1-0xFB ส่วนตัวอักษรอื่นที่ไม่ใช่ ASCII จะถูกแทนด้วย '?'
+func toTIS620(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case r < 0x80:
+			out = append(out, byte(r))
+		case r >= 0x0E01 && r <= 0x0E5B:
+			out = append(out, byte(r-0x0E01+0xA1))
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// สร้างคำสั่งพิมพ์ QR code (GS ( k) ให้เครื่องพิมพ์สร้างภาพเอง
+func escQRCode(data string) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00}) // model 2
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, 0x06})       // module size
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, 0x31})       // error correction M
+	n := len(data) + 3
+	b.Write([]byte{0x1D, 0x28, 0x6B, byte(n % 256), byte(n / 256), 0x31, 0x50, 0x30})
+	b.WriteString(data)
+	b.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30}) // print
+	return b.Bytes()
+}
+
+// สร้างคำสั่งพิมพ์บาร์โค้ด CODE128 (GS k) พร้อมตัวเลขใต้บาร์โค้ด
+func escBarcode(data string) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x1D, 0x68, 0x50}) // ความสูง 80 dots
+	b.Write([]byte{0x1D, 0x77, 0x02}) // ความกว้าง module
+	b.Write([]byte{0x1D, 0x48, 0x02}) // แสดงตัวอักษรใต้บาร์โค้ด
+	payload := "{B" + data
+	b.Write([]byte{0x1D, 0x6B, 0x49, byte(len(payload))})
+	b.WriteString(payload)
+	return b.Bytes()
+}
+
+// สร้าง byte stream ESC/POS ของใบเสร็จสำหรับเครื่องพิมพ์ 58mm หรือ 80mm
+// codePage คือค่า n ของคำสั่ง ESC t n สำหรับตารางอักษรไทยของเครื่องพิมพ์ (0 = ไม่ส่งคำสั่ง)
+func EscPos(r Receipt, paperWidth int, codePage int) []byte {
+	var b bytes.Buffer
+	b.Write(escInit)
+	if codePage > 0 {
+		b.Write([]byte{0x1B, 0x74, byte(codePage)})
+	}
+	b.Write(escAlignLeft)
+
+	for _, line := range layout(r, Columns(paperWidth)) {
+		if line.Bold {
+			b.Write(escBoldOn)
+		}
+		b.Write(toTIS620(line.Text))
+		b.WriteByte('\n')
+		if line.Bold {
+			b.Write(escBoldOff)
+		}
+	}
+
+	switch r.CodeType {
+	case "qr":
+		b.Write(escAlignCenter)
+		b.Write(escQRCode(r.Number))
+		b.WriteByte('\n')
+	case "barcode":
+		b.Write(escAlignCenter)
+		b.Write(escBarcode(r.Number))
+		b.WriteByte('\n')
+	}
+
+	b.Write(escFeedAndCut)
+	return b.Bytes()
+}
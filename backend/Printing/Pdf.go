@@ -0,0 +1,352 @@
+package Printing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	pdfFontSize   = 7.0
+	pdfLineHeight = 9.0
+	pdfCharWidth  = pdfFontSize * 0.6 // ความกว้างตัวอักษรของฟอนต์ Courier
+	pdfMargin     = 12.0
+	pdfBarHeight  = 36.0
+	pdfModule     = 1.0 // ความกว้างสูงสุดของ module บาร์โค้ด (จะย่อลงถ้าบาร์โค้ดยาวเกินหน้า)
+	pdfQRModule   = 2.0 // ขนาดสูงสุดของ module QR code
+	pdfQRQuiet    = 4   // ขอบว่างรอบ QR code (module)
+)
+
+// ฟอนต์ TrueType ที่มีอักษรไทยสำหรับ PDF ตั้งค่าได้ด้วย RECEIPT_FONT และ RECEIPT_BOLD_FONT
+// ค่าเริ่มต้นคือ TlwgMono จากแพ็กเกจ fonts-tlwg-mono ซึ่งทุกตัวอักษรกว้างเท่ากันเหมือนหัวพิมพ์ใบเสร็จ
+const (
+	defaultReceiptFont     = "/usr/share/fonts/truetype/tlwg/TlwgMono.ttf"
+	defaultReceiptBoldFont = "/usr/share/fonts/truetype/tlwg/TlwgMono-Bold.ttf"
+)
+
+var (
+	receiptFontsOnce sync.Once
+	receiptRegular   *trueTypeFont
+	receiptBold      *trueTypeFont
+)
+
+// โหลดฟอนต์ครั้งแรกที่สร้าง PDF ถ้าโหลดฟอนต์ปกติไม่ได้จะใช้ Courier (อักษรไทยกลายเป็น '?')
+// ถ้าไม่มีฟอนต์ตัวหนาจะใช้ฟอนต์ปกติแบบเติมเส้นขอบแทน
+func receiptFonts() (*trueTypeFont, *trueTypeFont) {
+	receiptFontsOnce.Do(func() {
+		load := func(env string, fallback string) *trueTypeFont {
+			path := os.Getenv(env)
+			if path == "" {
+				path = fallback
+			}
+			font, err := loadTrueType(path)
+			if err != nil {
+				log.Printf("Receipt PDF font %s (%s): %v", path, env, err)
+				return nil
+			}
+			return font
+		}
+		receiptRegular = load("RECEIPT_FONT", defaultReceiptFont)
+		if receiptRegular != nil {
+			receiptBold = load("RECEIPT_BOLD_FONT", defaultReceiptBoldFont)
+		} else {
+			log.Printf("Receipt PDF falls back to Courier; Thai text will print as '?'")
+		}
+	})
+	return receiptRegular, receiptBold
+}
+
+// แปลงข้อความสำหรับฟอนต์มาตรฐานของ PDF (WinAnsi) ใช้เมื่อไม่มีฟอนต์ TrueType
+// ฟอนต์มาตรฐานไม่มีอักษรไทย จึงตัดสระ/วรรณยุกต์ที่ไม่กินความกว้างออก และแทนอักษรอื่นด้วย '?' เพื่อให้คอลัมน์ยังตรงกัน
+func pdfText(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case isThaiCombining(r):
+			continue
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfFont ฟอนต์หนึ่งตัวในหน้า PDF
+type pdfFont struct {
+	resource string        // ชื่อใน Resources เช่น F1
+	ttf      *trueTypeFont // nil = ฟอนต์มาตรฐาน base
+	base     string
+	used     map[uint16]rune // glyph ที่ใช้ในหน้า สำหรับ /W และ ToUnicode
+}
+
+func newPDFFont(resource string, ttf *trueTypeFont, base string) *pdfFont {
+	return &pdfFont{resource: resource, ttf: ttf, base: base, used: map[uint16]rune{}}
+}
+
+// ความกว้างของหนึ่งช่องตัวอักษร
+func (f *pdfFont) cellWidth() float64 {
+	if f.ttf == nil {
+		return pdfCharWidth
+	}
+	if w := f.ttf.width(f.ttf.glyph('0')); w > 0 {
+		return float64(w) / 1000 * pdfFontSize
+	}
+	return pdfCharWidth
+}
+
+// คำสั่งแสดงข้อความหนึ่งบรรทัดโดยให้แต่ละช่องกว้าง cell เท่ากันเพื่อให้คอลัมน์ตรงกัน
+// ฟอนต์ TrueType เข้ารหัสเป็น glyph ID (Identity-H) สระ/วรรณยุกต์ไทยวางซ้อนอยู่ในช่องของพยัญชนะ
+func (f *pdfFont) show(s string, cell float64) string {
+	if f.ttf == nil {
+		return "(" + pdfText(s) + ") Tj"
+	}
+	cellUnits := cell / pdfFontSize * 1000
+	var b strings.Builder
+	var glyphs strings.Builder
+	width, cells := 0, 0
+	flush := func() {
+		if glyphs.Len() == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "<%s>", glyphs.String())
+		if adjust := float64(width) - cellUnits*float64(cells); adjust != 0 {
+			fmt.Fprintf(&b, " %.1f ", adjust)
+		}
+		glyphs.Reset()
+		width, cells = 0, 0
+	}
+
+	b.WriteByte('[')
+	for _, r := range s {
+		combining := isThaiCombining(r)
+		if !combining {
+			flush()
+			cells = 1
+		}
+		gid := f.ttf.glyph(r)
+		if gid == 0 {
+			r = '?'
+			gid = f.ttf.glyph(r)
+		}
+		if _, ok := f.used[gid]; !ok {
+			f.used[gid] = r
+		}
+		fmt.Fprintf(&glyphs, "%04X", gid)
+		width += f.ttf.width(gid)
+	}
+	flush()
+	b.WriteString("] TJ")
+	return b.String()
+}
+
+// object ของฟอนต์ (Type0 + CIDFontType2 + ไฟล์ฟอนต์ + ToUnicode) คืนค่าหมายเลข object ที่อ้างใน Resources
+func (f *pdfFont) write(doc *pdfDocument) int {
+	if f.ttf == nil {
+		return doc.add(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.base))
+	}
+	t := f.ttf
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(t.Data)
+	zw.Close()
+	fontFile := doc.add(fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), len(t.Data), compressed.String()))
+
+	descriptor := doc.add(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		t.Name, t.scale(t.BBox[0]), t.scale(t.BBox[1]), t.scale(t.BBox[2]), t.scale(t.BBox[3]), t.scale(t.Ascent), t.scale(t.Descent), t.scale(t.Ascent), fontFile))
+
+	gids := make([]int, 0, len(f.used))
+	for gid := range f.used {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+	var widths strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", gid, t.width(uint16(gid)))
+	}
+	cidFont := doc.add(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		t.Name, descriptor, strings.TrimSpace(widths.String())))
+
+	// ToUnicode ให้คัดลอก/ค้นหาข้อความใน PDF ได้
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for start := 0; start < len(gids); start += 100 {
+		end := start + 100
+		if end > len(gids) {
+			end = len(gids)
+		}
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", end-start)
+		for _, gid := range gids[start:end] {
+			fmt.Fprintf(&cmap, "<%04X> <", gid)
+			for _, unit := range utf16.Encode([]rune{f.used[uint16(gid)]}) {
+				fmt.Fprintf(&cmap, "%04X", unit)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend")
+	toUnicode := doc.add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", cmap.Len(), cmap.String()))
+
+	return doc.add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		t.Name, cidFont, toUnicode))
+}
+
+// pdfDocument รายการ object ของไฟล์ PDF หมายเลข object เริ่มที่ 1 ตามลำดับที่เพิ่ม
+type pdfDocument struct {
+	objects []string
+}
+
+func (d *pdfDocument) add(obj string) int {
+	d.objects = append(d.objects, obj)
+	return len(d.objects)
+}
+
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(d.objects))
+	for i, obj := range d.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+	return out.Bytes()
+}
+
+// สร้างไฟล์ PDF หน้าเดียวของใบเสร็จ ขนาดหน้ากว้างเท่ากระดาษ 58mm หรือ 80mm และสูงตามจำนวนบรรทัด
+// จัดคอลัมน์เหมือนใบเสร็จจากเครื่องพิมพ์ และวาด QR code หรือบาร์โค้ด CODE128 ของเลขที่ใบเสร็จตาม CodeType
+func PDF(r Receipt, paperWidth int) []byte {
+	cols := Columns(paperWidth)
+	lines := layout(r, cols)
+
+	regularTTF, boldTTF := receiptFonts()
+	regular := newPDFFont("F1", regularTTF, "Courier")
+	bold := newPDFFont("F2", boldTTF, "Courier-Bold")
+	fakeBold := false
+	if regularTTF != nil && boldTTF == nil {
+		bold, fakeBold = regular, true
+	}
+	cell := regular.cellWidth()
+
+	pageWidth := float64(paperWidth) / 25.4 * 72
+	var bars []int
+	var qr [][]bool
+	if r.CodeType == "qr" {
+		qr = QRCode(r.Number)
+	}
+	// QR code ยาวเกินที่รองรับจะใช้บาร์โค้ดแทน
+	if r.CodeType != "none" && qr == nil {
+		bars = Code128(r.Number)
+	}
+	qrModule := pdfQRModule
+	if len(qr) > 0 {
+		if available := pageWidth - pdfMargin*2; float64(len(qr)+pdfQRQuiet*2)*qrModule > available {
+			qrModule = available / float64(len(qr)+pdfQRQuiet*2)
+		}
+	}
+
+	pageHeight := pdfMargin*2 + float64(len(lines))*pdfLineHeight
+	switch {
+	case len(qr) > 0:
+		pageHeight += float64(len(qr)+pdfQRQuiet)*qrModule + pdfLineHeight*2
+	case len(bars) > 0:
+		pageHeight += pdfBarHeight + pdfLineHeight*2
+	}
+	left := (pageWidth - float64(cols)*cell) / 2
+
+	var content bytes.Buffer
+	y := pageHeight - pdfMargin - pdfFontSize
+	for _, line := range lines {
+		font := regular
+		if line.Bold {
+			font = bold
+		}
+		if line.Bold && fakeBold {
+			// ไม่มีฟอนต์ตัวหนา ใช้ฟอนต์ปกติแบบเติมและลากเส้นขอบ
+			fmt.Fprintf(&content, "q 2 Tr 0.3 w BT /%s %.1f Tf %.2f %.2f Td %s ET Q\n", font.resource, pdfFontSize, left, y, font.show(line.Text, cell))
+		} else {
+			fmt.Fprintf(&content, "BT /%s %.1f Tf %.2f %.2f Td %s ET\n", font.resource, pdfFontSize, left, y, font.show(line.Text, cell))
+		}
+		y -= pdfLineHeight
+	}
+
+	switch {
+	case len(qr) > 0:
+		size := float64(len(qr)) * qrModule
+		x := (pageWidth - size) / 2
+		y -= float64(pdfQRQuiet)/2*qrModule + size
+		// วาด module ดำที่ติดกันในแถวเดียวเป็นสี่เหลี่ยมเดียว
+		for row, modules := range qr {
+			top := y + size - float64(row+1)*qrModule
+			for col := 0; col < len(modules); col++ {
+				if !modules[col] {
+					continue
+				}
+				run := col
+				for run < len(modules) && modules[run] {
+					run++
+				}
+				fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re f\n", x+float64(col)*qrModule, top, float64(run-col)*qrModule, qrModule)
+				col = run
+			}
+		}
+		y -= float64(pdfQRQuiet) / 2 * qrModule
+	case len(bars) > 0:
+		total := 0
+		for _, w := range bars {
+			total += w
+		}
+		module := pdfModule
+		if available := pageWidth - pdfMargin*2; float64(total)*module > available {
+			module = available / float64(total)
+		}
+		x := (pageWidth - float64(total)*module) / 2
+		y -= pdfBarHeight
+		for i, w := range bars {
+			if i%2 == 0 {
+				fmt.Fprintf(&content, "%.3f %.2f %.3f %.2f re f\n", x, y, float64(w)*module, pdfBarHeight)
+			}
+			x += float64(w) * module
+		}
+	}
+	if len(qr) > 0 || len(bars) > 0 {
+		y -= pdfLineHeight
+		text := truncate(r.Number, cols)
+		fmt.Fprintf(&content, "BT /F1 %.1f Tf %.2f %.2f Td %s ET\n", pdfFontSize, (pageWidth-float64(displayWidth(text))*cell)/2, y, regular.show(text, cell))
+	}
+
+	doc := &pdfDocument{}
+	doc.add("<< /Type /Catalog /Pages 2 0 R >>")
+	doc.add("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	page := doc.add("")
+	contents := doc.add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	fonts := fmt.Sprintf("/F1 %d 0 R", regular.write(doc))
+	if bold != regular {
+		fonts += fmt.Sprintf(" /F2 %d 0 R", bold.write(doc))
+	}
+	doc.objects[page-1] = fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> >> /Contents %d 0 R >>", pageWidth, pageHeight, fonts, contents)
+	return doc.bytes()
+}
@@ -0,0 +1,436 @@
+package Printing
+
+// QR code แบบ byte mode ระดับแก้ไขข้อผิดพลาด M (เหมือนคำสั่ง ESC/POS) รองรับ version 1-10
+// พอสำหรับเลขที่ใบเสร็จ (version 10-M เก็บได้ 213 bytes)
+
+// จำนวน codeword แก้ไขข้อผิดพลาดต่อ block และจำนวน block ของระดับ M แยกตาม version (index 0 ไม่ใช้)
+var (
+	qrECCPerBlock = [...]int{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26}
+	qrBlocks      = [...]int{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5}
+)
+
+const (
+	qrMaxVersion = 10
+	qrFormatM    = 0 // ค่า error correction ของระดับ M ใน format information
+)
+
+type qrMatrix struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // module ที่เป็น finder/timing/alignment/format ห้ามวางข้อมูลทับ
+}
+
+// เข้ารหัสข้อความเป็น QR code คืนค่าเป็นตาราง module (true = ดำ) ไม่รวม quiet zone
+// คืนค่า nil ถ้าข้อความยาวเกิน version สูงสุดที่รองรับ
+func QRCode(data string) [][]bool {
+	version := 0
+	for v := 1; v <= qrMaxVersion; v++ {
+		if 4+qrCountBits(v)+8*len(data) <= qrDataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil
+	}
+
+	q := newQRMatrix(version)
+	q.drawCodewords(qrAddECC(qrEncodeBytes(data, version), version))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // XOR ซ้ำเพื่อคืนค่าเดิม
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+	return q.modules
+}
+
+// จำนวนบิตของความยาวข้อมูลใน byte mode
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// จำนวน module ที่ใช้วางข้อมูลได้ (ไม่รวม function pattern)
+func qrRawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		result -= (25*align-10)*align - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func qrDataCodewords(version int) int {
+	return qrRawModules(version)/8 - qrECCPerBlock[version]*qrBlocks[version]
+}
+
+// ตำแหน่งศูนย์กลางของ alignment pattern ตามแนวแกน
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	align := version/7 + 2
+	step := (version*4 + align*2 + 1) / (align*2 - 2) * 2
+	positions := make([]int, align)
+	positions[0] = 6
+	for i, pos := align-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// ข้อมูลแบบ byte mode พร้อม terminator และ pad bytes ให้เต็มจำนวน data codeword
+func qrEncodeBytes(data string, version int) []byte {
+	var bits []bool
+	appendBits := func(value int, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+	appendBits(0x4, 4)
+	appendBits(len(data), qrCountBits(version))
+	for i := 0; i < len(data); i++ {
+		appendBits(int(data[i]), 8)
+	}
+
+	capacity := qrDataCodewords(version) * 8
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+	return codewords
+}
+
+// แบ่งข้อมูลเป็น block เติม Reed-Solomon ของแต่ละ block แล้วสลับ codeword ตามมาตรฐาน
+func qrAddECC(data []byte, version int) []byte {
+	numBlocks := qrBlocks[version]
+	eccLen := qrECCPerBlock[version]
+	raw := qrRawModules(version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+	divisor := qrRSDivisor(eccLen)
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := qrRSRemainder(block, divisor)
+		if i < numShort {
+			block = append(block, 0) // ตำแหน่งว่างให้ block สั้นยาวเท่า block ยาว
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	var result []byte
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// คูณใน GF(2^8) ด้วย polynomial 0x11D
+func qrMultiply(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+func qrRSDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrRSRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= qrMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// ตาราง module พร้อม finder, timing, alignment, version และพื้นที่ของ format information
+func newQRMatrix(version int) *qrMatrix {
+	size := version*4 + 17
+	q := &qrMatrix{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					dist := qrMax(qrAbs(dx), qrAbs(dy))
+					q.set(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := qrAlignmentPositions(version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			// ไม่วางทับ finder pattern ทั้งสามมุม
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormat(0)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>uint(i))&1 == 1
+			a, b := size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+	return q
+}
+
+// วาง function module ที่ตำแหน่ง (x, y)
+func (q *qrMatrix) set(x int, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// format information (ระดับ M และ mask) ทั้งสองชุด
+func (q *qrMatrix) drawFormat(mask int) {
+	data := qrFormatM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// วางข้อมูลแบบซิกแซกทีละสองคอลัมน์จากมุมขวาล่าง
+func (q *qrMatrix) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrMatrix) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// คะแนนความยากในการอ่านตามกฎ 4 ข้อของมาตรฐาน ใช้เลือก mask ที่ดีที่สุด
+func (q *qrMatrix) penalty() int {
+	size := q.size
+	at := func(x int, y int, horizontal bool) bool {
+		if horizontal {
+			return q.modules[y][x]
+		}
+		return q.modules[x][y]
+	}
+
+	result := 0
+	for _, horizontal := range []bool{true, false} {
+		for a := 0; a < size; a++ {
+			// สีเดียวกันติดกันตั้งแต่ 5 module
+			run := 1
+			for b := 1; b < size; b++ {
+				if at(b, a, horizontal) == at(b-1, a, horizontal) {
+					run++
+					if run == 5 {
+						result += 3
+					} else if run > 5 {
+						result++
+					}
+				} else {
+					run = 1
+				}
+			}
+			// ลายคล้าย finder pattern 1:1:3:1:1 ที่มีช่องว่าง 4 module ด้านใดด้านหนึ่ง
+			for b := 0; b+7 <= size; b++ {
+				if !(at(b, a, horizontal) && !at(b+1, a, horizontal) && at(b+2, a, horizontal) && at(b+3, a, horizontal) &&
+					at(b+4, a, horizontal) && !at(b+5, a, horizontal) && at(b+6, a, horizontal)) {
+					continue
+				}
+				if q.lightRun(a, b-4, b, horizontal) || q.lightRun(a, b+7, b+11, horizontal) {
+					result += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			// บล็อก 2x2 สีเดียวกัน
+			if x+1 < size && y+1 < size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+	// สัดส่วน module ดำห่างจาก 50%
+	total := size * size
+	k := (qrAbs(dark*20-total*10)+total-1)/total - 1
+	if k > 0 {
+		result += k * 10
+	}
+	return result
+}
+
+// module ช่วง [from, to) ของแถว/คอลัมน์เป็นสีขาวทั้งหมด (นอกขอบนับเป็นสีขาว)
+func (q *qrMatrix) lightRun(line int, from int, to int, horizontal bool) bool {
+	for b := from; b < to; b++ {
+		if b < 0 || b >= q.size {
+			continue
+		}
+		if horizontal && q.modules[line][b] || !horizontal && q.modules[b][line] {
+			return false
+		}
+	}
+	return true
+}
+
+func qrAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func qrMax(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
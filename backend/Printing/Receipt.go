@@ -0,0 +1,204 @@
+package Printing
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ReceiptLine รายการสินค้าบนใบเสร็จ
+type ReceiptLine struct {
+	Name          string
+	Quantity      int
+	UnitPrice     float64
+	Total         float64 // ยอดสุทธิของรายการหลังหักส่วนลด
+	Discount      float64
+	DiscountLabel string // ชื่อโปรโมชัน หรือว่างถ้าเป็นส่วนลดที่พนักงานให้เอง
+}
+
+// ReceiptPayment การชำระเงินหนึ่งช่องทางบนใบเสร็จ
+type ReceiptPayment struct {
+	Method   string
+	Amount   float64
+	Tendered float64
+	Change   float64
+}
+
+// Receipt ข้อมูลทั้งหมดที่ใช้พิมพ์ใบเสร็จ (ไม่ขึ้นกับฐานข้อมูล)
+type Receipt struct {
+	BranchName     string
+	BranchAddress  string
+	TaxID          string
+	HeaderText     string
+	FooterText     string
+	Title          string // เช่น RECEIPT หรือ CREDIT NOTE
+	Number         string
+	Reference      string // เลขใบเสร็จต้นฉบับ (กรณีใบลดหนี้)
+	Date           time.Time
+	Lines          []ReceiptLine
+	DiscountAmount float64
+	NetAmount      float64
+	VatAmount      float64
+	TotalAmount    float64
+	Payments       []ReceiptPayment
+	ChangeDue      float64
+	CodeType       string // qr, barcode, none
+}
+
+// printLine ข้อความหนึ่งบรรทัดที่จัดรูปแบบตามความกว้างกระดาษแล้ว
+type printLine struct {
+	Text string
+	Bold bool
+}
+
+// จำนวนตัวอักษรต่อบรรทัด (Font A) ตามความกว้างกระดาษ
+func Columns(paperWidth int) int {
+	if paperWidth == 58 {
+		return 32
+	}
+	return 48
+}
+
+// สระ/วรรณยุกต์ไทยที่อยู่บนหรือล่างพยัญชนะ ไม่กินความกว้างบนหัวพิมพ์
+func isThaiCombining(r rune) bool {
+	return r == 0x0E31 || (r >= 0x0E34 && r <= 0x0E3A) || (r >= 0x0E47 && r <= 0x0E4E)
+}
+
+// ความกว้างของข้อความตามจำนวนช่องที่พิมพ์จริง
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if !isThaiCombining(r) {
+			width++
+		}
+	}
+	return width
+}
+
+// ตัดข้อความให้ไม่เกินความกว้างที่กำหนด
+func truncate(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	used := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if !isThaiCombining(r) {
+			if used == width {
+				break
+			}
+			used++
+		}
+		b.WriteRune(r)
+		s = s[size:]
+	}
+	return b.String()
+}
+
+func center(s string, cols int) string {
+	s = truncate(s, cols)
+	pad := (cols - displayWidth(s)) / 2
+	return strings.Repeat(" ", pad) + s
+}
+
+// ข้อความซ้าย-ขวาในบรรทัดเดียวกัน เช่น "TOTAL          100.00"
+func leftRight(left string, right string, cols int) string {
+	left = truncate(left, cols-displayWidth(right)-1)
+	pad := cols - displayWidth(left) - displayWidth(right)
+	if pad < 1 {
+		pad = 1
+	}
+	return left + strings.Repeat(" ", pad) + right
+}
+
+// จัดรูปแบบจำนวนเงิน เช่น 1,234.50
+func Money(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	parts := strings.SplitN(s, ".", 2)
+	var b strings.Builder
+	for i, r := range parts[0] {
+		if i > 0 && (len(parts[0])-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	out := b.String() + "." + parts[1]
+	if negative {
+		return "-" + out
+	}
+	return out
+}
+
+// จัดวางเนื้อหาใบเสร็จเป็นบรรทัดตามจำนวนคอลัมน์ ใช้ร่วมกันทั้ง ESC/POS และ PDF
+func layout(r Receipt, cols int) []printLine {
+	var lines []printLine
+	add := func(text string, bold bool) {
+		lines = append(lines, printLine{Text: text, Bold: bold})
+	}
+	addMultiline := func(text string) {
+		for _, l := range strings.Split(text, "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				add(center(l, cols), false)
+			}
+		}
+	}
+	rule := strings.Repeat("-", cols)
+
+	add(center(r.BranchName, cols), true)
+	addMultiline(r.BranchAddress)
+	if r.TaxID != "" {
+		add(center("TAX ID "+r.TaxID, cols), false)
+	}
+	addMultiline(r.HeaderText)
+	add(rule, false)
+
+	add(center(r.Title, cols), true)
+	add(leftRight("No.", r.Number, cols), false)
+	add(leftRight("Date", r.Date.Format("02/01/2006 15:04"), cols), false)
+	if r.Reference != "" {
+		add(leftRight("Ref.", r.Reference, cols), false)
+	}
+	add(rule, false)
+
+	for _, line := range r.Lines {
+		add(truncate(line.Name, cols), false)
+		if line.Discount == 0 {
+			add(leftRight("  "+strconv.Itoa(line.Quantity)+" x "+Money(line.UnitPrice), Money(line.Total), cols), false)
+			continue
+		}
+		// มีส่วนลด: แสดงยอดตามราคาป้าย แล้วตามด้วยบรรทัดส่วนลด
+		label := line.DiscountLabel
+		if label == "" {
+			label = "Discount"
+		}
+		add(leftRight("  "+strconv.Itoa(line.Quantity)+" x "+Money(line.UnitPrice), Money(line.UnitPrice*float64(line.Quantity)), cols), false)
+		add(leftRight("  "+truncate(label, cols-14), "-"+Money(line.Discount), cols), false)
+	}
+	add(rule, false)
+
+	if r.DiscountAmount != 0 {
+		add(leftRight("Discount", "-"+Money(r.DiscountAmount), cols), false)
+	}
+
+	add(leftRight("Net", Money(r.NetAmount), cols), false)
+	add(leftRight("VAT", Money(r.VatAmount), cols), false)
+	add(leftRight("TOTAL", Money(r.TotalAmount), cols), true)
+
+	if len(r.Payments) > 0 {
+		add(rule, false)
+		for _, p := range r.Payments {
+			add(leftRight(strings.ToUpper(p.Method), Money(p.Tendered), cols), false)
+		}
+		add(leftRight("CHANGE", Money(r.ChangeDue), cols), false)
+	}
+
+	if r.FooterText != "" {
+		add(rule, false)
+		addMultiline(r.FooterText)
+	}
+	return lines
+}
@@ -0,0 +1,177 @@
+package Printing
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// trueTypeFont ข้อมูลจากไฟล์ TrueType ที่ต้องใช้ฝังฟอนต์ใน PDF (CIDFontType2, Identity-H)
+type trueTypeFont struct {
+	Name       string
+	Data       []byte
+	UnitsPerEm int
+	Ascent     int
+	Descent    int
+	BBox       [4]int
+	advances   []int // ความกว้างของ glyph หน่วยเป็น font unit
+	cmap       []byte
+	cmapFormat int
+}
+
+var errUnsupportedFont = errors.New("unsupported font: expected a TrueType (glyf) font with a Unicode cmap")
+
+// อ่านไฟล์ฟอนต์ TrueType ชื่อฟอนต์ใน PDF ใช้ชื่อไฟล์
+func loadTrueType(path string) (*trueTypeFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return parseTrueType(name, data)
+}
+
+func parseTrueType(name string, data []byte) (*trueTypeFont, error) {
+	if len(data) < 12 {
+		return nil, errUnsupportedFont
+	}
+	if version := binary.BigEndian.Uint32(data); version != 0x00010000 && version != 0x74727565 { // 'true'
+		return nil, errUnsupportedFont
+	}
+
+	tables := map[string][]byte{}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + i*16
+		if record+16 > len(data) {
+			return nil, errUnsupportedFont
+		}
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset+length > len(data) {
+			return nil, errUnsupportedFont
+		}
+		tables[string(data[record:record+4])] = data[offset : offset+length]
+	}
+	head, hhea, hmtx, cmap := tables["head"], tables["hhea"], tables["hmtx"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || tables["glyf"] == nil || cmap == nil {
+		return nil, errUnsupportedFont
+	}
+
+	f := &trueTypeFont{
+		Name:       strings.Map(pdfNameRune, name),
+		Data:       data,
+		UnitsPerEm: int(binary.BigEndian.Uint16(head[18:])),
+		Ascent:     int(int16(binary.BigEndian.Uint16(hhea[4:]))),
+		Descent:    int(int16(binary.BigEndian.Uint16(hhea[6:]))),
+	}
+	if f.UnitsPerEm == 0 {
+		return nil, errUnsupportedFont
+	}
+	for i := range f.BBox {
+		f.BBox[i] = int(int16(binary.BigEndian.Uint16(head[36+i*2:])))
+	}
+
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numMetrics == 0 || len(hmtx) < numMetrics*4 {
+		return nil, errUnsupportedFont
+	}
+	f.advances = make([]int, numMetrics)
+	for i := range f.advances {
+		f.advances[i] = int(binary.BigEndian.Uint16(hmtx[i*4:]))
+	}
+
+	// ใช้ subtable Unicode แบบเต็ม (format 12) ถ้ามี ไม่เช่นนั้นใช้ BMP (format 4)
+	numSubtables := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < numSubtables && 4+i*8+8 <= len(cmap); i++ {
+		record := cmap[4+i*8:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		if offset+2 > len(cmap) || !(platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))) {
+			continue
+		}
+		format := int(binary.BigEndian.Uint16(cmap[offset:]))
+		if (format == 4 || format == 12) && format > f.cmapFormat {
+			f.cmap, f.cmapFormat = cmap[offset:], format
+		}
+	}
+	if f.cmap == nil {
+		return nil, errUnsupportedFont
+	}
+	return f, nil
+}
+
+// ตัวอักษรที่ใช้ในชื่อฟอนต์ของ PDF ได้
+func pdfNameRune(r rune) rune {
+	if r > 32 && r < 127 && !strings.ContainsRune("()<>[]{}/%#", r) {
+		return r
+	}
+	return -1
+}
+
+// glyph ID ของตัวอักษร (0 = ไม่มีในฟอนต์)
+func (f *trueTypeFont) glyph(r rune) uint16 {
+	t := f.cmap
+	u16 := func(i int) int {
+		if i+2 > len(t) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(t[i:]))
+	}
+	if f.cmapFormat == 12 {
+		if len(t) < 16 {
+			return 0
+		}
+		groups := int(binary.BigEndian.Uint32(t[12:]))
+		for i := 0; i < groups && 16+i*12+12 <= len(t); i++ {
+			group := t[16+i*12:]
+			start, end := rune(binary.BigEndian.Uint32(group)), rune(binary.BigEndian.Uint32(group[4:]))
+			if r >= start && r <= end {
+				return uint16(binary.BigEndian.Uint32(group[8:]) + uint32(r-start))
+			}
+		}
+		return 0
+	}
+
+	if r > 0xFFFF {
+		return 0
+	}
+	segments := u16(6) / 2
+	endCodes, startCodes, deltas, rangeOffsets := 14, 16+segments*2, 16+segments*4, 16+segments*6
+	for i := 0; i < segments; i++ {
+		if int(r) > u16(endCodes+i*2) {
+			continue
+		}
+		start := u16(startCodes + i*2)
+		if int(r) < start {
+			return 0
+		}
+		delta := u16(deltas + i*2)
+		rangeOffset := u16(rangeOffsets + i*2)
+		if rangeOffset == 0 {
+			return uint16(int(r) + delta)
+		}
+		g := u16(rangeOffsets + i*2 + rangeOffset + (int(r)-start)*2)
+		if g == 0 {
+			return 0
+		}
+		return uint16(g + delta)
+	}
+	return 0
+}
+
+// ความกว้างของ glyph หน่วยเป็น 1/1000 ของขนาดฟอนต์ (หน่วยที่ PDF ใช้)
+func (f *trueTypeFont) width(gid uint16) int {
+	advance := f.advances[len(f.advances)-1]
+	if int(gid) < len(f.advances) {
+		advance = f.advances[gid]
+	}
+	return advance * 1000 / f.UnitsPerEm
+}
+
+// แปลงค่าจาก font unit เป็น 1/1000 ของขนาดฟอนต์
+func (f *trueTypeFont) scale(v int) int {
+	return v * 1000 / f.UnitsPerEm
+}
@@ -0,0 +1,170 @@
+package Security
+
+import (
+	"strings"
+	"time"
+)
+
+// Policy การตั้งค่าการป้องกันการเดารหัสผ่าน
+type Policy struct {
+	Scope              string        // prefix ของ key แยกการนับของ login แต่ละแบบ (เช่น "pin")
+	MaxAccountFailures int           // login ผิดติดกันกี่ครั้งต่อบัญชีจึงล็อก
+	MaxIPFailures      int           // login ผิดติดกันกี่ครั้งต่อ IP จึงล็อก
+	BaseDelay          time.Duration // เวลารอหลัง login ผิดครั้งแรก แล้วเพิ่มเป็นสองเท่าทุกครั้ง
+	MaxDelay           time.Duration
+	LockoutDuration    time.Duration
+	FailureWindow      time.Duration // ถ้าไม่ได้ login ผิดนานกว่านี้ จะเริ่มนับใหม่
+}
+
+// DefaultPolicy ล็อก 15 นาทีหลังผิด 5 ครั้งต่อบัญชี หรือ 20 ครั้งต่อ IP
+var DefaultPolicy = Policy{
+	MaxAccountFailures: 5,
+	MaxIPFailures:      20,
+	BaseDelay:          time.Second,
+	MaxDelay:           30 * time.Second,
+	LockoutDuration:    15 * time.Minute,
+	FailureWindow:      time.Hour,
+}
+
+// PinPolicy สำหรับ login ด้วย PIN ที่เครื่อง POS นับแยกจาก login ด้วยรหัสผ่าน
+// PIN มีแค่ 4-6 หลัก จึงล็อกเร็วกว่าและนับต่อพนักงาน (account = employeeid)
+var PinPolicy = Policy{
+	Scope:              "pin",
+	MaxAccountFailures: 5,
+	MaxIPFailures:      30,
+	BaseDelay:          time.Second,
+	MaxDelay:           10 * time.Second,
+	LockoutDuration:    15 * time.Minute,
+	FailureWindow:      time.Hour,
+}
+
+// Decision ผลการตรวจสอบก่อนให้ลอง login
+type Decision struct {
+	Allowed    bool
+	Locked     bool          // ถูกล็อก (ไม่ใช่แค่ต้องรอ backoff)
+	RetryAfter time.Duration // เวลาที่ต้องรอก่อนลองใหม่
+}
+
+// Guard ตรวจสอบและบันทึกการ login ผิดแยกตามบัญชีและ IP
+type Guard struct {
+	Store  AttemptStore
+	Policy Policy
+	Now    func() time.Time
+}
+
+func NewGuard(store AttemptStore, policy Policy) *Guard {
+	return &Guard{Store: store, Policy: policy, Now: time.Now}
+}
+
+// key ของบัญชีไม่สนตัวพิมพ์เล็ก/ใหญ่ เพื่อไม่ให้เลี่ยงการนับด้วยการเปลี่ยนตัวพิมพ์
+func (g *Guard) accountKey(account string) string {
+	return g.scope() + "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func (g *Guard) ipKey(ip string) string {
+	return g.scope() + "ip:" + ip
+}
+
+func (g *Guard) scope() string {
+	if g.Policy.Scope == "" {
+		return ""
+	}
+	return g.Policy.Scope + ":"
+}
+
+// เวลารอหลัง login ผิด failures ครั้ง (exponential backoff)
+func (g *Guard) backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := g.Policy.BaseDelay
+	for i := 1; i < failures && delay < g.Policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.Policy.MaxDelay {
+		delay = g.Policy.MaxDelay
+	}
+	return delay
+}
+
+// Check ตรวจสอบว่าบัญชีและ IP นี้ลอง login ได้ตอนนี้หรือไม่
+func (g *Guard) Check(account string, ip string) (Decision, error) {
+	now := g.Now()
+	decision := Decision{Allowed: true}
+	for _, key := range []string{g.accountKey(account), g.ipKey(ip)} {
+		state, err := g.Store.Get(key)
+		if err != nil {
+			return decision, err
+		}
+
+		if !state.LockedUntil.IsZero() {
+			if now.Before(state.LockedUntil) {
+				decision.Allowed = false
+				decision.Locked = true
+				if wait := state.LockedUntil.Sub(now); wait > decision.RetryAfter {
+					decision.RetryAfter = wait
+				}
+				continue
+			}
+			// หมดเวลาล็อกแล้ว เริ่มนับใหม่
+			if err := g.Store.Reset(key); err != nil {
+				return decision, err
+			}
+			continue
+		}
+
+		if state.Failures > 0 {
+			if now.Sub(state.LastFailure) > g.Policy.FailureWindow {
+				if err := g.Store.Reset(key); err != nil {
+					return decision, err
+				}
+				continue
+			}
+			if wait := state.LastFailure.Add(g.backoff(state.Failures)).Sub(now); wait > 0 {
+				decision.Allowed = false
+				if wait > decision.RetryAfter {
+					decision.RetryAfter = wait
+				}
+			}
+		}
+	}
+	return decision, nil
+}
+
+// Failure บันทึกการ login ผิด และล็อกบัญชี/IP เมื่อผิดครบจำนวนที่กำหนด คืนค่า true ถ้าเพิ่งถูกล็อก
+func (g *Guard) Failure(account string, ip string) (bool, error) {
+	now := g.Now()
+	locked := false
+	limits := map[string]int{
+		g.accountKey(account): g.Policy.MaxAccountFailures,
+		g.ipKey(ip):           g.Policy.MaxIPFailures,
+	}
+	for key, limit := range limits {
+		state, err := g.Store.RecordFailure(key, now)
+		if err != nil {
+			return locked, err
+		}
+		if limit > 0 && state.Failures >= limit {
+			if err := g.Store.Lock(key, now.Add(g.Policy.LockoutDuration)); err != nil {
+				return locked, err
+			}
+			locked = true
+		}
+	}
+	return locked, nil
+}
+
+// Success ล้างการนับของบัญชีเมื่อ login สำเร็จ (การนับของ IP ยังคงอยู่ เพื่อกันการไล่เดาหลายบัญชี)
+func (g *Guard) Success(account string) error {
+	return g.Store.Reset(g.accountKey(account))
+}
+
+// Unlock ปลดล็อกบัญชี (ใช้โดยผู้ดูแลระบบ)
+func (g *Guard) Unlock(account string) error {
+	return g.Store.Reset(g.accountKey(account))
+}
+
+// Status สถานะการล็อกปัจจุบันของบัญชี
+func (g *Guard) Status(account string) (AttemptState, error) {
+	return g.Store.Get(g.accountKey(account))
+}
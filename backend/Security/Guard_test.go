@@ -0,0 +1,252 @@
+package Security
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// นาฬิกาที่เลื่อนเวลาเองได้ในการทดสอบ
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+var testPolicy = Policy{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      5,
+	BaseDelay:          time.Second,
+	MaxDelay:           4 * time.Second,
+	LockoutDuration:    15 * time.Minute,
+	FailureWindow:      time.Hour,
+}
+
+func newTestGuard(store AttemptStore, policy Policy) (*Guard, *testClock) {
+	clock := &testClock{now: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)}
+	guard := NewGuard(store, policy)
+	guard.Now = clock.Now
+	return guard, clock
+}
+
+func mustCheck(t *testing.T, g *Guard, account, ip string) Decision {
+	t.Helper()
+	decision, err := g.Check(account, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return decision
+}
+
+func mustFail(t *testing.T, g *Guard, account, ip string) bool {
+	t.Helper()
+	locked, err := g.Failure(account, ip)
+	if err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+	return locked
+}
+
+func TestBackoff(t *testing.T) {
+	g := NewGuard(NewMemoryStore(), testPolicy)
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 4 * time.Second},
+		{50, 4 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := g.backoff(tc.failures); got != tc.want {
+			t.Errorf("backoff(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestCheckBackoff(t *testing.T) {
+	g, clock := newTestGuard(NewMemoryStore(), testPolicy)
+
+	if d := mustCheck(t, g, "cashier@pos", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("first attempt should be allowed: %+v", d)
+	}
+
+	mustFail(t, g, "cashier@pos", "10.0.0.1")
+	d := mustCheck(t, g, "cashier@pos", "10.0.0.1")
+	if d.Allowed || d.Locked || d.RetryAfter != time.Second {
+		t.Fatalf("after 1 failure = %+v, want wait 1s", d)
+	}
+
+	clock.Advance(time.Second)
+	if d := mustCheck(t, g, "cashier@pos", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("after backoff should be allowed: %+v", d)
+	}
+
+	mustFail(t, g, "cashier@pos", "10.0.0.1")
+	clock.Advance(500 * time.Millisecond)
+	d = mustCheck(t, g, "cashier@pos", "10.0.0.1")
+	if d.Allowed || d.Locked || d.RetryAfter != 1500*time.Millisecond {
+		t.Fatalf("after 2 failures = %+v, want wait 1.5s", d)
+	}
+
+	// การนับของบัญชีไม่สนตัวพิมพ์และช่องว่าง
+	d = mustCheck(t, g, " Cashier@POS ", "10.0.0.2")
+	if d.Allowed {
+		t.Fatalf("account key should ignore case: %+v", d)
+	}
+}
+
+func TestFailureWindowResets(t *testing.T) {
+	g, clock := newTestGuard(NewMemoryStore(), testPolicy)
+
+	mustFail(t, g, "cashier@pos", "10.0.0.1")
+	mustFail(t, g, "cashier@pos", "10.0.0.1")
+	clock.Advance(time.Hour + time.Second)
+
+	if d := mustCheck(t, g, "cashier@pos", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("failures older than window should be ignored: %+v", d)
+	}
+	state, err := g.Status("cashier@pos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != 0 {
+		t.Fatalf("failures = %d, want reset to 0", state.Failures)
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	g, clock := newTestGuard(NewMemoryStore(), testPolicy)
+
+	for i := 1; i <= testPolicy.MaxAccountFailures; i++ {
+		locked := mustFail(t, g, "cashier@pos", "10.0.0.1")
+		if want := i == testPolicy.MaxAccountFailures; locked != want {
+			t.Fatalf("failure %d locked = %v, want %v", i, locked, want)
+		}
+		clock.Advance(10 * time.Second)
+	}
+
+	d := mustCheck(t, g, "cashier@pos", "10.0.0.9")
+	if d.Allowed || !d.Locked {
+		t.Fatalf("account should be locked: %+v", d)
+	}
+	if want := testPolicy.LockoutDuration - 10*time.Second; d.RetryAfter != want {
+		t.Fatalf("RetryAfter = %v, want %v", d.RetryAfter, want)
+	}
+
+	// บัญชีอื่นจาก IP เดิมยังลองได้
+	if d := mustCheck(t, g, "manager@pos", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("other account should not be locked: %+v", d)
+	}
+
+	// หมดเวลาล็อกแล้วลองใหม่ได้และเริ่มนับใหม่
+	clock.Advance(testPolicy.LockoutDuration)
+	if d := mustCheck(t, g, "cashier@pos", "10.0.0.9"); !d.Allowed {
+		t.Fatalf("lock should expire: %+v", d)
+	}
+	state, err := g.Status("cashier@pos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != 0 || !state.LockedUntil.IsZero() {
+		t.Fatalf("state after expiry = %+v, want reset", state)
+	}
+}
+
+func TestIPLockoutAcrossAccounts(t *testing.T) {
+	g, clock := newTestGuard(NewMemoryStore(), testPolicy)
+
+	accounts := []string{"a@pos", "b@pos", "c@pos", "d@pos", "e@pos"}
+	for i, account := range accounts {
+		locked := mustFail(t, g, account, "10.0.0.1")
+		if want := i == len(accounts)-1; locked != want {
+			t.Fatalf("failure %d locked = %v, want %v", i+1, locked, want)
+		}
+		// login สำเร็จของบัญชีไม่ล้างการนับของ IP
+		if err := g.Success(account); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(10 * time.Second)
+	}
+
+	d := mustCheck(t, g, "new@pos", "10.0.0.1")
+	if d.Allowed || !d.Locked {
+		t.Fatalf("ip should be locked: %+v", d)
+	}
+	if d := mustCheck(t, g, "new@pos", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("other ip should be allowed: %+v", d)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	g, _ := newTestGuard(NewMemoryStore(), testPolicy)
+
+	for i := 0; i < testPolicy.MaxAccountFailures; i++ {
+		mustFail(t, g, "cashier@pos", "10.0.0.1")
+	}
+	if d := mustCheck(t, g, "cashier@pos", "10.0.0.2"); !d.Locked {
+		t.Fatalf("account should be locked: %+v", d)
+	}
+
+	if err := g.Unlock("CASHIER@pos"); err != nil {
+		t.Fatal(err)
+	}
+	if d := mustCheck(t, g, "cashier@pos", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("unlocked account should be allowed: %+v", d)
+	}
+	state, err := g.Status("cashier@pos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != (AttemptState{}) {
+		t.Fatalf("state after unlock = %+v, want empty", state)
+	}
+}
+
+func TestScopesAreSeparate(t *testing.T) {
+	store := NewMemoryStore()
+	pin := testPolicy
+	pin.Scope = "pin"
+	passwordGuard, _ := newTestGuard(store, testPolicy)
+	pinGuard, _ := newTestGuard(store, pin)
+
+	for i := 0; i < pin.MaxAccountFailures; i++ {
+		mustFail(t, pinGuard, "emp-1", "10.0.0.1")
+	}
+	if d := mustCheck(t, pinGuard, "emp-1", "10.0.0.2"); !d.Locked {
+		t.Fatalf("pin should be locked: %+v", d)
+	}
+	if d := mustCheck(t, passwordGuard, "emp-1", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("password login should not share pin counter: %+v", d)
+	}
+}
+
+func TestMemoryStoreConcurrentFailures(t *testing.T) {
+	store := NewMemoryStore()
+	at := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.RecordFailure("account:cashier@pos", at); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	state, err := store.Get("account:cashier@pos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != 100 {
+		t.Fatalf("failures = %d, want 100", state.Failures)
+	}
+}
@@ -0,0 +1,117 @@
+package Security
+
+import (
+	"sync"
+	"time"
+
+	"github.com/posproject/Models"
+	"gorm.io/gorm"
+)
+
+// AttemptState สถานะการ login ผิดของ key หนึ่ง (บัญชีหรือ IP)
+type AttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time // zero = ไม่ถูกล็อก
+}
+
+// AttemptStore ที่เก็บจำนวนครั้งที่ login ผิด
+// RecordFailure ต้องเพิ่มค่าแบบ atomic เพราะ request login อาจเข้ามาพร้อมกัน
+type AttemptStore interface {
+	Get(key string) (AttemptState, error)
+	RecordFailure(key string, at time.Time) (AttemptState, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+// MemoryStore เก็บข้อมูลใน memory ของ process (ใช้ในการทดสอบหรือ server เครื่องเดียว)
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]AttemptState
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]AttemptState)}
+}
+
+func (s *MemoryStore) Get(key string) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(key string, at time.Time) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[key]
+	state.Failures++
+	state.LastFailure = at
+	s.states[key] = state
+	return state, nil
+}
+
+func (s *MemoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[key]
+	state.LockedUntil = until
+	s.states[key] = state
+	return nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+// GormStore เก็บข้อมูลในตาราง LoginAttempts ของ Postgres (ใช้ร่วมกันได้หลาย server)
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Get(key string) (AttemptState, error) {
+	var rows []Models.LoginAttempts
+	if err := s.db.Where("key = ?", key).Limit(1).Find(&rows).Error; err != nil {
+		return AttemptState{}, err
+	}
+	if len(rows) == 0 {
+		return AttemptState{}, nil
+	}
+	return toState(rows[0]), nil
+}
+
+func (s *GormStore) RecordFailure(key string, at time.Time) (AttemptState, error) {
+	var row Models.LoginAttempts
+	err := s.db.Raw(`
+		INSERT INTO "LoginAttempts" (key, failures, last_failure)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key)
+		DO UPDATE SET failures = "LoginAttempts".failures + 1, last_failure = EXCLUDED.last_failure
+		RETURNING key, failures, last_failure, locked_until`, key, at).Scan(&row).Error
+	if err != nil {
+		return AttemptState{}, err
+	}
+	return toState(row), nil
+}
+
+func (s *GormStore) Lock(key string, until time.Time) error {
+	return s.db.Model(&Models.LoginAttempts{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *GormStore) Reset(key string) error {
+	return s.db.Where("key = ?", key).Delete(&Models.LoginAttempts{}).Error
+}
+
+func toState(row Models.LoginAttempts) AttemptState {
+	state := AttemptState{Failures: row.Failures, LastFailure: row.LastFailure}
+	if row.LockedUntil != nil {
+		state.LockedUntil = *row.LockedUntil
+	}
+	return state
+}
@@ -5,10 +5,12 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/posproject/Database"
 	"github.com/posproject/Middleware"
 	"github.com/posproject/Migrations"
+	"github.com/posproject/Security"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -53,36 +55,81 @@ func main() {
 		log.Fatalf("Migration failed: %v", err)
 	}
 
+	// ตรวจ Inventory ที่ไม่ตรงกับ StockMovements เป็นระยะ (ตั้งค่าได้ด้วย INVENTORY_RECONCILE_INTERVAL เช่น 30m)
+	Database.StartInventoryReconciliation(posDB, envDuration("INVENTORY_RECONCILE_INTERVAL", time.Hour))
+	// ตรวจสินค้าที่ต่ำกว่าจุดสั่งซื้อและสร้างรายการเติมสินค้า (ตั้งค่าได้ด้วย REPLENISHMENT_SCAN_INTERVAL)
+	Database.StartReplenishmentScan(posDB, envDuration("REPLENISHMENT_SCAN_INTERVAL", time.Hour))
+
 	// สร้าง Fiber app
 	app := fiber.New()
 
 	// กำหนด CORS middleware
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "http://127.0.0.1:3000",                                                   // อนุญาตให้ React app ที่รันที่ localhost:3000 เข้าถึง
-		AllowMethods:     "GET,POST,PUT,PATCH,DELETE",                                               // อนุญาต HTTP methods
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, ngrok-skip-browser-warning", // อนุญาต headers
-		AllowCredentials: true,                                                                      // อนุญาตการใช้ credentials เช่น cookies, authorization headers
+		AllowOrigins:     "http://127.0.0.1:3000",                                                                   // อนุญาตให้ React app ที่รันที่ localhost:3000 เข้าถึง
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE",                                                               // อนุญาต HTTP methods
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Device-Token, ngrok-skip-browser-warning", // อนุญาต headers
+		AllowCredentials: true,                                                                                      // อนุญาตการใช้ credentials เช่น cookies, authorization headers
 	}))
 
+	// นับการ login ผิดในฐานข้อมูล เพื่อให้ใช้ร่วมกันได้หลาย server
+	loginGuard := Security.NewGuard(Security.NewGormStore(posDB), Security.DefaultPolicy)
+	pinGuard := Security.NewGuard(Security.NewGormStore(posDB), Security.PinPolicy) // PIN นับแยกจากรหัสผ่าน
+
 	// กำหนด routes สำหรับการจัดการต่างๆ
-	app.Post("/login", Database.LoginHandler(posDB)) // route สำหรับ login
+	app.Post("/login", Database.LoginHandler(posDB, loginGuard))      // route สำหรับ login
+	app.Post("/token/refresh", Database.RefreshTokenHandler(posDB))   // ต่ออายุ access token ด้วย refresh token
+	app.Post("/devices/auth", Database.DeviceAuthHandler(posDB))      // เครื่อง POS ขอ device token
+	app.Post("/login/pin", Database.PinLoginHandler(posDB, pinGuard)) // login ด้วย PIN ที่เครื่อง POS
 
 	// ใช้ middleware ตรวจสอบ JWT token สำหรับทุกๆ route ที่ต้องการ
-	app.Use(Middleware.IsAuthenticated())
+	app.Use(Middleware.IsAuthenticated(posDB))
+
+	// บันทึก AuditLogs ของทุก request ที่แก้ไขข้อมูล
+	app.Use(Middleware.AuditTrail(posDB))
+
+	app.Post("/logout", Database.LogoutHandler(posDB)) // ยกเลิก token ของ session ปัจจุบัน
 
 	// กำหนด routes อื่นๆ
 	Database.BranchRoutes(app, posDB)
 	Database.EmployeesRoutes(app, posDB)
+	Database.LoginSecurityRoutes(app, posDB, loginGuard, pinGuard)
+	Database.DeviceRoutes(app, posDB)
 	Database.ProductRoutes(app, posDB)
+	Database.StockAdjustmentRoutes(app, posDB) // ต้องมาก่อน InventoryRoutes เพราะ /inventory/:id
 	Database.InventoryRoutes(app, posDB)
+	Database.StocktakeRoutes(app, posDB)
 	Database.SaleRoutes(app, posDB)
+	Database.ShiftRoutes(app, posDB)
+	Database.RefundRoutes(app, posDB)
+	Database.PaymentRoutes(app, posDB)
 	Database.SaleItemRoutes(app, posDB)
 	Database.ReceiptRoutes(app, posDB)
 	Database.ReceiptItemRoutes(app, posDB)
+	Database.TaxInvoiceRoutes(app, posDB)
+	Database.ReceiptPrintRoutes(app, posDB)
 	Database.RequestRoutes(app, posDB)
 	Database.ShipmentRoutes(app, posDB)
+	Database.ReplenishmentRoutes(app, posDB)
 	Database.CategoryRoutes(app, posDB)
+	Database.PromotionRoutes(app, posDB)
+	Database.ReportRoutes(app, posDB)
+	Database.AuditRoutes(app, posDB)
+	Database.CustomerRoutes(app, posDB)
 
 	// เริ่มแอปพลิเคชัน
 	log.Fatal(app.Listen(":6060"))
 }
+
+// อ่านระยะเวลาจาก environment variable (เช่น 30m, 2h) ถ้าไม่ได้ตั้งหรือไม่ถูกต้องใช้ค่า fallback
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return interval
+}